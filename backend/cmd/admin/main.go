@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"backend/config"
+	"backend/db"
+	"backend/service/user"
+	"backend/types"
+	"github.com/go-sql-driver/mysql"
+)
+
+const usage = "usage: admin promote <email> [customer|staff|admin]"
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "promote" {
+		log.Fatal(usage)
+	}
+
+	email := os.Args[2]
+	role := types.RoleAdmin
+	if len(os.Args) > 3 {
+		role = os.Args[3]
+	}
+	if role != types.RoleCustomer && role != types.RoleStaff && role != types.RoleAdmin {
+		log.Fatalf("Unknown role: %s. %s", role, usage)
+	}
+
+	db, err := db.NewMySQLStorage(mysql.Config{
+		User:                 config.Envs.DBUser,
+		Passwd:               config.Envs.DBPassword,
+		Addr:                 config.Envs.DBAddress,
+		DBName:               config.Envs.DBName,
+		Net:                  "tcp",
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store := user.NewStore(db)
+	u, err := store.GetUserByEmail(email)
+	if err != nil {
+		log.Fatalf("Failed to find user %s: %v", email, err)
+	}
+
+	if err := store.UpdateUserRole(u.ID, role); err != nil {
+		log.Fatalf("Failed to update role: %v", err)
+	}
+	log.Printf("User %s is now %s", email, role)
+}
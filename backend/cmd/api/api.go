@@ -4,13 +4,32 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"time"
 
+	"backend/config"
+	"backend/db"
+	"backend/service/address"
+	"backend/service/mail"
 	"backend/service/user"
 	"backend/service/cart"
+	"backend/service/currency"
+	"backend/service/idempotency"
+	"backend/service/inventory"
+	"backend/service/category"
+	"backend/service/notify"
+	"backend/service/order"
+	"backend/service/payment"
 	"backend/service/product"
+	"backend/service/promotion"
+	"backend/service/shipping"
+	"backend/service/tax"
+	addressstore "backend/service/address"
 	cartstore "backend/service/cart"
+	categorystore "backend/service/category"
 	orderstore "backend/service/order"
+	paymentstore "backend/service/payment"
 	productstore "backend/service/product"
+	tokenstore "backend/service/token"
 	userstore "backend/service/user"
 	"github.com/gorilla/mux"
 )
@@ -30,8 +49,8 @@ func NewAPIServer(addr string, db *sql.DB) *APIServer {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, X-Currency")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -47,8 +66,8 @@ func (s *APIServer) Run() error {
 
 	router.Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, X-Currency")
 		w.WriteHeader(http.StatusNoContent)
 	})
 
@@ -57,16 +76,85 @@ func (s *APIServer) Run() error {
 	productStore := productstore.NewStore(s.db)
 	cartStore := cartstore.NewCartStore(s.db)
 	orderStore := orderstore.NewStore(s.db)
+	categoryStore := categorystore.NewStore(s.db)
+	tokenStore := tokenstore.NewStore(s.db)
+	addressStore := addressstore.NewStore(s.db)
+	paymentStore := paymentstore.NewStore(s.db)
+	idempotencyStore := idempotency.NewStore(s.db)
+	promotionStore := promotion.NewStore(s.db)
+	currencyStore := currency.NewStore(s.db)
+	taxStore := tax.NewStore(s.db)
+	shippingStore := shipping.NewStore(s.db)
+	reservationStore := inventory.NewStore(s.db)
+	transactor := db.NewTransactor(s.db)
 
-	userHandler := user.NewHandler(userStore)
+	mailer, err := mail.NewMailer(config.Envs)
+	if err != nil {
+		return err
+	}
+
+	provider, err := payment.NewProvider(config.Envs)
+	if err != nil {
+		return err
+	}
+
+	notifier, err := notify.NewNotifier(config.Envs)
+	if err != nil {
+		return err
+	}
+	strategy, err := inventory.NewAllocationStrategy(config.Envs)
+	if err != nil {
+		return err
+	}
+	stock := inventory.NewService(reservationStore, reservationStore, reservationStore, orderStore, strategy, transactor)
+	alerts := inventory.NewAlerts(reservationStore, notifier, mailer)
+	payments := payment.NewService(paymentStore, paymentStore, orderStore, provider, stock, transactor)
+
+	currencies := currency.NewService(currencyStore)
+	promotions := promotion.NewService(promotionStore, categoryStore, currencies)
+	taxes := tax.NewCalculator(taxStore, categoryStore)
+	shippingRates := shipping.NewProvider(shippingStore, currencies)
+
+	go idempotency.PurgeExpired(idempotencyStore, time.Hour)
+	go inventory.SweepExpired(stock, time.Minute)
+	go inventory.WatchStock(alerts, time.Minute)
+
+	userHandler := user.NewHandler(userStore, tokenStore, tokenStore, mailer, transactor)
 	userHandler.RegisterRoutes(subrouter)
 
-	productHandler := product.NewHandler(productStore, userStore)
+	productHandler := product.NewHandler(productStore, categoryStore, reservationStore, userStore, currencies, stock, transactor)
 	productHandler.RegisterRoutes(subrouter)
 
-	cartHandler := cart.NewHandler(productStore, orderStore, userStore, cartStore)
+	categoryHandler := category.NewHandler(categoryStore, productStore, userStore, currencies)
+	categoryHandler.RegisterRoutes(subrouter)
+
+	cartHandler := cart.NewHandler(productStore, orderStore, userStore, cartStore, addressStore, payments, promotions, taxes, shippingRates, stock, transactor, currencies, idempotencyStore)
 	cartHandler.RegisterRoutes(subrouter)
 
+	promotionHandler := promotion.NewHandler(promotionStore, userStore)
+	promotionHandler.RegisterRoutes(subrouter)
+
+	currencyHandler := currency.NewHandler(currencyStore, productStore, userStore)
+	currencyHandler.RegisterRoutes(subrouter)
+
+	taxHandler := tax.NewHandler(taxStore, userStore)
+	taxHandler.RegisterRoutes(subrouter)
+
+	shippingHandler := shipping.NewHandler(shippingStore, userStore)
+	shippingHandler.RegisterRoutes(subrouter)
+
+	inventoryHandler := inventory.NewHandler(reservationStore, reservationStore, reservationStore, reservationStore, userStore)
+	inventoryHandler.RegisterRoutes(subrouter)
+
+	addressHandler := address.NewHandler(addressStore, userStore, transactor, idempotencyStore)
+	addressHandler.RegisterRoutes(subrouter)
+
+	orderHandler := order.NewHandler(orderStore, userStore, payments, stock, transactor)
+	orderHandler.RegisterRoutes(subrouter)
+
+	paymentHandler := payment.NewHandler(payments, paymentStore, orderStore, userStore, idempotencyStore)
+	paymentHandler.RegisterRoutes(subrouter)
+
 	log.Println("Listening on ", s.addr)
 	return http.ListenAndServe(s.addr, router)
 }
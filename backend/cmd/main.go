@@ -7,10 +7,13 @@ import (
 	"backend/cmd/api"
 	"backend/config"
 	"backend/db"
+	"backend/types"
 	"github.com/go-sql-driver/mysql"
 )
 
 func main() {
+	types.SetDefaultCurrency(config.Envs.Currency)
+
 	db, err := db.NewMySQLStorage(mysql.Config{
 		User:                 config.Envs.DBUser,
 		Passwd:               config.Envs.DBPassword,
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS order_status_history;
+
+ALTER TABLE orders MODIFY `status` ENUM('pending', 'completed', 'paid', 'fulfilled', 'shipped', 'delivered', 'cancelled', 'refunded') NOT NULL DEFAULT 'pending';
+UPDATE orders SET `status` = 'completed' WHERE `status` IN ('paid', 'fulfilled', 'shipped', 'delivered');
+UPDATE orders SET `status` = 'cancelled' WHERE `status` = 'refunded';
+ALTER TABLE orders MODIFY `status` ENUM('pending', 'completed', 'cancelled') NOT NULL DEFAULT 'pending';
@@ -0,0 +1,17 @@
+ALTER TABLE orders MODIFY `status` ENUM('pending', 'completed', 'paid', 'fulfilled', 'shipped', 'delivered', 'cancelled', 'refunded') NOT NULL DEFAULT 'pending';
+UPDATE orders SET `status` = 'delivered' WHERE `status` = 'completed';
+ALTER TABLE orders MODIFY `status` ENUM('pending', 'paid', 'fulfilled', 'shipped', 'delivered', 'cancelled', 'refunded') NOT NULL DEFAULT 'pending';
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `orderId` INT UNSIGNED NOT NULL,
+  `fromStatus` VARCHAR(20) NOT NULL,
+  `toStatus` VARCHAR(20) NOT NULL,
+  `actorId` INT UNSIGNED NOT NULL,
+  `note` VARCHAR(255) NOT NULL DEFAULT '',
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (`orderId`) REFERENCES orders(`id`),
+  FOREIGN KEY (`actorId`) REFERENCES users(`id`)
+);
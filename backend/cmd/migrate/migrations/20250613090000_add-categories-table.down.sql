@@ -0,0 +1,5 @@
+ALTER TABLE products
+  DROP FOREIGN KEY fk_products_category,
+  DROP COLUMN `category_id`;
+
+DROP TABLE IF EXISTS categories;
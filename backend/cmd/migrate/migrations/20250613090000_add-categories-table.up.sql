@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS categories (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `parent_id` INT UNSIGNED NULL DEFAULT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  `slug` VARCHAR(100) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_categories_slug (`slug`),
+  FOREIGN KEY (`parent_id`) REFERENCES categories(`id`)
+);
+
+ALTER TABLE products
+  ADD COLUMN `category_id` INT UNSIGNED NULL DEFAULT NULL,
+  ADD CONSTRAINT fk_products_category FOREIGN KEY (`category_id`) REFERENCES categories(`id`) ON DELETE SET NULL;
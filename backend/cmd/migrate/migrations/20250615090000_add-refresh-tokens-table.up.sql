@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` INT UNSIGNED NOT NULL,
+  `family_id` CHAR(32) NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  `revoked_at` TIMESTAMP NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_refresh_tokens_hash (`token_hash`),
+  KEY idx_refresh_tokens_family (`family_id`),
+  FOREIGN KEY (`user_id`) REFERENCES users(`id`)
+);
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN `email_verified_at` TIMESTAMP NULL DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` INT UNSIGNED NOT NULL,
+  `purpose` ENUM('password_reset', 'email_verification') NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  `used_at` TIMESTAMP NULL DEFAULT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_user_tokens_hash (`token_hash`),
+  FOREIGN KEY (`user_id`) REFERENCES users(`id`)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD UNIQUE KEY `firstName` (`firstName`), ADD UNIQUE KEY `lastName` (`lastName`);
+ALTER TABLE users DROP COLUMN `deleted_at`;
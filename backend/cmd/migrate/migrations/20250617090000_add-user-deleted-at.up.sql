@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN `deleted_at` TIMESTAMP NULL DEFAULT NULL;
+
+-- Names were declared unique by mistake, which stops two people sharing a
+-- name and every anonymised account from being called "Deleted User".
+ALTER TABLE users DROP INDEX `firstName`, DROP INDEX `lastName`;
@@ -0,0 +1,15 @@
+ALTER TABLE orders ADD COLUMN `address` TEXT NOT NULL;
+
+UPDATE orders SET address = CONCAT_WS(', ', NULLIF(shippingName, ''), NULLIF(shippingLine1, ''), NULLIF(shippingLine2, ''), NULLIF(shippingCity, ''), NULLIF(shippingRegion, ''), NULLIF(shippingPostalCode, ''), NULLIF(shippingCountry, ''));
+
+ALTER TABLE orders
+  DROP COLUMN `shippingName`,
+  DROP COLUMN `shippingLine1`,
+  DROP COLUMN `shippingLine2`,
+  DROP COLUMN `shippingCity`,
+  DROP COLUMN `shippingRegion`,
+  DROP COLUMN `shippingPostalCode`,
+  DROP COLUMN `shippingCountry`,
+  DROP COLUMN `shippingPhone`;
+
+DROP TABLE IF EXISTS addresses;
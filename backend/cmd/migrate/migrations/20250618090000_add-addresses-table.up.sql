@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS addresses (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` INT UNSIGNED NOT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  `line1` VARCHAR(255) NOT NULL,
+  `line2` VARCHAR(255) NOT NULL DEFAULT '',
+  `city` VARCHAR(100) NOT NULL,
+  `region` VARCHAR(100) NOT NULL DEFAULT '',
+  `postal_code` VARCHAR(20) NOT NULL DEFAULT '',
+  `country` CHAR(2) NOT NULL,
+  `phone` VARCHAR(30) NOT NULL DEFAULT '',
+  `is_default_shipping` BOOLEAN NOT NULL DEFAULT FALSE,
+  `is_default_billing` BOOLEAN NOT NULL DEFAULT FALSE,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  KEY idx_addresses_user (`user_id`),
+  FOREIGN KEY (`user_id`) REFERENCES users(`id`)
+);
+
+-- Orders keep a copy of the shipping address so that editing or deleting
+-- the address book entry later does not change them.
+ALTER TABLE orders
+  ADD COLUMN `shippingName` VARCHAR(100) NOT NULL DEFAULT '',
+  ADD COLUMN `shippingLine1` VARCHAR(255) NOT NULL DEFAULT '',
+  ADD COLUMN `shippingLine2` VARCHAR(255) NOT NULL DEFAULT '',
+  ADD COLUMN `shippingCity` VARCHAR(100) NOT NULL DEFAULT '',
+  ADD COLUMN `shippingRegion` VARCHAR(100) NOT NULL DEFAULT '',
+  ADD COLUMN `shippingPostalCode` VARCHAR(20) NOT NULL DEFAULT '',
+  ADD COLUMN `shippingCountry` CHAR(2) NOT NULL DEFAULT '',
+  ADD COLUMN `shippingPhone` VARCHAR(30) NOT NULL DEFAULT '';
+
+UPDATE orders SET shippingLine1 = LEFT(address, 255);
+
+ALTER TABLE orders DROP COLUMN `address`;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS payments (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `provider` VARCHAR(20) NOT NULL,
+  `provider_ref` VARCHAR(255) NOT NULL,
+  `amount` DECIMAL(10, 2) NOT NULL,
+  `currency` CHAR(3) NOT NULL,
+  `status` ENUM('pending', 'captured', 'failed', 'refunded') NOT NULL DEFAULT 'pending',
+  `failure_reason` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_payments_provider_ref (`provider`, `provider_ref`),
+  KEY idx_payments_order (`order_id`),
+  FOREIGN KEY (`order_id`) REFERENCES orders(`id`)
+);
@@ -0,0 +1,4 @@
+DELETE FROM order_status_history WHERE actorId IS NULL;
+ALTER TABLE order_status_history MODIFY `actorId` INT UNSIGNED NOT NULL;
+
+DROP TABLE IF EXISTS webhook_events;
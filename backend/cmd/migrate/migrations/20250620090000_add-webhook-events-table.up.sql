@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS webhook_events (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `provider` VARCHAR(20) NOT NULL,
+  `event_id` VARCHAR(255) NOT NULL,
+  `type` VARCHAR(100) NOT NULL,
+  `intent_id` VARCHAR(255) NOT NULL DEFAULT '',
+  `payload` MEDIUMTEXT NOT NULL,
+  `status` ENUM('received', 'processed', 'ignored', 'failed') NOT NULL DEFAULT 'received',
+  `error` VARCHAR(255) NOT NULL DEFAULT '',
+  `received_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `processed_at` TIMESTAMP NULL DEFAULT NULL,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_webhook_events_event (`provider`, `event_id`),
+  KEY idx_webhook_events_status (`status`)
+);
+
+-- Status changes made by the system, such as a payment webhook, have no
+-- acting user.
+ALTER TABLE order_status_history MODIFY `actorId` INT UNSIGNED NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` INT UNSIGNED NOT NULL,
+  `idempotency_key` VARCHAR(255) NOT NULL,
+  `request_hash` CHAR(64) NOT NULL,
+  `response_status` SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  `response_body` MEDIUMBLOB NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_idempotency_keys_key (`user_id`, `idempotency_key`),
+  KEY idx_idempotency_keys_expires (`expires_at`),
+  FOREIGN KEY (`user_id`) REFERENCES users(`id`)
+);
@@ -0,0 +1,9 @@
+ALTER TABLE orders
+  DROP COLUMN `subtotal`,
+  DROP COLUMN `discountTotal`;
+
+ALTER TABLE carts DROP COLUMN `coupon_code`;
+
+DROP TABLE IF EXISTS order_discounts;
+DROP TABLE IF EXISTS promotion_redemptions;
+DROP TABLE IF EXISTS promotions;
@@ -0,0 +1,60 @@
+-- product_id and category_id scope a promotion. They carry no foreign keys:
+-- a promotion whose product or category goes away simply stops applying.
+CREATE TABLE IF NOT EXISTS promotions (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `code` VARCHAR(50) NOT NULL,
+  `description` VARCHAR(255) NOT NULL DEFAULT '',
+  `type` ENUM('percentage', 'fixed', 'buy_x_get_y') NOT NULL,
+  `value` DECIMAL(10, 2) NOT NULL,
+  `min_spend` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+  `buy_quantity` INT UNSIGNED NOT NULL DEFAULT 0,
+  `get_quantity` INT UNSIGNED NOT NULL DEFAULT 0,
+  `product_id` INT UNSIGNED NULL DEFAULT NULL,
+  `category_id` INT UNSIGNED NULL DEFAULT NULL,
+  `max_uses` INT UNSIGNED NOT NULL DEFAULT 0,
+  `max_uses_per_user` INT UNSIGNED NOT NULL DEFAULT 0,
+  `used_count` INT UNSIGNED NOT NULL DEFAULT 0,
+  `starts_at` TIMESTAMP NULL DEFAULT NULL,
+  `ends_at` TIMESTAMP NULL DEFAULT NULL,
+  `active` BOOLEAN NOT NULL DEFAULT TRUE,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_promotions_code (`code`)
+);
+
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `promotion_id` INT UNSIGNED NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `order_id` INT UNSIGNED NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  KEY idx_promotion_redemptions_user (`promotion_id`, `user_id`),
+  FOREIGN KEY (`promotion_id`) REFERENCES promotions(`id`),
+  FOREIGN KEY (`user_id`) REFERENCES users(`id`),
+  FOREIGN KEY (`order_id`) REFERENCES orders(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS order_discounts (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `promotion_id` INT UNSIGNED NULL DEFAULT NULL,
+  `code` VARCHAR(50) NOT NULL,
+  `description` VARCHAR(255) NOT NULL DEFAULT '',
+  `amount` DECIMAL(10, 2) NOT NULL,
+
+  PRIMARY KEY (`id`),
+  KEY idx_order_discounts_order (`order_id`),
+  FOREIGN KEY (`order_id`) REFERENCES orders(`id`),
+  FOREIGN KEY (`promotion_id`) REFERENCES promotions(`id`)
+);
+
+ALTER TABLE carts ADD COLUMN `coupon_code` VARCHAR(50) NULL DEFAULT NULL;
+
+ALTER TABLE orders
+  ADD COLUMN `subtotal` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+  ADD COLUMN `discountTotal` DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+UPDATE orders SET subtotal = total;
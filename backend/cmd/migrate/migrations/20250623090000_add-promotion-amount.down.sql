@@ -0,0 +1,5 @@
+ALTER TABLE promotions MODIFY COLUMN `value` DECIMAL(10, 2) NOT NULL;
+
+UPDATE promotions SET value = amount WHERE type = 'fixed';
+
+ALTER TABLE promotions DROP COLUMN `amount`;
@@ -0,0 +1,7 @@
+-- Fixed promotions move their amount out of value, which is now always a
+-- percentage and is kept to the four decimal places money rounding uses.
+ALTER TABLE promotions ADD COLUMN `amount` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `value`;
+
+UPDATE promotions SET amount = value, value = 0 WHERE type = 'fixed';
+
+ALTER TABLE promotions MODIFY COLUMN `value` DECIMAL(7, 4) NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+ALTER TABLE orders
+  DROP COLUMN `currency`,
+  DROP COLUMN `exchangeRate`;
+
+DROP TABLE IF EXISTS product_prices;
+DROP TABLE IF EXISTS exchange_rates;
@@ -0,0 +1,24 @@
+-- Rates are units of the currency per unit of the store's default currency,
+-- which has no row of its own.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+  `currency` CHAR(3) NOT NULL,
+  `rate` DECIMAL(18, 8) NOT NULL,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`currency`)
+);
+
+CREATE TABLE IF NOT EXISTS product_prices (
+  `product_id` INT UNSIGNED NOT NULL,
+  `currency` CHAR(3) NOT NULL,
+  `price` DECIMAL(10, 2) NOT NULL,
+
+  PRIMARY KEY (`product_id`, `currency`),
+  FOREIGN KEY (`product_id`) REFERENCES products(`id`) ON DELETE CASCADE
+);
+
+-- Existing orders were all charged in the default currency. The default
+-- here is only for them; new orders always say which currency they used.
+ALTER TABLE orders
+  ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'USD',
+  ADD COLUMN `exchangeRate` DECIMAL(18, 8) NOT NULL DEFAULT 1;
@@ -0,0 +1,8 @@
+ALTER TABLE order_items DROP COLUMN `tax`;
+
+ALTER TABLE orders DROP COLUMN `taxTotal`;
+
+ALTER TABLE categories DROP COLUMN `tax_class`;
+
+DROP TABLE IF EXISTS order_taxes;
+DROP TABLE IF EXISTS tax_rates;
@@ -0,0 +1,41 @@
+-- A rate with an empty region applies to the whole country; rates for a
+-- region apply on top of it.
+CREATE TABLE IF NOT EXISTS tax_rates (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(100) NOT NULL,
+  `country` CHAR(2) NOT NULL,
+  `region` VARCHAR(100) NOT NULL DEFAULT '',
+  `tax_class` VARCHAR(50) NOT NULL DEFAULT 'standard',
+  `rate` DECIMAL(7, 4) NOT NULL,
+  `inclusive` BOOLEAN NOT NULL DEFAULT FALSE,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  KEY idx_tax_rates_country (`country`, `region`)
+);
+
+-- Orders keep their own copy of each rate so later edits do not rewrite
+-- them.
+CREATE TABLE IF NOT EXISTS order_taxes (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `order_id` INT UNSIGNED NOT NULL,
+  `tax_rate_id` INT UNSIGNED NULL DEFAULT NULL,
+  `name` VARCHAR(100) NOT NULL,
+  `country` CHAR(2) NOT NULL,
+  `region` VARCHAR(100) NOT NULL DEFAULT '',
+  `rate` DECIMAL(7, 4) NOT NULL,
+  `inclusive` BOOLEAN NOT NULL DEFAULT FALSE,
+  `amount` DECIMAL(10, 2) NOT NULL,
+
+  PRIMARY KEY (`id`),
+  KEY idx_order_taxes_order (`order_id`),
+  FOREIGN KEY (`order_id`) REFERENCES orders(`id`),
+  FOREIGN KEY (`tax_rate_id`) REFERENCES tax_rates(`id`) ON DELETE SET NULL
+);
+
+-- An empty tax class is inherited from the parent category.
+ALTER TABLE categories ADD COLUMN `tax_class` VARCHAR(50) NOT NULL DEFAULT '';
+
+ALTER TABLE orders ADD COLUMN `taxTotal` DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+ALTER TABLE order_items ADD COLUMN `tax` DECIMAL(10, 2) NOT NULL DEFAULT 0;
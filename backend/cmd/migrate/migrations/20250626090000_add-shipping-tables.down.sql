@@ -0,0 +1,14 @@
+ALTER TABLE orders
+  DROP FOREIGN KEY fk_orders_shipping_method,
+  DROP COLUMN `shippingMethodId`,
+  DROP COLUMN `shippingMethod`,
+  DROP COLUMN `shippingTotal`;
+
+DROP TABLE IF EXISTS shipping_rate_tiers;
+DROP TABLE IF EXISTS shipping_methods;
+
+ALTER TABLE products
+  DROP COLUMN `weight`,
+  DROP COLUMN `length`,
+  DROP COLUMN `width`,
+  DROP COLUMN `height`;
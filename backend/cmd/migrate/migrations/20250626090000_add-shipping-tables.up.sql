@@ -0,0 +1,39 @@
+-- Weight is in grams and dimensions in millimetres; zero means unknown.
+ALTER TABLE products
+  ADD COLUMN `weight` INT UNSIGNED NOT NULL DEFAULT 0,
+  ADD COLUMN `length` INT UNSIGNED NOT NULL DEFAULT 0,
+  ADD COLUMN `width` INT UNSIGNED NOT NULL DEFAULT 0,
+  ADD COLUMN `height` INT UNSIGNED NOT NULL DEFAULT 0;
+
+-- Amounts are in the default currency. countries is a comma separated list
+-- of ISO 3166 codes, empty for everywhere.
+CREATE TABLE IF NOT EXISTS shipping_methods (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(100) NOT NULL,
+  `type` ENUM('flat_rate', 'weight_based', 'free_over', 'pickup') NOT NULL,
+  `rate` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+  `free_over` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+  `countries` VARCHAR(255) NOT NULL DEFAULT '',
+  `active` BOOLEAN NOT NULL DEFAULT TRUE,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS shipping_rate_tiers (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `method_id` INT UNSIGNED NOT NULL,
+  `max_weight` INT UNSIGNED NOT NULL,
+  `rate` DECIMAL(10, 2) NOT NULL,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_shipping_rate_tiers_weight (`method_id`, `max_weight`),
+  FOREIGN KEY (`method_id`) REFERENCES shipping_methods(`id`) ON DELETE CASCADE
+);
+
+-- Orders keep the method's name so deleting it does not rewrite them.
+ALTER TABLE orders
+  ADD COLUMN `shippingMethodId` INT UNSIGNED NULL DEFAULT NULL,
+  ADD COLUMN `shippingMethod` VARCHAR(100) NOT NULL DEFAULT '',
+  ADD COLUMN `shippingTotal` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+  ADD CONSTRAINT fk_orders_shipping_method FOREIGN KEY (`shippingMethodId`) REFERENCES shipping_methods(`id`) ON DELETE SET NULL;
@@ -0,0 +1,19 @@
+-- Active reservations hold stock for orders awaiting payment: they count
+-- against what can be sold without leaving products.quantity until they are
+-- committed on payment, or released when the order is cancelled or they
+-- expire.
+CREATE TABLE IF NOT EXISTS inventory_reservations (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `product_id` INT UNSIGNED NOT NULL,
+  `order_id` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+  `status` ENUM('active', 'committed', 'released') NOT NULL DEFAULT 'active',
+  `expires_at` TIMESTAMP NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  KEY idx_inventory_reservations_product (`product_id`, `status`),
+  KEY idx_inventory_reservations_expiry (`status`, `expires_at`),
+  FOREIGN KEY (`product_id`) REFERENCES products(`id`),
+  FOREIGN KEY (`order_id`) REFERENCES orders(`id`)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE inventory_reservations
+  DROP FOREIGN KEY fk_inventory_reservations_location,
+  DROP COLUMN `location_id`;
+
+DROP TABLE IF EXISTS stock_movements;
+DROP TABLE IF EXISTS location_stock;
+DROP TABLE IF EXISTS stock_locations;
@@ -0,0 +1,57 @@
+CREATE TABLE IF NOT EXISTS stock_locations (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(100) NOT NULL,
+  `code` VARCHAR(20) NOT NULL,
+  `country` CHAR(2) NOT NULL,
+  `region` VARCHAR(100) NOT NULL DEFAULT '',
+  `priority` INT UNSIGNED NOT NULL DEFAULT 0,
+  `active` BOOLEAN NOT NULL DEFAULT TRUE,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_stock_locations_code (`code`)
+);
+
+-- products.quantity stays the total on hand across locations.
+CREATE TABLE IF NOT EXISTS location_stock (
+  `location_id` INT UNSIGNED NOT NULL,
+  `product_id` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (`location_id`, `product_id`),
+  FOREIGN KEY (`location_id`) REFERENCES stock_locations(`id`),
+  FOREIGN KEY (`product_id`) REFERENCES products(`id`)
+);
+
+-- Rows are only ever inserted. from_location_id is NULL for stock arriving
+-- and to_location_id for stock leaving.
+CREATE TABLE IF NOT EXISTS stock_movements (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `product_id` INT UNSIGNED NOT NULL,
+  `from_location_id` INT UNSIGNED NULL DEFAULT NULL,
+  `to_location_id` INT UNSIGNED NULL DEFAULT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+  `reason` ENUM('transfer') NOT NULL,
+  `order_id` INT UNSIGNED NULL DEFAULT NULL,
+  `actor_id` INT UNSIGNED NULL DEFAULT NULL,
+  `note` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  KEY idx_stock_movements_product (`product_id`, `id`),
+  FOREIGN KEY (`product_id`) REFERENCES products(`id`),
+  FOREIGN KEY (`from_location_id`) REFERENCES stock_locations(`id`),
+  FOREIGN KEY (`to_location_id`) REFERENCES stock_locations(`id`),
+  FOREIGN KEY (`order_id`) REFERENCES orders(`id`),
+  FOREIGN KEY (`actor_id`) REFERENCES users(`id`)
+);
+
+-- Existing stock all starts out at one warehouse.
+INSERT INTO stock_locations (`id`, `name`, `code`, `country`) VALUES (1, 'Main warehouse', 'MAIN', 'US');
+INSERT INTO location_stock (`location_id`, `product_id`, `quantity`) SELECT 1, `id`, `quantity` FROM products;
+
+ALTER TABLE inventory_reservations ADD COLUMN `location_id` INT UNSIGNED NULL DEFAULT NULL AFTER `product_id`;
+UPDATE inventory_reservations SET `location_id` = 1;
+ALTER TABLE inventory_reservations
+  MODIFY `location_id` INT UNSIGNED NOT NULL,
+  ADD CONSTRAINT fk_inventory_reservations_location FOREIGN KEY (`location_id`) REFERENCES stock_locations(`id`);
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS stock_movements_no_delete;
+DROP TRIGGER IF EXISTS stock_movements_no_update;
+
+DELETE FROM stock_movements WHERE `reason` <> 'transfer';
+
+ALTER TABLE stock_movements MODIFY `reason` ENUM('transfer') NOT NULL;
@@ -0,0 +1,30 @@
+ALTER TABLE stock_movements
+  MODIFY `reason` ENUM('transfer', 'sale', 'restock', 'return', 'adjustment', 'damage') NOT NULL;
+
+-- Open every location's ledger with whatever stock it holds that earlier
+-- movements do not account for, so that the ledger adds up to it.
+CREATE TEMPORARY TABLE opening_balances AS
+SELECT ls.product_id, ls.location_id, CAST(ls.quantity AS SIGNED) - COALESCE(m.net, 0) AS difference
+FROM location_stock ls
+LEFT JOIN (
+  SELECT `product_id`, `location_id`, SUM(`delta`) AS net FROM (
+    SELECT `product_id`, `to_location_id` AS location_id, CAST(`quantity` AS SIGNED) AS delta FROM stock_movements WHERE `to_location_id` IS NOT NULL
+    UNION ALL
+    SELECT `product_id`, `from_location_id`, -CAST(`quantity` AS SIGNED) FROM stock_movements WHERE `from_location_id` IS NOT NULL
+  ) d GROUP BY `product_id`, `location_id`
+) m ON m.product_id = ls.product_id AND m.location_id = ls.location_id;
+
+INSERT INTO stock_movements (`product_id`, `to_location_id`, `quantity`, `reason`, `note`)
+SELECT `product_id`, `location_id`, `difference`, 'adjustment', 'opening balance' FROM opening_balances WHERE `difference` > 0;
+
+INSERT INTO stock_movements (`product_id`, `from_location_id`, `quantity`, `reason`, `note`)
+SELECT `product_id`, `location_id`, -`difference`, 'adjustment', 'opening balance' FROM opening_balances WHERE `difference` < 0;
+
+DROP TEMPORARY TABLE opening_balances;
+
+-- The ledger is append-only: mistakes are corrected by further movements.
+CREATE TRIGGER stock_movements_no_update BEFORE UPDATE ON stock_movements
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'stock_movements is append-only';
+
+CREATE TRIGGER stock_movements_no_delete BEFORE DELETE ON stock_movements
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'stock_movements is append-only';
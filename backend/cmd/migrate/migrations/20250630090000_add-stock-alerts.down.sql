@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS stock_subscriptions;
+
+ALTER TABLE products
+  DROP COLUMN `low_stock_alerted`,
+  DROP COLUMN `reorder_threshold`;
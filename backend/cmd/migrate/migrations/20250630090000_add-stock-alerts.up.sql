@@ -0,0 +1,19 @@
+ALTER TABLE products
+  ADD COLUMN `reorder_threshold` INT UNSIGNED NOT NULL DEFAULT 0,
+  ADD COLUMN `low_stock_alerted` BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- A user has at most one subscription per product; notified_at is cleared
+-- when they subscribe again.
+CREATE TABLE IF NOT EXISTS stock_subscriptions (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `product_id` INT UNSIGNED NOT NULL,
+  `user_id` INT UNSIGNED NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `notified_at` TIMESTAMP NULL DEFAULT NULL,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY idx_stock_subscriptions_product_user (`product_id`, `user_id`),
+  KEY idx_stock_subscriptions_pending (`notified_at`, `product_id`),
+  FOREIGN KEY (`product_id`) REFERENCES products(`id`),
+  FOREIGN KEY (`user_id`) REFERENCES users(`id`)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS refunds (
+  `payment_id` INT UNSIGNED NOT NULL,
+  `amount` DECIMAL(10, 2) NOT NULL,
+  `status` ENUM('requested', 'succeeded') NOT NULL DEFAULT 'requested',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`payment_id`),
+  FOREIGN KEY (`payment_id`) REFERENCES payments(`id`)
+);
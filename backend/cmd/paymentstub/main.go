@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"backend/config"
+	"backend/service/payment"
+)
+
+// paymentstub serves the Stripe-shaped stand-in API at STRIPE_API_URL so the
+// API can run with PAYMENT_PROVIDER=stripe without leaving the machine.
+func main() {
+	if config.Envs.StripeSecretKey == "" {
+		log.Fatal("STRIPE_SECRET_KEY is required")
+	}
+
+	u, err := url.Parse(config.Envs.StripeAPIURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("Payment stand-in listening on", u.Host)
+	log.Fatal(http.ListenAndServe(u.Host, payment.NewStandInServer(config.Envs.StripeSecretKey)))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"backend/config"
+	"backend/db"
+	"backend/service/inventory"
+	"backend/service/order"
+	"backend/service/payment"
+	"backend/types"
+	"github.com/go-sql-driver/mysql"
+)
+
+const usage = "usage: webhooks replay <event-id>... | webhooks replay --failed"
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "replay" {
+		log.Fatal(usage)
+	}
+
+	types.SetDefaultCurrency(config.Envs.Currency)
+
+	conn, err := db.NewMySQLStorage(mysql.Config{
+		User:                 config.Envs.DBUser,
+		Passwd:               config.Envs.DBPassword,
+		Addr:                 config.Envs.DBAddress,
+		DBName:               config.Envs.DBName,
+		Net:                  "tcp",
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	provider, err := payment.NewProvider(config.Envs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	strategy, err := inventory.NewAllocationStrategy(config.Envs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store := payment.NewStore(conn)
+	orderStore := order.NewStore(conn)
+	reservationStore := inventory.NewStore(conn)
+	transactor := db.NewTransactor(conn)
+	stock := inventory.NewService(reservationStore, reservationStore, reservationStore, orderStore, strategy, transactor)
+	payments := payment.NewService(store, store, orderStore, provider, stock, transactor)
+
+	eventIDs := os.Args[2:]
+	if eventIDs[0] == "--failed" {
+		events, err := store.GetWebhookEventsByStatus(types.WebhookEventFailed)
+		if err != nil {
+			log.Fatalf("Failed to list failed events: %v", err)
+		}
+
+		eventIDs = nil
+		for _, e := range events {
+			eventIDs = append(eventIDs, e.EventID)
+		}
+	}
+
+	failed := 0
+	for _, id := range eventIDs {
+		if _, err := payments.ProcessEvent(id, true); err != nil {
+			log.Printf("Failed to replay event %s: %v", id, err)
+			failed++
+			continue
+		}
+		log.Printf("Replayed event %s", id)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -16,7 +17,33 @@ type Config struct {
 	DBAddress  string
 	DBName     string
 	JWTExpirationInSeconds int64
+	RefreshTokenExpirationInSeconds int64
 	JWTSecret string
+	CursorSecret string
+	FrontendURL string
+	Mailer string
+	MailDir string
+	MailFrom string
+	SMTPHost string
+	SMTPPort string
+	SMTPUser string
+	SMTPPassword string
+	PasswordResetExpirationInSeconds int64
+	EmailVerificationExpirationInSeconds int64
+	RequireVerifiedEmail bool
+	PaymentProvider string
+	Currency string
+	Currencies []string
+	StripeAPIURL string
+	StripeSecretKey string
+	PaymentWebhookSecret string
+	PaymentWebhookToleranceInSeconds int64
+	IdempotencyKeyExpirationInSeconds int64
+	ReservationExpirationInSeconds int64
+	StockAllocation string
+	StockNotifier string
+	StockAlertEmail string
+	StockAlertWebhookURL string
 }
 
 var Envs = initConfig()
@@ -30,8 +57,34 @@ func initConfig() Config {
 		DBPassword: getEnv("DB_PASSWORD", "mypassword"),
 		DBAddress:  fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
 		DBName:     getEnv("DB_NAME", "ecom"),
-		JWTExpirationInSeconds: getEnvAsInt("JWT_EXPIRATION", 3600*24*7), 
+		JWTExpirationInSeconds: getEnvAsInt("JWT_EXPIRATION", 60*15),
+		RefreshTokenExpirationInSeconds: getEnvAsInt("REFRESH_TOKEN_EXPIRATION", 3600*24*30),
 		JWTSecret: getEnv("JWT_SECRET", ""),
+		CursorSecret: getEnv("CURSOR_SECRET", getEnv("JWT_SECRET", "")),
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
+		Mailer: getEnv("MAILER", "file"),
+		MailDir: getEnv("MAIL_DIR", "tmp/mail"),
+		MailFrom: getEnv("MAIL_FROM", "no-reply@ecom.local"),
+		SMTPHost: getEnv("SMTP_HOST", "localhost"),
+		SMTPPort: getEnv("SMTP_PORT", "587"),
+		SMTPUser: getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		PasswordResetExpirationInSeconds: getEnvAsInt("PASSWORD_RESET_EXPIRATION", 3600),
+		EmailVerificationExpirationInSeconds: getEnvAsInt("EMAIL_VERIFICATION_EXPIRATION", 3600*24*2),
+		RequireVerifiedEmail: getEnvAsBool("REQUIRE_VERIFIED_EMAIL", false),
+		PaymentProvider: getEnv("PAYMENT_PROVIDER", "fake"),
+		Currency: getEnv("CURRENCY", "usd"),
+		Currencies: getEnvAsList("CURRENCIES", "usd,eur,gbp"),
+		StripeAPIURL: getEnv("STRIPE_API_URL", "http://localhost:12111"),
+		StripeSecretKey: getEnv("STRIPE_SECRET_KEY", ""),
+		PaymentWebhookSecret: getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+		PaymentWebhookToleranceInSeconds: getEnvAsInt("PAYMENT_WEBHOOK_TOLERANCE", 300),
+		IdempotencyKeyExpirationInSeconds: getEnvAsInt("IDEMPOTENCY_KEY_EXPIRATION", 3600*24),
+		ReservationExpirationInSeconds: getEnvAsInt("RESERVATION_EXPIRATION", 60*15),
+		StockAllocation: getEnv("STOCK_ALLOCATION", "single"),
+		StockNotifier: getEnv("STOCK_NOTIFIER", "log"),
+		StockAlertEmail: getEnv("STOCK_ALERT_EMAIL", ""),
+		StockAlertWebhookURL: getEnv("STOCK_ALERT_WEBHOOK_URL", ""),
 	}
 }
 
@@ -50,3 +103,22 @@ func getEnvAsInt(key string, fallback int) int64 {
 	}
 	return int64(fallback)
 }
+
+func getEnvAsList(key, fallback string) []string {
+	var list []string
+	for _, value := range strings.Split(getEnv(key, fallback), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+func getEnvAsBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,19 @@
+package db
+
+import (
+	"database/sql"
+
+	"backend/types"
+)
+
+type Transactor struct {
+	db *sql.DB
+}
+
+func NewTransactor(db *sql.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+func (t *Transactor) BeginTx() (types.Tx, error) {
+	return t.db.Begin()
+}
@@ -0,0 +1,160 @@
+package address
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backend/service/auth"
+	"backend/service/idempotency"
+	"backend/types"
+	"backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store            types.AddressStore
+	userStore        types.UserStore
+	transactor       types.Transactor
+	idempotencyStore types.IdempotencyStore
+}
+
+func NewHandler(store types.AddressStore, userStore types.UserStore, transactor types.Transactor, idempotencyStore types.IdempotencyStore) *Handler {
+	return &Handler{store: store, userStore: userStore, transactor: transactor, idempotencyStore: idempotencyStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/me/addresses", auth.WithJWTAuth(h.handleGetAddresses, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/me/addresses", auth.WithJWTAuth(idempotency.WithIdempotencyKey(h.handleCreateAddress, h.idempotencyStore), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/me/addresses/{addressID}", auth.WithJWTAuth(h.handleGetAddress, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/me/addresses/{addressID}", auth.WithJWTAuth(h.handleUpdateAddress, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/me/addresses/{addressID}", auth.WithJWTAuth(h.handleDeleteAddress, h.userStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetAddresses(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	addresses, err := h.store.GetAddressesByUserID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, addresses)
+}
+
+func (h *Handler) handleGetAddress(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.ownAddress(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, a)
+}
+
+func (h *Handler) handleCreateAddress(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	payload, ok := parseAddressPayload(w, r)
+	if !ok {
+		return
+	}
+
+	a, err := h.saveAddress(types.Address{
+		UserID:            userID,
+		PostalAddress:     addressFromPayload(payload),
+		IsDefaultShipping: payload.IsDefaultShipping,
+		IsDefaultBilling:  payload.IsDefaultBilling,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, a)
+}
+
+func (h *Handler) handleUpdateAddress(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.ownAddress(w, r)
+	if !ok {
+		return
+	}
+
+	payload, ok := parseAddressPayload(w, r)
+	if !ok {
+		return
+	}
+
+	// Default flags can only be handed to another address, not cleared, so
+	// the user always keeps a default once they have one.
+	a, err := h.saveAddress(types.Address{
+		ID:                existing.ID,
+		UserID:            existing.UserID,
+		PostalAddress:     addressFromPayload(payload),
+		IsDefaultShipping: payload.IsDefaultShipping || existing.IsDefaultShipping,
+		IsDefaultBilling:  payload.IsDefaultBilling || existing.IsDefaultBilling,
+		CreatedAt:         existing.CreatedAt,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, a)
+}
+
+func (h *Handler) handleDeleteAddress(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.ownAddress(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteAddress(a.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Address deleted"})
+}
+
+// ownAddress loads the address named in the URL, writing a 404 unless it
+// belongs to the current user.
+func (h *Handler) ownAddress(w http.ResponseWriter, r *http.Request) (*types.Address, bool) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	addressID, err := strconv.Atoi(mux.Vars(r)["addressID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid address ID"))
+		return nil, false
+	}
+
+	a, err := h.store.GetAddressByID(addressID)
+	if err != nil || a.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, errAddressNotFound)
+		return nil, false
+	}
+
+	return a, true
+}
+
+func parseAddressPayload(w http.ResponseWriter, r *http.Request) (types.AddressPayload, bool) {
+	var payload types.AddressPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return payload, false
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return payload, false
+	}
+
+	if err := validateAddress(addressFromPayload(payload)); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return payload, false
+	}
+
+	return payload, true
+}
@@ -0,0 +1,201 @@
+package address
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"backend/service/auth"
+	"backend/types"
+	"github.com/gorilla/mux"
+)
+
+func TestAddressHandlers(t *testing.T) {
+	store := &mockAddressStore{addresses: map[int]*types.Address{}}
+	handler := NewHandler(store, nil, mockTransactor{}, nil)
+
+	send := func(method, path string, userID int, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/me/addresses", handler.handleGetAddresses).Methods(http.MethodGet)
+		router.HandleFunc("/me/addresses", handler.handleCreateAddress).Methods(http.MethodPost)
+		router.HandleFunc("/me/addresses/{addressID}", handler.handleGetAddress).Methods(http.MethodGet)
+		router.HandleFunc("/me/addresses/{addressID}", handler.handleUpdateAddress).Methods(http.MethodPut)
+		router.HandleFunc("/me/addresses/{addressID}", handler.handleDeleteAddress).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	home := types.AddressPayload{Name: "Jane Doe", Line1: "1 Main St", City: "Springfield", Region: "IL", PostalCode: "62701", Country: "US"}
+
+	t.Run("should fail if the payload is missing required fields", func(t *testing.T) {
+		rr := send(http.MethodPost, "/me/addresses", 1, types.AddressPayload{Name: "Jane Doe", Country: "US"})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should make the first address the default", func(t *testing.T) {
+		rr := send(http.MethodPost, "/me/addresses", 1, home)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var a types.Address
+		json.Unmarshal(rr.Body.Bytes(), &a)
+		if !a.IsDefaultShipping || !a.IsDefaultBilling {
+			t.Errorf("Expected the first address to be the default, got %+v", a)
+		}
+	})
+
+	t.Run("should move the default flag to a new default address", func(t *testing.T) {
+		office := home
+		office.Line1 = "2 Work St"
+		office.IsDefaultShipping = true
+
+		rr := send(http.MethodPost, "/me/addresses", 1, office)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		addresses, _ := store.GetAddressesByUserID(1)
+		for _, a := range addresses {
+			if a.IsDefaultShipping != (a.Line1 == "2 Work St") {
+				t.Errorf("Expected only the new address to be the default shipping address, got %+v", a)
+			}
+			if a.IsDefaultBilling != (a.Line1 == "1 Main St") {
+				t.Errorf("Expected the billing default to stay, got %+v", a)
+			}
+		}
+	})
+
+	t.Run("should hide other users' addresses", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			rr := send(method, "/me/addresses/1", 2, home)
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("%s: expected status code %d, got %d", method, http.StatusNotFound, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should update and delete an address", func(t *testing.T) {
+		updated := home
+		updated.Line2 = "Apt 4"
+
+		rr := send(http.MethodPut, "/me/addresses/1", 1, updated)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if a := store.addresses[1]; a.Line2 != "Apt 4" || !a.IsDefaultBilling {
+			t.Errorf("Expected the address to be updated and keep its default, got %+v", a)
+		}
+
+		rr = send(http.MethodDelete, "/me/addresses/1", 1, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if _, ok := store.addresses[1]; ok {
+			t.Error("Expected the address to be deleted")
+		}
+	})
+
+	t.Run("should apply the rules of the country", func(t *testing.T) {
+		tests := []struct {
+			payload types.AddressPayload
+			want    int
+		}{
+			{types.AddressPayload{Name: "Jane", Line1: "1 Main St", City: "Springfield", PostalCode: "62701", Country: "US"}, http.StatusBadRequest},
+			{types.AddressPayload{Name: "Jane", Line1: "1 Main St", City: "Springfield", Region: "IL", PostalCode: "6270", Country: "US"}, http.StatusBadRequest},
+			{types.AddressPayload{Name: "Jane", Line1: "10 Downing St", City: "London", PostalCode: "sw1a 2aa", Country: "GB"}, http.StatusCreated},
+			{types.AddressPayload{Name: "Jane", Line1: "1 Main St", City: "Dublin", Country: "IE"}, http.StatusCreated},
+			{types.AddressPayload{Name: "Jane", Line1: "1 Main St", City: "Nowhere", Country: "XX"}, http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			rr := send(http.MethodPost, "/me/addresses", 9, tt.payload)
+			if rr.Code != tt.want {
+				t.Errorf("%+v: expected status code %d, got %d", tt.payload, tt.want, rr.Code)
+			}
+		}
+	})
+}
+
+type mockTx struct{}
+
+func (mockTx) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (mockTx) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (mockTx) QueryRow(query string, args ...any) *sql.Row        { return nil }
+func (mockTx) Commit() error                                      { return nil }
+func (mockTx) Rollback() error                                    { return nil }
+
+type mockTransactor struct{}
+
+func (mockTransactor) BeginTx() (types.Tx, error) {
+	return mockTx{}, nil
+}
+
+type mockAddressStore struct {
+	addresses map[int]*types.Address
+	nextID    int
+}
+
+func (m *mockAddressStore) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	addresses := []types.Address{}
+	for _, a := range m.addresses {
+		if a.UserID == userID {
+			addresses = append(addresses, *a)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].ID < addresses[j].ID })
+	return addresses, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(id int) (*types.Address, error) {
+	a, ok := m.addresses[id]
+	if !ok {
+		return nil, fmt.Errorf("address not found")
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (m *mockAddressStore) CreateAddress(tx types.Tx, address types.Address) (int, error) {
+	m.nextID++
+	address.ID = m.nextID
+	m.addresses[address.ID] = &address
+	return address.ID, nil
+}
+
+func (m *mockAddressStore) UpdateAddress(tx types.Tx, address types.Address) error {
+	m.addresses[address.ID] = &address
+	return nil
+}
+
+func (m *mockAddressStore) DeleteAddress(id int) error {
+	delete(m.addresses, id)
+	return nil
+}
+
+func (m *mockAddressStore) ClearDefaultAddresses(tx types.Tx, userID int, shipping, billing bool) error {
+	for _, a := range m.addresses {
+		if a.UserID != userID {
+			continue
+		}
+		if shipping {
+			a.IsDefaultShipping = false
+		}
+		if billing {
+			a.IsDefaultBilling = false
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package address
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"backend/types"
+)
+
+// countryRule lists what an address needs beyond the fields every country
+// requires. Countries without a rule only get those common checks.
+type countryRule struct {
+	postalCode    *regexp.Regexp
+	requireRegion bool
+}
+
+var countryRules = map[string]countryRule{
+	"US": {postalCode: regexp.MustCompile(`^\d{5}(-\d{4})?$`), requireRegion: true},
+	"CA": {postalCode: regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`), requireRegion: true},
+	"AU": {postalCode: regexp.MustCompile(`^\d{4}$`), requireRegion: true},
+	"IN": {postalCode: regexp.MustCompile(`^\d{6}$`), requireRegion: true},
+	"GB": {postalCode: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`)},
+	"DE": {postalCode: regexp.MustCompile(`^\d{5}$`)},
+	"FR": {postalCode: regexp.MustCompile(`^\d{5}$`)},
+	"NL": {postalCode: regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`)},
+}
+
+// validateAddress applies the rules of the address's country.
+func validateAddress(a types.PostalAddress) error {
+	rule, ok := countryRules[a.Country]
+	if !ok {
+		return nil
+	}
+
+	if rule.requireRegion && a.Region == "" {
+		return fmt.Errorf("region is required for %s addresses", a.Country)
+	}
+
+	if rule.postalCode != nil && !rule.postalCode.MatchString(a.PostalCode) {
+		return fmt.Errorf("invalid postal code %q for %s", a.PostalCode, a.Country)
+	}
+
+	return nil
+}
+
+func addressFromPayload(payload types.AddressPayload) types.PostalAddress {
+	return types.PostalAddress{
+		Name:       strings.TrimSpace(payload.Name),
+		Line1:      strings.TrimSpace(payload.Line1),
+		Line2:      strings.TrimSpace(payload.Line2),
+		City:       strings.TrimSpace(payload.City),
+		Region:     strings.TrimSpace(payload.Region),
+		PostalCode: strings.ToUpper(strings.TrimSpace(payload.PostalCode)),
+		Country:    strings.ToUpper(payload.Country),
+		Phone:      strings.TrimSpace(payload.Phone),
+	}
+}
+
+// saveAddress creates or, when a.ID is set, updates an address. An address
+// flagged as a default takes the flag over from the user's other addresses,
+// and a user's first address becomes both defaults.
+func (h *Handler) saveAddress(a types.Address) (*types.Address, error) {
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if a.ID == 0 {
+		existing, err := h.store.GetAddressesByUserID(a.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			a.IsDefaultShipping = true
+			a.IsDefaultBilling = true
+		}
+	}
+
+	if err := h.store.ClearDefaultAddresses(tx, a.UserID, a.IsDefaultShipping, a.IsDefaultBilling); err != nil {
+		return nil, err
+	}
+
+	if a.ID == 0 {
+		a.ID, err = h.store.CreateAddress(tx, a)
+	} else {
+		err = h.store.UpdateAddress(tx, a)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
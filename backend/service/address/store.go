@@ -0,0 +1,124 @@
+package address
+
+import (
+	"database/sql"
+	"errors"
+
+	"backend/types"
+)
+
+var errAddressNotFound = errors.New("address not found")
+
+const addressColumns = "id, user_id, name, line1, line2, city, region, postal_code, country, phone, is_default_shipping, is_default_billing, created_at"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	rows, err := s.db.Query("SELECT "+addressColumns+" FROM addresses WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []types.Address{}
+	for rows.Next() {
+		a, err := scanRowsIntoAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+
+	return addresses, rows.Err()
+}
+
+func (s *Store) GetAddressByID(id int) (*types.Address, error) {
+	a, err := scanRowsIntoAddress(s.db.QueryRow("SELECT "+addressColumns+" FROM addresses WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, errAddressNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (s *Store) CreateAddress(tx types.Tx, a types.Address) (int, error) {
+	res, err := tx.Exec(
+		"INSERT INTO addresses (user_id, name, line1, line2, city, region, postal_code, country, phone, is_default_shipping, is_default_billing) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		a.UserID, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone, a.IsDefaultShipping, a.IsDefaultBilling,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) UpdateAddress(tx types.Tx, a types.Address) error {
+	_, err := tx.Exec(
+		"UPDATE addresses SET name = ?, line1 = ?, line2 = ?, city = ?, region = ?, postal_code = ?, country = ?, phone = ?, is_default_shipping = ?, is_default_billing = ? WHERE id = ?",
+		a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone, a.IsDefaultShipping, a.IsDefaultBilling, a.ID,
+	)
+	return err
+}
+
+func (s *Store) DeleteAddress(id int) error {
+	_, err := s.db.Exec("DELETE FROM addresses WHERE id = ?", id)
+	return err
+}
+
+// ClearDefaultAddresses unsets the chosen default flags on all of a user's
+// addresses, ahead of another address taking them over.
+func (s *Store) ClearDefaultAddresses(tx types.Tx, userID int, shipping, billing bool) error {
+	if shipping {
+		if _, err := tx.Exec("UPDATE addresses SET is_default_shipping = FALSE WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+	}
+
+	if billing {
+		if _, err := tx.Exec("UPDATE addresses SET is_default_billing = FALSE WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanRowsIntoAddress(rows interface{ Scan(dest ...any) error }) (*types.Address, error) {
+	a := new(types.Address)
+
+	err := rows.Scan(
+		&a.ID,
+		&a.UserID,
+		&a.Name,
+		&a.Line1,
+		&a.Line2,
+		&a.City,
+		&a.Region,
+		&a.PostalCode,
+		&a.Country,
+		&a.Phone,
+		&a.IsDefaultShipping,
+		&a.IsDefaultBilling,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
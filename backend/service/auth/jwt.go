@@ -17,6 +17,8 @@ import (
 type contextKey string
 
 const UserKey contextKey = "userID"
+const RoleKey contextKey = "role"
+const EmailVerifiedKey contextKey = "emailVerified"
 
 func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -36,7 +38,14 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.Handl
 		}
 
 		claims := token.Claims.(jwt.MapClaims)
-		str := claims["userID"].(string)
+		// jwt.Parse only checks exp when it is present, so tokens without
+		// it (as issued before access tokens became short lived) are refused.
+		if _, ok := claims["exp"]; !ok {
+			log.Println("token without expiry")
+			permissionDenied(w)
+			return
+		}
+		str, _ := claims["userID"].(string)
 
 		userID, err := strconv.Atoi(str)
 		if err != nil {
@@ -55,6 +64,8 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.Handl
 
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, UserKey, u.ID)
+		ctx = context.WithValue(ctx, RoleKey, u.Role)
+		ctx = context.WithValue(ctx, EmailVerifiedKey, u.EmailVerified)
 		r = r.WithContext(ctx)
 
 	
@@ -62,12 +73,56 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.Handl
 	}
 }
 
-func CreateJWT(secret []byte, userID int) (string, error) {
+// WithRole only lets users holding one of roles through. It relies on the
+// role that WithJWTAuth loaded from the database, so it must be wrapped by it;
+// the role claim in the token is informational only.
+func WithRole(handlerFunc http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role := GetRoleFromContext(r.Context())
+		for _, allowed := range roles {
+			if role == allowed {
+				handlerFunc(w, r)
+				return
+			}
+		}
+
+		log.Printf("user %d with role %q denied access to %s", GetUserIDFromContext(r.Context()), role, r.URL.Path)
+		permissionDenied(w)
+	}
+}
+
+// WithVerifiedEmail refuses users who have not verified their email address
+// when REQUIRE_VERIFIED_EMAIL is set. Like WithRole it must be wrapped by
+// WithJWTAuth.
+func WithVerifiedEmail(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		verified, _ := r.Context().Value(EmailVerifiedKey).(bool)
+		if config.Envs.RequireVerifiedEmail && !verified {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("email address not verified"))
+			return
+		}
+
+		handlerFunc(w, r)
+	}
+}
+
+// CreateJWT issues a short lived access token. Sessions are extended with
+// refresh tokens rather than long access token lifetimes.
+func CreateJWT(secret []byte, userID int, role string) (string, error) {
 	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
 
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID":    strconv.Itoa(int(userID)),
-		"expiresAt": time.Now().Add(expiration).Unix(),
+		"userID": strconv.Itoa(int(userID)),
+		"role":   role,
+		"jti":    jti,
+		"iat":    now.Unix(),
+		"exp":    now.Add(expiration).Unix(),
 	})
 
 	tokenString, err := token.SignedString(secret)
@@ -100,3 +155,12 @@ func GetUserIDFromContext(ctx context.Context) int {
 
 	return userID
 }
+
+func GetRoleFromContext(ctx context.Context) string {
+	role, ok := ctx.Value(RoleKey).(string)
+	if !ok {
+		return ""
+	}
+
+	return role
+}
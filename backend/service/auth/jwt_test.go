@@ -1,13 +1,19 @@
 package auth
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"backend/config"
+	"github.com/golang-jwt/jwt"
 )
 
 func TestCreateJWT(t *testing.T) {
 	secret := []byte("secret")
 
-	token, err := CreateJWT(secret, 1)
+	token, err := CreateJWT(secret, 1, "customer")
 	if err != nil {
 		t.Errorf("error creating JWT: %v", err)
 	}
@@ -15,4 +21,76 @@ func TestCreateJWT(t *testing.T) {
 	if token == "" {
 		t.Error("expected token to be not empty")
 	}
-}
\ No newline at end of file
+
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return secret, nil })
+	if err != nil {
+		t.Fatalf("error parsing JWT: %v", err)
+	}
+
+	claims := parsed.Claims.(jwt.MapClaims)
+	for _, claim := range []string{"exp", "iat", "jti", "userID", "role"} {
+		if _, ok := claims[claim]; !ok {
+			t.Errorf("expected claim %q to be set", claim)
+		}
+	}
+}
+
+func TestWithRole(t *testing.T) {
+	handler := WithRole(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, "staff", "admin")
+
+	tests := []struct {
+		role string
+		want int
+	}{
+		{"admin", http.StatusOK},
+		{"staff", http.StatusOK},
+		{"customer", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/products", nil)
+		req = req.WithContext(context.WithValue(req.Context(), RoleKey, tt.role))
+		rr := httptest.NewRecorder()
+
+		handler(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("role %q: expected status code %d, got %d", tt.role, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestWithVerifiedEmail(t *testing.T) {
+	handler := WithVerifiedEmail(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	defer func(required bool) { config.Envs.RequireVerifiedEmail = required }(config.Envs.RequireVerifiedEmail)
+
+	tests := []struct {
+		required bool
+		verified bool
+		want     int
+	}{
+		{false, false, http.StatusOK},
+		{true, true, http.StatusOK},
+		{true, false, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		config.Envs.RequireVerifiedEmail = tt.required
+
+		req := httptest.NewRequest(http.MethodPost, "/cart/checkout", nil)
+		req = req.WithContext(context.WithValue(req.Context(), EmailVerifiedKey, tt.verified))
+		rr := httptest.NewRecorder()
+
+		handler(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("required %v, verified %v: expected status code %d, got %d", tt.required, tt.verified, tt.want, rr.Code)
+		}
+	}
+}
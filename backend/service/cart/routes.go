@@ -1,22 +1,37 @@
 package cart
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 	"backend/service/auth"
+	"backend/service/currency"
+	"backend/service/idempotency"
+	"backend/service/inventory"
+	"backend/service/promotion"
 	"backend/types"
 	"backend/utils"
 )
 
 type Handler struct {
-	store      types.ProductStore
-	orderStore types.OrderStore
-	userStore  types.UserStore
-	cartStore  types.CartStore
+	store            types.ProductStore
+	orderStore       types.OrderStore
+	userStore        types.UserStore
+	cartStore        types.CartStore
+	addressStore     types.AddressStore
+	payments         types.PaymentService
+	promotions       types.PromotionService
+	taxes            types.TaxCalculator
+	shipping         types.ShippingRateProvider
+	inventory        types.InventoryService
+	transactor       types.Transactor
+	currencies       types.CurrencyService
+	idempotencyStore types.IdempotencyStore
 }
 
 func NewHandler(
@@ -24,19 +39,41 @@ func NewHandler(
 	orderStore types.OrderStore,
 	userStore types.UserStore,
 	cartStore types.CartStore,
+	addressStore types.AddressStore,
+	payments types.PaymentService,
+	promotions types.PromotionService,
+	taxes types.TaxCalculator,
+	shipping types.ShippingRateProvider,
+	inventory types.InventoryService,
+	transactor types.Transactor,
+	currencies types.CurrencyService,
+	idempotencyStore types.IdempotencyStore,
 ) *Handler {
 	return &Handler{
-		store:      store,
-		orderStore: orderStore,
-		userStore:  userStore,
-		cartStore:  cartStore,
+		store:            store,
+		orderStore:       orderStore,
+		userStore:        userStore,
+		cartStore:        cartStore,
+		addressStore:     addressStore,
+		payments:         payments,
+		promotions:       promotions,
+		taxes:            taxes,
+		shipping:         shipping,
+		inventory:        inventory,
+		transactor:       transactor,
+		currencies:       currencies,
+		idempotencyStore: idempotencyStore,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/checkout", auth.WithJWTAuth(h.handleCheckout, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/checkout", auth.WithJWTAuth(auth.WithVerifiedEmail(idempotency.WithIdempotencyKey(h.handleCheckout, h.idempotencyStore)), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/cart/checkout", auth.WithJWTAuth(auth.WithVerifiedEmail(idempotency.WithIdempotencyKey(h.handleCartCheckout, h.idempotencyStore)), h.userStore)).Methods(http.MethodPost)
 	router.HandleFunc("/cart", auth.WithJWTAuth(h.handleGetCart, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/cart/shipping-options", auth.WithJWTAuth(h.handleGetShippingOptions, h.userStore)).Methods(http.MethodGet)
 	router.HandleFunc("/cart", auth.WithJWTAuth(h.handleAddToCart, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/cart/coupon", auth.WithJWTAuth(h.handleApplyCoupon, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/cart/coupon", auth.WithJWTAuth(h.handleRemoveCoupon, h.userStore)).Methods(http.MethodDelete)
 	router.HandleFunc("/cart/{id}", auth.WithJWTAuth(h.handleRemoveFromCart, h.userStore)).Methods(http.MethodDelete)
 	router.HandleFunc("/cart", auth.WithJWTAuth(h.handleClearCart, h.userStore)).Methods(http.MethodDelete)
 }
@@ -44,6 +81,12 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 
+	cur, err := currency.FromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	var cart types.CartCheckoutPayload
 	if err := utils.ParseJSON(r, &cart); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
@@ -62,36 +105,261 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	address, err := h.shippingAddress(userID, cart.AddressID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	products, err := h.store.GetProductsById(productIds)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	orderID, totalPrice, err := h.createOrder(products, cart.Items, userID)
+	if err := h.localize(cur, products); err != nil {
+		utils.WriteError(w, currency.ErrorStatus(err), err)
+		return
+	}
+
+	orderID, pricing, err := h.createOrder(products, cart.Items, userID, *address, cart.Coupon, cur, cart.ShippingMethodID)
+	if err != nil {
+		utils.WriteError(w, checkoutStatus(err), err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"total_price": pricing.Total,
+		"currency":    cur,
+		"pricing":     pricing,
+		"order_id":    orderID,
+		"payment":     h.startPayment(orderID, userID, pricing.Total),
+	})
+}
+
+// checkoutStatus is the HTTP status for err from placing an order. Only
+// errors about the order itself are the client's. Any other, such as a
+// deadlock or a lost connection, may not happen again, so it is reported as
+// the server's and is not replayed for the request's idempotency key.
+func checkoutStatus(err error) int {
+	switch {
+	case errors.Is(err, errCannotOrder),
+		errors.Is(err, errShippingMethodRequired),
+		errors.Is(err, promotion.ErrInvalidCoupon),
+		errors.Is(err, inventory.ErrInsufficientStock):
+		return http.StatusBadRequest
+	}
+	return currency.ErrorStatus(err)
+}
+
+func (h *Handler) handleCartCheckout(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	cur, err := currency.FromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// The body is optional; without an address_id the default shipping
+	// address is used.
+	var payload types.CheckoutAddressPayload
+	if err := utils.ParseJSON(r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	address, err := h.shippingAddress(userID, payload.AddressID)
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
+	orderID, pricing, err := h.checkoutCart(userID, *address, cur, payload.ShippingMethodID)
+	if err != nil {
+		utils.WriteError(w, checkoutStatus(err), err)
+		return
+	}
+
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"total_price": totalPrice,
+		"total_price": pricing.Total,
+		"currency":    cur,
+		"pricing":     pricing,
 		"order_id":    orderID,
+		"payment":     h.startPayment(orderID, userID, pricing.Total),
 	})
 }
 
 func (h *Handler) handleGetCart(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
+
+	cur, err := currency.FromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Tax is estimated for the address_id query parameter or else the
+	// default shipping address, if there is one.
+	addressID, err := parseAddressID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	address, err := h.estimateAddress(userID, addressID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	cart, err := h.cartStore.GetCartByUserID(userID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+
+	pricing, couponErr, err := h.cartPricing(userID, cart, cur, address)
+	if err != nil {
+		utils.WriteError(w, currency.ErrorStatus(err), err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"cart":     cart.Items,
+		"coupon":   cart.CouponCode,
+		"currency": cur,
+		"pricing":  pricing,
+	}
+	if couponErr != nil {
+		response["coupon_error"] = couponErr.Error()
+	}
+	if pricing.Tax != nil {
+		response["estimated_tax"] = pricing.Tax.Total
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) handleGetShippingOptions(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	cur, err := currency.FromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	addressID, err := parseAddressID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	address, err := h.shippingAddress(userID, addressID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cart, err := h.cartStore.GetCartByUserID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(cart.Items) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("cart is empty"))
+		return
+	}
+
+	options, err := h.cartShippingOptions(userID, cart, cur, *address)
+	if err != nil {
+		utils.WriteError(w, currency.ErrorStatus(err), err)
+		return
+	}
+
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"cart": cart.Items,
+		"currency": cur,
+		"options":  options,
 	})
 }
 
+// parseAddressID reads the optional address_id query parameter, which is
+// zero when it is missing.
+func parseAddressID(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("address_id")
+	if s == "" {
+		return 0, nil
+	}
+
+	addressID, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address ID")
+	}
+	return addressID, nil
+}
+
+func (h *Handler) handleApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	cur, err := currency.FromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.CouponPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	cart, err := h.cartStore.GetCartByUserID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	cart.CouponCode = payload.Code
+	pricing, couponErr, err := h.cartPricing(userID, cart, cur, nil)
+	if err != nil {
+		utils.WriteError(w, currency.ErrorStatus(err), err)
+		return
+	}
+	if couponErr != nil {
+		utils.WriteError(w, http.StatusBadRequest, couponErr)
+		return
+	}
+
+	// The code is saved as the promotion spells it.
+	code := pricing.Discounts[0].Code
+	if err := h.cartStore.SetCartCoupon(userID, code); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"coupon":   code,
+		"currency": cur,
+		"pricing":  pricing,
+	})
+}
+
+func (h *Handler) handleRemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	if err := h.cartStore.SetCartCoupon(userID, ""); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Coupon removed"})
+}
+
 func (h *Handler) handleAddToCart(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 	var item struct {
@@ -105,7 +373,19 @@ func (h *Handler) handleAddToCart(w http.ResponseWriter, r *http.Request) {
 	if item.Quantity <= 0 {
 		item.Quantity = 1
 	}
+	if item.Quantity > types.MaxItemQuantity {
+		utils.WriteError(w, http.StatusBadRequest, errTooManyUnits)
+		return
+	}
+	if _, err := h.store.GetProductById(item.ProductID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
 	err := h.cartStore.AddToCart(userID, item.ProductID, item.Quantity)
+	if errors.Is(err, errTooManyUnits) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -0,0 +1,1125 @@
+package cart
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"backend/service/auth"
+	"backend/service/currency"
+	"backend/service/inventory"
+	"backend/service/promotion"
+	"backend/service/shipping"
+	"backend/service/tax"
+	"backend/types"
+)
+
+func TestCheckoutConcurrency(t *testing.T) {
+	const stock = 10
+	const buyers = 50
+
+	productStore := &mockProductStore{products: map[int]*types.Product{
+		1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("9.99"), Quantity: stock},
+	}}
+	orderStore := &mockOrderStore{}
+	handler := NewHandler(productStore, orderStore, nil, nil, newMockAddressStore(buyers), &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	statuses := map[int]int{}
+
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func(userID int) {
+			defer wg.Done()
+
+			payload := types.CartCheckoutPayload{Items: []types.CartCheckoutItem{{ProductID: 1, Quantity: 1}}}
+			marshalled, _ := json.Marshal(payload)
+			req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewBuffer(marshalled))
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+			rr := httptest.NewRecorder()
+
+			handler.handleCheckout(rr, req)
+
+			mu.Lock()
+			statuses[rr.Code]++
+			mu.Unlock()
+		}(i + 1)
+	}
+	wg.Wait()
+
+	if statuses[http.StatusOK] != stock {
+		t.Errorf("Expected %d successful checkouts, got %d", stock, statuses[http.StatusOK])
+	}
+	if statuses[http.StatusBadRequest] != buyers-stock {
+		t.Errorf("Expected %d rejected checkouts, got %d", buyers-stock, statuses[http.StatusBadRequest])
+	}
+	if r := productStore.reserved[1]; r != stock {
+		t.Errorf("Expected all %d units reserved, got %d", stock, r)
+	}
+	if len(orderStore.orders) != stock {
+		t.Errorf("Expected %d orders, got %d", stock, len(orderStore.orders))
+	}
+}
+
+func TestCheckoutRollsBackOnFailure(t *testing.T) {
+	productStore := &mockProductStore{products: map[int]*types.Product{
+		1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("5"), Quantity: 3},
+		2: {ID: 2, Name: "Gadget", Price: types.MustParseMoney("7"), Quantity: 3},
+	}}
+	orderStore := &mockOrderStore{failItems: true}
+	handler := NewHandler(productStore, orderStore, nil, nil, newMockAddressStore(1), &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+	payload := types.CartCheckoutPayload{Items: []types.CartCheckoutItem{
+		{ProductID: 1, Quantity: 2},
+		{ProductID: 2, Quantity: 1},
+	}}
+	marshalled, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewBuffer(marshalled))
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+	rr := httptest.NewRecorder()
+
+	handler.handleCheckout(rr, req)
+
+	// A failure of the store is not the client's, so that it may retry.
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if q := productStore.products[1].Quantity; q != 3 {
+		t.Errorf("Expected stock of product 1 to be restored to 3, got %d", q)
+	}
+	if q := productStore.products[2].Quantity; q != 3 {
+		t.Errorf("Expected stock of product 2 to be restored to 3, got %d", q)
+	}
+	if productStore.reserved[1] != 0 || productStore.reserved[2] != 0 {
+		t.Errorf("Expected reservations to be rolled back, got %v", productStore.reserved)
+	}
+	if len(orderStore.orders) != 0 {
+		t.Errorf("Expected no committed orders, got %d", len(orderStore.orders))
+	}
+}
+
+func TestCartCheckout(t *testing.T) {
+	serve := func(handler *Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/cart/checkout", nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handler.handleCartCheckout(rr, req)
+		return rr
+	}
+
+	t.Run("should order the persisted cart at live prices and clear it", func(t *testing.T) {
+		productStore := &mockProductStore{products: map[int]*types.Product{
+			1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("12"), Quantity: 5},
+		}}
+		orderStore := &mockOrderStore{}
+		cartStore := &mockCartStore{cart: &types.Cart{ID: 3, UserID: 1, Items: []types.CartItem{
+			{ProductID: 1, Price: types.MustParseMoney("10"), Quantity: 2},
+		}}}
+		handler := NewHandler(productStore, orderStore, nil, cartStore, newMockAddressStore(1), &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+		rr := serve(handler)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if len(orderStore.orders) != 1 || orderStore.orders[0].Total != types.MustParseMoney("24") {
+			t.Errorf("Expected one order totalling 24, got %+v", orderStore.orders)
+		}
+		if len(cartStore.cart.Items) != 0 {
+			t.Errorf("Expected cart to be cleared, got %+v", cartStore.cart.Items)
+		}
+
+		var body struct {
+			Payment *types.PaymentSession `json:"payment"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if body.Payment == nil || body.Payment.Amount != types.MustParseMoney("24") {
+			t.Errorf("Expected a payment session for 24, got %+v", body.Payment)
+		}
+		// Stock stays on hand, held for the order, until it is paid.
+		if q, r := productStore.products[1].Quantity, productStore.reserved[1]; q != 5 || r != 2 {
+			t.Errorf("Expected 2 of 5 units on hand reserved, got %d of %d", r, q)
+		}
+	})
+
+	t.Run("should keep the cart when stock is insufficient", func(t *testing.T) {
+		productStore := &mockProductStore{products: map[int]*types.Product{
+			1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("12"), Quantity: 1},
+		}}
+		orderStore := &mockOrderStore{}
+		cartStore := &mockCartStore{cart: &types.Cart{ID: 3, UserID: 1, Items: []types.CartItem{
+			{ProductID: 1, Price: types.MustParseMoney("12"), Quantity: 2},
+		}}}
+		handler := NewHandler(productStore, orderStore, nil, cartStore, newMockAddressStore(1), &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+		rr := serve(handler)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if len(cartStore.cart.Items) != 1 {
+			t.Errorf("Expected cart to be kept, got %+v", cartStore.cart.Items)
+		}
+		if len(orderStore.orders) != 0 {
+			t.Errorf("Expected no orders, got %d", len(orderStore.orders))
+		}
+	})
+
+	t.Run("should reject more units than an order may hold", func(t *testing.T) {
+		productStore := &mockProductStore{products: map[int]*types.Product{
+			1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("12"), Quantity: 1000},
+		}}
+		orderStore := &mockOrderStore{}
+		cartStore := &mockCartStore{cart: &types.Cart{ID: 3, UserID: 1, Items: []types.CartItem{
+			{ProductID: 1, Price: types.MustParseMoney("12"), Quantity: types.MaxItemQuantity + 1},
+		}}}
+		handler := NewHandler(productStore, orderStore, nil, cartStore, newMockAddressStore(1), &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+		rr := serve(handler)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if len(orderStore.orders) != 0 {
+			t.Errorf("Expected no orders, got %d", len(orderStore.orders))
+		}
+	})
+
+	t.Run("should reject an empty cart", func(t *testing.T) {
+		cartStore := &mockCartStore{cart: &types.Cart{UserID: 1, Items: []types.CartItem{}}}
+		handler := NewHandler(&mockProductStore{}, &mockOrderStore{}, nil, cartStore, newMockAddressStore(1), &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(&mockProductStore{}), mockTransactor{}, newCurrencies(), nil)
+
+		rr := serve(handler)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestCheckoutRejectsEmptyItems(t *testing.T) {
+	handler := NewHandler(&mockProductStore{}, &mockOrderStore{}, nil, nil, newMockAddressStore(1), &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(&mockProductStore{}), mockTransactor{}, newCurrencies(), nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewBufferString(`{"items":[]}`))
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+	rr := httptest.NewRecorder()
+	handler.handleCheckout(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestAddToCart(t *testing.T) {
+	t.Run("should reject more units than a cart may hold", func(t *testing.T) {
+		productStore := &mockProductStore{products: map[int]*types.Product{
+			1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("12"), Quantity: 5},
+		}}
+		handler := NewHandler(productStore, &mockOrderStore{}, nil, &mockCartStore{}, newMockAddressStore(1), &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+		body := fmt.Sprintf(`{"id":1,"quantity":%d}`, types.MaxItemQuantity+1)
+		req := httptest.NewRequest(http.MethodPost, "/cart/items", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handler.handleAddToCart(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestCheckoutShippingAddress(t *testing.T) {
+	checkout := func(handler *Handler, addressID int) *httptest.ResponseRecorder {
+		payload := types.CartCheckoutPayload{
+			Items:     []types.CartCheckoutItem{{ProductID: 1, Quantity: 1}},
+			AddressID: addressID,
+		}
+		marshalled, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewBuffer(marshalled))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handler.handleCheckout(rr, req)
+		return rr
+	}
+
+	newHandler := func(addressStore *mockAddressStore) (*Handler, *mockOrderStore) {
+		productStore := &mockProductStore{products: map[int]*types.Product{
+			1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("5"), Quantity: 10},
+		}}
+		orderStore := &mockOrderStore{}
+		return NewHandler(productStore, orderStore, nil, nil, addressStore, &mockPaymentService{}, newPromotions(), newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil), orderStore
+	}
+
+	t.Run("should ship to the default address", func(t *testing.T) {
+		handler, orderStore := newHandler(newMockAddressStore(2))
+
+		rr := checkout(handler, 0)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if got := orderStore.orders[0].ShippingAddress.Name; got != "Customer 1" {
+			t.Errorf("Expected the order to ship to Customer 1, got %q", got)
+		}
+	})
+
+	t.Run("should snapshot the chosen address", func(t *testing.T) {
+		addressStore := newMockAddressStore(1)
+		addressStore.addresses[5] = types.Address{ID: 5, UserID: 1, PostalAddress: types.PostalAddress{Name: "Office", Line1: "1 Work St", City: "Springfield", Country: "US"}}
+		handler, orderStore := newHandler(addressStore)
+
+		rr := checkout(handler, 5)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		addressStore.addresses[5] = types.Address{ID: 5, UserID: 1, PostalAddress: types.PostalAddress{Name: "Moved"}}
+		if got := orderStore.orders[0].ShippingAddress; got.Name != "Office" || got.Line1 != "1 Work St" {
+			t.Errorf("Expected the order to keep the address it was placed with, got %+v", got)
+		}
+	})
+
+	t.Run("should reject another user's address", func(t *testing.T) {
+		handler, orderStore := newHandler(newMockAddressStore(2))
+
+		rr := checkout(handler, 2)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if len(orderStore.orders) != 0 {
+			t.Errorf("Expected no orders, got %d", len(orderStore.orders))
+		}
+	})
+
+	t.Run("should require an address", func(t *testing.T) {
+		handler, _ := newHandler(newMockAddressStore(0))
+
+		rr := checkout(handler, 0)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestCartCoupon(t *testing.T) {
+	productStore := &mockProductStore{products: map[int]*types.Product{
+		1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("20"), Quantity: 10},
+		2: {ID: 2, Name: "Gadget", Price: types.MustParseMoney("5"), Quantity: 10},
+	}}
+	orderStore := &mockOrderStore{}
+	cartStore := &mockCartStore{cart: &types.Cart{ID: 3, UserID: 1, Items: []types.CartItem{
+		{ProductID: 1, Quantity: 2},
+		{ProductID: 2, Quantity: 1},
+	}}}
+	promotions := newPromotions(
+		types.Promotion{ID: 1, Code: "TENOFF", Description: "10% off", Type: types.PromotionPercentage, Value: 10, MaxUsesPerUser: 1, Active: true},
+		types.Promotion{ID: 2, Code: "BIGSPEND", Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), MinSpend: types.MustParseMoney("100"), Active: true},
+	)
+	handler := NewHandler(productStore, orderStore, nil, cartStore, newMockAddressStore(1), &mockPaymentService{}, promotions, newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+	send := func(method string, payload any, handle http.HandlerFunc) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		if payload != nil {
+			json.NewEncoder(&body).Encode(payload)
+		}
+		req := httptest.NewRequest(method, "/cart", &body)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	pricing := func(rr *httptest.ResponseRecorder) types.PriceBreakdown {
+		var body struct {
+			Pricing types.PriceBreakdown `json:"pricing"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return body.Pricing
+	}
+
+	t.Run("should reject an unknown code", func(t *testing.T) {
+		rr := send(http.MethodPost, types.CouponPayload{Code: "NOPE"}, handler.handleApplyCoupon)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject a coupon below its minimum spend", func(t *testing.T) {
+		rr := send(http.MethodPost, types.CouponPayload{Code: "BIGSPEND"}, handler.handleApplyCoupon)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if cartStore.cart.CouponCode != "" {
+			t.Errorf("Expected no coupon on the cart, got %q", cartStore.cart.CouponCode)
+		}
+	})
+
+	t.Run("should apply a coupon to the cart", func(t *testing.T) {
+		rr := send(http.MethodPost, types.CouponPayload{Code: "tenoff"}, handler.handleApplyCoupon)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if cartStore.cart.CouponCode != "TENOFF" {
+			t.Errorf("Expected coupon TENOFF on the cart, got %q", cartStore.cart.CouponCode)
+		}
+
+		rr = send(http.MethodGet, nil, handler.handleGetCart)
+		if p := pricing(rr); p.Subtotal != types.MustParseMoney("45") || p.DiscountTotal != types.MustParseMoney("4.5") || p.Total != types.MustParseMoney("40.5") {
+			t.Errorf("Expected 45 less 4.50, got %+v", p)
+		}
+	})
+
+	t.Run("should record the discount on the order", func(t *testing.T) {
+		rr := send(http.MethodPost, nil, handler.handleCartCheckout)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		if o := orderStore.orders[0]; o.Subtotal != types.MustParseMoney("45") || o.DiscountTotal != types.MustParseMoney("4.5") || o.Total != types.MustParseMoney("40.5") {
+			t.Errorf("Expected an order of 45 less 4.50, got %+v", o)
+		}
+		if len(orderStore.discounts) != 1 || orderStore.discounts[0].Code != "TENOFF" {
+			t.Errorf("Expected the TENOFF discount on the order, got %+v", orderStore.discounts)
+		}
+		if cartStore.cart.CouponCode != "" {
+			t.Errorf("Expected the coupon to be removed from the cart, got %q", cartStore.cart.CouponCode)
+		}
+	})
+
+	t.Run("should report a coupon the user has used up", func(t *testing.T) {
+		cartStore.cart.Items = []types.CartItem{{ProductID: 2, Quantity: 1}}
+		cartStore.cart.CouponCode = "TENOFF"
+
+		rr := send(http.MethodGet, nil, handler.handleGetCart)
+
+		var body struct {
+			Pricing     types.PriceBreakdown `json:"pricing"`
+			CouponError string               `json:"coupon_error"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if body.CouponError == "" || body.Pricing.Total != types.MustParseMoney("5") {
+			t.Errorf("Expected the full price and a coupon error, got %+v", body)
+		}
+
+		rr = send(http.MethodPost, nil, handler.handleCartCheckout)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestCheckoutCurrency(t *testing.T) {
+	productStore := &mockProductStore{products: map[int]*types.Product{
+		1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("20"), Quantity: 10},
+		2: {ID: 2, Name: "Gadget", Price: types.MustParseMoney("5"), Quantity: 10},
+	}}
+	orderStore := &mockOrderStore{}
+	cartStore := &mockCartStore{cart: &types.Cart{ID: 3, UserID: 1, CouponCode: "FIVEOFF", Items: []types.CartItem{
+		{ProductID: 1, Quantity: 2},
+		{ProductID: 2, Quantity: 1},
+	}}}
+	promotions := newPromotions(types.Promotion{ID: 1, Code: "FIVEOFF", Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), Active: true})
+	handler := NewHandler(productStore, orderStore, nil, cartStore, newMockAddressStore(1), &mockPaymentService{}, promotions, newTaxes(), newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+	send := func(method, path string, handle http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	t.Run("should reject a currency the store does not sell in", func(t *testing.T) {
+		rr := send(http.MethodGet, "/cart?currency=XYZ", handler.handleGetCart)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should price the cart in the requested currency", func(t *testing.T) {
+		rr := send(http.MethodGet, "/cart?currency=eur", handler.handleGetCart)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var body struct {
+			Cart     []types.CartItem     `json:"cart"`
+			Currency string               `json:"currency"`
+			Pricing  types.PriceBreakdown `json:"pricing"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+
+		// Two widgets converted at 0.5 and a gadget at its euro list price,
+		// less the 5 dollar coupon converted to euros.
+		if body.Currency != "EUR" || body.Cart[0].Price != types.MustParseMoney("10") || body.Cart[1].Price != types.MustParseMoney("3") {
+			t.Errorf("Expected the items at 10.00 and 3.00 EUR, got %s %+v", body.Currency, body.Cart)
+		}
+		if p := body.Pricing; p.Subtotal != types.MustParseMoney("23") || p.DiscountTotal != types.MustParseMoney("2.5") || p.Total != types.MustParseMoney("20.5") {
+			t.Errorf("Expected 23.00 less 2.50, got %+v", p)
+		}
+	})
+
+	t.Run("should charge the order in the requested currency", func(t *testing.T) {
+		rr := send(http.MethodPost, "/cart/checkout?currency=eur", handler.handleCartCheckout)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		o := orderStore.orders[0]
+		if o.Currency != "EUR" || o.ExchangeRate != 0.5 || o.Total != types.NewMoney(2050, "EUR") {
+			t.Errorf("Expected an order of 20.50 EUR at 0.5, got %+v", o)
+		}
+		if orderStore.items[0].Price != types.NewMoney(1000, "EUR") {
+			t.Errorf("Expected the widget at 10.00 EUR, got %+v", orderStore.items[0])
+		}
+	})
+}
+
+func TestCheckoutTax(t *testing.T) {
+	productStore := &mockProductStore{products: map[int]*types.Product{
+		1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("20"), Quantity: 10},
+		2: {ID: 2, Name: "Book", Price: types.MustParseMoney("5"), Quantity: 10, CategoryID: 5},
+	}}
+	orderStore := &mockOrderStore{}
+	cartStore := &mockCartStore{cart: &types.Cart{ID: 3, UserID: 1, CouponCode: "FIVEOFF", Items: []types.CartItem{
+		{ProductID: 1, Quantity: 2},
+		{ProductID: 2, Quantity: 1},
+	}}}
+	addressStore := newMockAddressStore(1)
+	address := addressStore.addresses[1]
+	address.Region = "CA"
+	addressStore.addresses[1] = address
+
+	promotions := newPromotions(types.Promotion{ID: 1, Code: "FIVEOFF", Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), Active: true})
+	taxes := newTaxes(
+		types.TaxRate{ID: 1, Name: "CA sales tax", Country: "US", Region: "CA", TaxClass: types.TaxClassStandard, Rate: 7.25},
+		types.TaxRate{ID: 2, Name: "Reduced rate", Country: "US", TaxClass: "reduced", Rate: 2},
+		types.TaxRate{ID: 3, Name: "NY sales tax", Country: "US", Region: "NY", TaxClass: types.TaxClassStandard, Rate: 4},
+	)
+	handler := NewHandler(productStore, orderStore, nil, cartStore, addressStore, &mockPaymentService{}, promotions, taxes, newShipping(), newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+	send := func(method string, userID int, handle http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/cart", nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	type cartBody struct {
+		Pricing      types.PriceBreakdown `json:"pricing"`
+		EstimatedTax *types.Money         `json:"estimated_tax"`
+	}
+
+	// The 5.00 coupon comes off the 40.00 of widgets and the 5.00 book in
+	// proportion, leaving 35.56 taxed at 7.25% and 4.44 at the reduced 2%.
+	t.Run("should estimate the tax for the default address", func(t *testing.T) {
+		rr := send(http.MethodGet, 1, handler.handleGetCart)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var body cartBody
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if body.EstimatedTax == nil || *body.EstimatedTax != types.MustParseMoney("2.67") {
+			t.Errorf("Expected an estimated tax of 2.67, got %v", body.EstimatedTax)
+		}
+		if body.Pricing.Total != types.MustParseMoney("42.67") {
+			t.Errorf("Expected a total of 42.67, got %s", body.Pricing.Total)
+		}
+	})
+
+	t.Run("should not estimate the tax without an address", func(t *testing.T) {
+		rr := send(http.MethodGet, 2, handler.handleGetCart)
+
+		var body cartBody
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if body.EstimatedTax != nil || body.Pricing.Total != types.MustParseMoney("40") {
+			t.Errorf("Expected 40.00 without tax, got %+v", body)
+		}
+	})
+
+	t.Run("should record the tax on the order and its items", func(t *testing.T) {
+		rr := send(http.MethodPost, 1, handler.handleCartCheckout)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		if o := orderStore.orders[0]; o.TaxTotal != types.MustParseMoney("2.67") || o.Total != types.MustParseMoney("42.67") {
+			t.Errorf("Expected 2.67 of tax in a total of 42.67, got %+v", o)
+		}
+		if orderStore.items[0].Tax != types.MustParseMoney("2.58") || orderStore.items[1].Tax != types.MustParseMoney("0.09") {
+			t.Errorf("Expected item taxes of 2.58 and 0.09, got %+v", orderStore.items)
+		}
+		if len(orderStore.taxes) != 2 || orderStore.taxes[0].Name != "CA sales tax" || orderStore.taxes[1].Amount != types.MustParseMoney("0.09") {
+			t.Errorf("Expected the CA and reduced rate tax lines, got %+v", orderStore.taxes)
+		}
+	})
+}
+
+func TestCheckoutShipping(t *testing.T) {
+	productStore := &mockProductStore{products: map[int]*types.Product{
+		1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("20"), Quantity: 10, Weight: 500},
+	}}
+	orderStore := &mockOrderStore{}
+	cartStore := &mockCartStore{cart: &types.Cart{ID: 3, UserID: 1, Items: []types.CartItem{
+		{ProductID: 1, Quantity: 2},
+	}}}
+	shippingRates := newShipping(
+		types.ShippingMethod{ID: 1, Name: "Standard", Type: types.ShippingFlatRate, Rate: types.MustParseMoney("4.99"), Countries: []string{"US"}, Active: true},
+		types.ShippingMethod{ID: 2, Name: "By weight", Type: types.ShippingWeightBased, Active: true, Tiers: []types.ShippingTier{
+			{MaxWeight: 1000, Rate: types.MustParseMoney("3")},
+			{MaxWeight: 5000, Rate: types.MustParseMoney("6")},
+		}},
+		types.ShippingMethod{ID: 3, Name: "Free over 50", Type: types.ShippingFreeOver, Rate: types.MustParseMoney("7"), FreeOver: types.MustParseMoney("50"), Active: true},
+		types.ShippingMethod{ID: 4, Name: "Pickup", Type: types.ShippingPickup, Active: true},
+		types.ShippingMethod{ID: 5, Name: "Royal Mail", Type: types.ShippingFlatRate, Rate: types.MustParseMoney("1"), Countries: []string{"GB"}, Active: true},
+		types.ShippingMethod{ID: 6, Name: "Retired", Type: types.ShippingFlatRate, Rate: types.MustParseMoney("1")},
+	)
+	handler := NewHandler(productStore, orderStore, nil, cartStore, newMockAddressStore(1), &mockPaymentService{}, newPromotions(), newTaxes(), shippingRates, newInventory(productStore), mockTransactor{}, newCurrencies(), nil)
+
+	send := func(method, path string, payload any, handle http.HandlerFunc) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		if payload != nil {
+			json.NewEncoder(&body).Encode(payload)
+		}
+		req := httptest.NewRequest(method, path, &body)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	options := func(rr *httptest.ResponseRecorder) []types.ShippingOption {
+		var body struct {
+			Options []types.ShippingOption `json:"options"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return body.Options
+	}
+
+	t.Run("should quote the methods that ship to the address, cheapest first", func(t *testing.T) {
+		rr := send(http.MethodGet, "/cart/shipping-options", nil, handler.handleGetShippingOptions)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		// Two 500g widgets make the first weight tier and 40.00 is short of
+		// free shipping.
+		got := options(rr)
+		want := []types.ShippingOption{
+			{MethodID: 4, Name: "Pickup", Type: types.ShippingPickup, Cost: types.MustParseMoney("0")},
+			{MethodID: 2, Name: "By weight", Type: types.ShippingWeightBased, Cost: types.MustParseMoney("3")},
+			{MethodID: 1, Name: "Standard", Type: types.ShippingFlatRate, Cost: types.MustParseMoney("4.99")},
+			{MethodID: 3, Name: "Free over 50", Type: types.ShippingFreeOver, Cost: types.MustParseMoney("7")},
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("should quote in the requested currency", func(t *testing.T) {
+		rr := send(http.MethodGet, "/cart/shipping-options?currency=eur", nil, handler.handleGetShippingOptions)
+		got := options(rr)
+		if len(got) != 4 || got[2].Cost.String() != "2.50" {
+			t.Errorf("Expected standard shipping at 2.50 EUR, got %v", got)
+		}
+	})
+
+	t.Run("should require a method when there is a choice", func(t *testing.T) {
+		rr := send(http.MethodPost, "/cart/checkout", nil, handler.handleCartCheckout)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject a method that does not ship to the address", func(t *testing.T) {
+		rr := send(http.MethodPost, "/cart/checkout", types.CheckoutAddressPayload{ShippingMethodID: 5}, handler.handleCartCheckout)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should charge for the chosen method", func(t *testing.T) {
+		rr := send(http.MethodPost, "/cart/checkout", types.CheckoutAddressPayload{ShippingMethodID: 1}, handler.handleCartCheckout)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		o := orderStore.orders[0]
+		if o.ShippingMethodID != 1 || o.ShippingMethod != "Standard" || o.ShippingTotal != types.MustParseMoney("4.99") || o.Total != types.MustParseMoney("44.99") {
+			t.Errorf("Expected 4.99 of standard shipping in a total of 44.99, got %+v", o)
+		}
+	})
+}
+
+// mockTx records the effects of a transaction so they can be applied on
+// commit or undone on rollback.
+type mockTx struct {
+	onCommit   []func()
+	onRollback []func()
+	done       bool
+}
+
+func (tx *mockTx) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (tx *mockTx) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (tx *mockTx) QueryRow(query string, args ...any) *sql.Row        { return nil }
+
+func (tx *mockTx) Commit() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	for _, f := range tx.onCommit {
+		f()
+	}
+	return nil
+}
+
+func (tx *mockTx) Rollback() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	for i := len(tx.onRollback) - 1; i >= 0; i-- {
+		tx.onRollback[i]()
+	}
+	return nil
+}
+
+type mockTransactor struct{}
+
+func (mockTransactor) BeginTx() (types.Tx, error) {
+	return &mockTx{}, nil
+}
+
+type mockProductStore struct {
+	mu       sync.Mutex
+	products map[int]*types.Product
+	reserved map[int]int
+}
+
+func (m *mockProductStore) GetProductById(id int) (*types.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.products[id]
+	if !ok {
+		return nil, fmt.Errorf("product not found")
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (m *mockProductStore) GetProductsById(ids []int) ([]types.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	products := []types.Product{}
+	for _, id := range ids {
+		if p, ok := m.products[id]; ok {
+			products = append(products, *p)
+		}
+	}
+	return products, nil
+}
+
+func (m *mockProductStore) ListProducts(filter types.ProductFilter) ([]*types.Product, int, error) {
+	return nil, 0, nil
+}
+
+func (m *mockProductStore) CreateProduct(tx types.Tx, product types.CreateProductPayload) (int, error) {
+	return 0, nil
+}
+
+func (m *mockProductStore) UpdateProduct(tx types.Tx, product types.Product) error {
+	return nil
+}
+
+func (m *mockProductStore) DeleteProduct(productID int) error {
+	return nil
+}
+
+// newInventory returns the built-in inventory service, reserving the stock of
+// products.
+func newInventory(products *mockProductStore) types.InventoryService {
+	store := &mockReservationStore{products: products}
+	return inventory.NewService(store, store, nil, nil, inventory.SingleLocation{}, mockTransactor{})
+}
+
+// mockReservationStore keeps all stock at a single location.
+type mockReservationStore struct {
+	types.ReservationStore
+	types.StockLocationStore
+	products *mockProductStore
+}
+
+func (m *mockReservationStore) GetStockLocations() ([]types.StockLocation, error) {
+	return []types.StockLocation{{ID: 1, Code: "MAIN", Country: "US", Active: true}}, nil
+}
+
+func (m *mockReservationStore) GetLocationStockForUpdate(tx types.Tx, productIDs []int) ([]types.LocationStock, error) {
+	m.products.mu.Lock()
+	defer m.products.mu.Unlock()
+	stock := []types.LocationStock{}
+	for _, id := range productIDs {
+		if p, ok := m.products.products[id]; ok {
+			stock = append(stock, types.LocationStock{LocationID: 1, ProductID: id, OnHand: p.Quantity, Reserved: m.products.reserved[id]})
+		}
+	}
+	return stock, nil
+}
+
+func (m *mockReservationStore) CreateReservation(tx types.Tx, r types.StockReservation) error {
+	m.products.mu.Lock()
+	defer m.products.mu.Unlock()
+	if m.products.reserved == nil {
+		m.products.reserved = map[int]int{}
+	}
+	p, ok := m.products.products[r.ProductID]
+	if !ok || p.Quantity-m.products.reserved[r.ProductID] < r.Quantity {
+		return fmt.Errorf("%w: product %d is not available in the quantity requested", inventory.ErrInsufficientStock, r.ProductID)
+	}
+	m.products.reserved[r.ProductID] += r.Quantity
+	mtx := tx.(*mockTx)
+	mtx.onRollback = append(mtx.onRollback, func() {
+		m.products.mu.Lock()
+		defer m.products.mu.Unlock()
+		m.products.reserved[r.ProductID] -= r.Quantity
+	})
+	return nil
+}
+
+type mockOrderStore struct {
+	mu        sync.Mutex
+	orders    []types.Order
+	items     []types.OrderItem
+	discounts []types.AppliedDiscount
+	taxes     []types.TaxLine
+	failItems bool
+}
+
+func (m *mockOrderStore) CreateOrder(tx types.Tx, order types.Order) (int, error) {
+	mtx := tx.(*mockTx)
+	mtx.onCommit = append(mtx.onCommit, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.orders = append(m.orders, order)
+	})
+	return 1, nil
+}
+
+func (m *mockOrderStore) CreateOrderItem(tx types.Tx, item types.OrderItem) error {
+	if m.failItems {
+		return fmt.Errorf("failed to insert order item")
+	}
+	mtx := tx.(*mockTx)
+	mtx.onCommit = append(mtx.onCommit, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.items = append(m.items, item)
+	})
+	return nil
+}
+
+func (m *mockOrderStore) GetOrdersByUserID(userID int, page types.Page) ([]types.Order, error) {
+	return nil, nil
+}
+
+func (m *mockOrderStore) GetOrderByID(id int) (*types.Order, error) {
+	return nil, fmt.Errorf("order not found")
+}
+
+func (m *mockOrderStore) GetOrderItems(orderID int) ([]types.OrderItem, error) {
+	return nil, nil
+}
+
+func (m *mockOrderStore) GetOrderForUpdate(tx types.Tx, id int) (*types.Order, error) {
+	return nil, fmt.Errorf("order not found")
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(tx types.Tx, orderID int, status string) error {
+	return nil
+}
+
+func (m *mockOrderStore) CreateOrderStatusChange(tx types.Tx, change types.OrderStatusChange) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderStatusHistory(orderID int) ([]types.OrderStatusChange, error) {
+	return nil, nil
+}
+
+func (m *mockOrderStore) CreateOrderDiscount(tx types.Tx, orderID int, discount types.AppliedDiscount) error {
+	mtx := tx.(*mockTx)
+	mtx.onCommit = append(mtx.onCommit, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.discounts = append(m.discounts, discount)
+	})
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderDiscounts(orderID int) ([]types.AppliedDiscount, error) {
+	return m.discounts, nil
+}
+
+func (m *mockOrderStore) CreateOrderTax(tx types.Tx, orderID int, t types.TaxLine) error {
+	mtx := tx.(*mockTx)
+	mtx.onCommit = append(mtx.onCommit, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.taxes = append(m.taxes, t)
+	})
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderTaxes(orderID int) ([]types.TaxLine, error) {
+	return m.taxes, nil
+}
+
+type mockCartStore struct {
+	cart *types.Cart
+}
+
+func (m *mockCartStore) GetCartByUserID(userID int) (*types.Cart, error) {
+	cp := *m.cart
+	return &cp, nil
+}
+
+func (m *mockCartStore) AddToCart(userID, productID, quantity int) error {
+	return nil
+}
+
+func (m *mockCartStore) RemoveFromCart(userID, productID int) error {
+	return nil
+}
+
+func (m *mockCartStore) ClearCart(userID int) error {
+	m.cart.Items = nil
+	return nil
+}
+
+func (m *mockCartStore) GetCartForUpdate(tx types.Tx, userID int) (*types.Cart, error) {
+	cp := *m.cart
+	return &cp, nil
+}
+
+func (m *mockCartStore) DeleteCartItems(tx types.Tx, cartID int) error {
+	mtx := tx.(*mockTx)
+	mtx.onCommit = append(mtx.onCommit, func() {
+		m.cart.Items = []types.CartItem{}
+	})
+	return nil
+}
+
+func (m *mockCartStore) SetCartCoupon(userID int, code string) error {
+	m.cart.CouponCode = code
+	return nil
+}
+
+func (m *mockCartStore) ClearCartCoupon(tx types.Tx, cartID int) error {
+	mtx := tx.(*mockTx)
+	mtx.onCommit = append(mtx.onCommit, func() {
+		m.cart.CouponCode = ""
+	})
+	return nil
+}
+
+func (m *mockProductStore) GetProductsByCategoryIDs(categoryIDs []int) ([]*types.Product, error) {
+	return nil, nil
+}
+
+type mockAddressStore struct {
+	addresses map[int]types.Address
+}
+
+// newMockAddressStore gives users 1 to n a default address whose ID matches
+// the user's.
+func newMockAddressStore(n int) *mockAddressStore {
+	m := &mockAddressStore{addresses: map[int]types.Address{}}
+	for id := 1; id <= n; id++ {
+		m.addresses[id] = types.Address{
+			ID:                id,
+			UserID:            id,
+			PostalAddress:     types.PostalAddress{Name: fmt.Sprintf("Customer %d", id), Line1: "1 Main St", City: "Springfield", Country: "US"},
+			IsDefaultShipping: true,
+		}
+	}
+	return m
+}
+
+func (m *mockAddressStore) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	var addresses []types.Address
+	for _, a := range m.addresses {
+		if a.UserID == userID {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(id int) (*types.Address, error) {
+	a, ok := m.addresses[id]
+	if !ok {
+		return nil, fmt.Errorf("address not found")
+	}
+	return &a, nil
+}
+
+func (m *mockAddressStore) CreateAddress(tx types.Tx, address types.Address) (int, error) { return 0, nil }
+func (m *mockAddressStore) UpdateAddress(tx types.Tx, address types.Address) error        { return nil }
+func (m *mockAddressStore) DeleteAddress(id int) error                                    { return nil }
+func (m *mockAddressStore) ClearDefaultAddresses(tx types.Tx, userID int, shipping, billing bool) error {
+	return nil
+}
+
+type mockPaymentService struct{}
+
+func (m *mockPaymentService) StartPayment(order types.Order) (*types.PaymentSession, error) {
+	return &types.PaymentSession{PaymentID: order.ID, Amount: order.Total, Status: types.PaymentStatusPending}, nil
+}
+
+func (m *mockPaymentService) RefundOrder(tx types.Tx, orderID int) error { return nil }
+
+// newPromotions returns the real promotion service over the given
+// promotions.
+func newPromotions(promotions ...types.Promotion) types.PromotionService {
+	store := &mockPromotionStore{promotions: map[string]*types.Promotion{}}
+	for i := range promotions {
+		store.promotions[promotions[i].Code] = &promotions[i]
+	}
+	return promotion.NewService(store, nil, newCurrencies())
+}
+
+// newCurrencies returns the real currency service with euros at half a
+// dollar and an explicit euro price for product 2.
+func newCurrencies() types.CurrencyService {
+	return currency.NewService(&mockCurrencyStore{
+		rates:  map[string]float64{"EUR": 0.5},
+		prices: map[int]types.Money{2: types.NewMoney(300, "EUR")},
+	})
+}
+
+// newTaxes returns the built-in tax calculator over rates, with books
+// (category 5) in the reduced tax class.
+func newTaxes(rates ...types.TaxRate) types.TaxCalculator {
+	return tax.NewCalculator(&mockTaxRateStore{rates: rates}, &mockCategoryStore{categories: []types.Category{
+		{ID: 5, Name: "Books", Slug: "books", TaxClass: "reduced"},
+	}})
+}
+
+// newShipping returns the built-in shipping rate provider over methods.
+func newShipping(methods ...types.ShippingMethod) types.ShippingRateProvider {
+	return shipping.NewProvider(&mockShippingMethodStore{methods: methods}, newCurrencies())
+}
+
+type mockShippingMethodStore struct {
+	types.ShippingMethodStore
+	methods []types.ShippingMethod
+}
+
+func (m *mockShippingMethodStore) GetShippingMethods() ([]types.ShippingMethod, error) {
+	return m.methods, nil
+}
+
+type mockTaxRateStore struct {
+	types.TaxRateStore
+	rates []types.TaxRate
+}
+
+func (m *mockTaxRateStore) GetTaxRatesForAddress(country, region string) ([]types.TaxRate, error) {
+	rates := []types.TaxRate{}
+	for _, r := range m.rates {
+		if r.Country == country && (r.Region == "" || r.Region == region) {
+			rates = append(rates, r)
+		}
+	}
+	return rates, nil
+}
+
+type mockCategoryStore struct {
+	types.CategoryStore
+	categories []types.Category
+}
+
+func (m *mockCategoryStore) GetCategories() ([]types.Category, error) {
+	return m.categories, nil
+}
+
+type mockCurrencyStore struct {
+	types.CurrencyStore
+	rates  map[string]float64
+	prices map[int]types.Money
+}
+
+func (m *mockCurrencyStore) GetExchangeRate(code string) (*types.ExchangeRate, error) {
+	rate, ok := m.rates[code]
+	if !ok {
+		return nil, currency.ErrRateNotFound
+	}
+	return &types.ExchangeRate{Currency: code, Rate: rate}, nil
+}
+
+func (m *mockCurrencyStore) GetPricesInCurrency(code string, productIDs []int) (map[int]types.Money, error) {
+	prices := make(map[int]types.Money)
+	for _, id := range productIDs {
+		if price, ok := m.prices[id]; ok && price.Currency == code {
+			prices[id] = price
+		}
+	}
+	return prices, nil
+}
+
+type mockPromotionStore struct {
+	mu          sync.Mutex
+	promotions  map[string]*types.Promotion
+	redemptions []int
+}
+
+func (m *mockPromotionStore) GetPromotions() ([]types.Promotion, error)         { return nil, nil }
+func (m *mockPromotionStore) GetPromotionByID(id int) (*types.Promotion, error) { return nil, nil }
+func (m *mockPromotionStore) CreatePromotion(p types.Promotion) (int, error)    { return 0, nil }
+func (m *mockPromotionStore) UpdatePromotion(p types.Promotion) error           { return nil }
+
+func (m *mockPromotionStore) GetPromotionByCode(code string) (*types.Promotion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.promotions[code]
+	if !ok {
+		return nil, promotion.ErrPromotionNotFound
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (m *mockPromotionStore) GetPromotionByCodeForUpdate(tx types.Tx, code string) (*types.Promotion, error) {
+	return m.GetPromotionByCode(code)
+}
+
+func (m *mockPromotionStore) CountRedemptions(promotionID, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, id := range m.redemptions {
+		if id == promotionID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockPromotionStore) CountRedemptionsForUpdate(tx types.Tx, promotionID, userID int) (int, error) {
+	return m.CountRedemptions(promotionID, userID)
+}
+
+func (m *mockPromotionStore) CreateRedemption(tx types.Tx, promotionID, userID, orderID int) error {
+	mtx := tx.(*mockTx)
+	mtx.onCommit = append(mtx.onCommit, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.redemptions = append(m.redemptions, promotionID)
+	})
+	return nil
+}
@@ -1,17 +1,35 @@
 package cart
 
 import (
+	"errors"
 	"fmt"
+	"log"
 
+	"backend/service/promotion"
+	"backend/service/shipping"
 	"backend/types"
 )
 
+var (
+	errAddressRequired        = errors.New("a shipping address is required")
+	errAddressNotFound        = errors.New("address not found")
+	errShippingMethodRequired = errors.New("a shipping method is required")
+	errTooManyUnits           = fmt.Errorf("a cart holds at most %d of a product", types.MaxItemQuantity)
+
+	// errCannotOrder is wrapped by the errors about an order that cannot be
+	// placed as it stands, as opposed to one the store failed to place.
+	errCannotOrder = errors.New("cannot place order")
+)
+
 func getCartItemsIDs(items []types.CartCheckoutItem) ([]int, error) {
 	productIds := make([]int, len(items))
 	for i, item := range items {
 		if item.Quantity <= 0 {
 			return nil, fmt.Errorf("invalid quantity for product %d", item.ProductID)
 		}
+		if item.Quantity > types.MaxItemQuantity {
+			return nil, fmt.Errorf("%w: at most %d of product %d can be ordered", errCannotOrder, types.MaxItemQuantity, item.ProductID)
+		}
 
 		productIds[i] = item.ProductID
 	}
@@ -21,73 +39,404 @@ func getCartItemsIDs(items []types.CartCheckoutItem) ([]int, error) {
 
 func checkIfCartIsInStock(cartItems []types.CartCheckoutItem, products map[int]types.Product) error {
 	if len(cartItems) == 0 {
-		return fmt.Errorf("cart is empty")
+		return fmt.Errorf("%w: cart is empty", errCannotOrder)
 	}
 
 	for _, item := range cartItems {
 		product, ok := products[item.ProductID]
 		if !ok {
-			return fmt.Errorf("product %d is not available in the store, please refresh your cart", item.ProductID)
+			return fmt.Errorf("%w: product %d is not available in the store, please refresh your cart", errCannotOrder, item.ProductID)
 		}
 
 		if product.Quantity < item.Quantity {
-			return fmt.Errorf("product %s is not available in the quantity requested", product.Name)
+			return fmt.Errorf("%w: product %s is not available in the quantity requested", errCannotOrder, product.Name)
+		}
+	}
+
+	return nil
+}
+
+// priceLines describes cartItems at current prices for the promotion engine.
+// Items whose product is gone are left out.
+func priceLines(cartItems []types.CartCheckoutItem, products map[int]types.Product) []types.PriceLine {
+	lines := make([]types.PriceLine, 0, len(cartItems))
+	for _, item := range cartItems {
+		product, ok := products[item.ProductID]
+		if !ok {
+			continue
+		}
+
+		lines = append(lines, types.PriceLine{
+			ProductID:  product.ID,
+			CategoryID: product.CategoryID,
+			UnitPrice:  product.Price,
+			Quantity:   item.Quantity,
+		})
+	}
+	return lines
+}
+
+// cartPricing prices the user's saved cart with its coupon, and with an
+// estimate of the tax when address is known. A coupon that no longer
+// applies, for instance because items were removed since it was added, is
+// left out of the price and reported as couponErr.
+func (h *Handler) cartPricing(userID int, cart *types.Cart, currency string, address *types.PostalAddress) (pricing *types.PriceBreakdown, couponErr error, err error) {
+	products, cartItems, err := h.cartProducts(cart, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	productsMap := make(map[int]types.Product)
+	for _, product := range products {
+		productsMap[product.ID] = product
+	}
+	lines := priceLines(cartItems, productsMap)
+
+	pricing, couponErr, err = h.priceLines(userID, cart.CouponCode, lines)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if address != nil {
+		if err := h.addTax(pricing, lines, *address); err != nil {
+			return nil, nil, err
 		}
 	}
 
+	return pricing, couponErr, nil
+}
+
+// priceLines prices lines with coupon, leaving it out and reporting it as
+// couponErr if it does not apply.
+func (h *Handler) priceLines(userID int, coupon string, lines []types.PriceLine) (pricing *types.PriceBreakdown, couponErr error, err error) {
+	pricing, err = h.promotions.Price(userID, coupon, lines)
+	if errors.Is(err, promotion.ErrInvalidCoupon) {
+		couponErr = err
+		pricing, err = h.promotions.Price(userID, "", lines)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pricing, couponErr, nil
+}
+
+// addTax works out the tax on lines shipped to address and adds it to
+// pricing, whose total goes up by whatever tax the prices do not already
+// include.
+func (h *Handler) addTax(pricing *types.PriceBreakdown, lines []types.PriceLine, address types.PostalAddress) error {
+	tax, err := h.taxes.Calculate(address, lines, pricing.DiscountTotal)
+	if err != nil {
+		return err
+	}
+
+	pricing.Tax = tax
+	pricing.Total = pricing.Total.Add(tax.Exclusive)
 	return nil
 }
 
-func calculateTotalPrice(cartItems []types.CartCheckoutItem, products map[int]types.Product) float64 {
-	var total float64
+// cartShippingOptions returns the options for shipping the user's saved cart
+// to address, with costs in currency.
+func (h *Handler) cartShippingOptions(userID int, cart *types.Cart, currency string, address types.PostalAddress) ([]types.ShippingOption, error) {
+	products, cartItems, err := h.cartProducts(cart, currency)
+	if err != nil {
+		return nil, err
+	}
 
+	productsMap := make(map[int]types.Product)
+	for _, product := range products {
+		productsMap[product.ID] = product
+	}
+	pricing, _, err := h.priceLines(userID, cart.CouponCode, priceLines(cartItems, productsMap))
+	if err != nil {
+		return nil, err
+	}
+
+	return h.shipping.Quote(address, parcel(cartItems, productsMap, pricing))
+}
+
+// parcel describes what cartItems ship as, worth what pricing charges for
+// the goods.
+func parcel(cartItems []types.CartCheckoutItem, products map[int]types.Product, pricing *types.PriceBreakdown) types.Parcel {
+	p := types.Parcel{Value: pricing.Subtotal.Sub(pricing.DiscountTotal)}
 	for _, item := range cartItems {
-		product := products[item.ProductID]
-		total += product.Price * float64(item.Quantity)
+		p.Weight += shipping.BillableWeight(products[item.ProductID]) * item.Quantity
+	}
+	return p
+}
+
+// addShipping adds the cost of shipping p to address by the method with
+// methodID to pricing. A method is only required when there is a choice
+// of one.
+func (h *Handler) addShipping(pricing *types.PriceBreakdown, p types.Parcel, address types.PostalAddress, methodID int) error {
+	options, err := h.shipping.Quote(address, p)
+	if err != nil {
+		return err
+	}
+
+	if methodID == 0 {
+		if len(options) > 0 {
+			return errShippingMethodRequired
+		}
+		return nil
+	}
+
+	for i, o := range options {
+		if o.MethodID == methodID {
+			pricing.Shipping = &options[i]
+			pricing.Total = pricing.Total.Add(o.Cost)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: shipping method %d is not available for this order", errCannotOrder, methodID)
+}
+
+// cartProducts returns the items of cart as checkout items along with their
+// products priced in currency. The prices of cart's items are updated to
+// match.
+func (h *Handler) cartProducts(cart *types.Cart, currency string) ([]types.Product, []types.CartCheckoutItem, error) {
+	cartItems := make([]types.CartCheckoutItem, len(cart.Items))
+	for i, item := range cart.Items {
+		cartItems[i] = types.CartCheckoutItem{ProductID: item.ProductID, Quantity: item.Quantity}
+	}
+
+	productIds, err := getCartItemsIDs(cartItems)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var products []types.Product
+	if len(productIds) > 0 {
+		products, err = h.store.GetProductsById(productIds)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := h.localize(currency, products); err != nil {
+		return nil, nil, err
+	}
+
+	prices := make(map[int]types.Money)
+	for _, product := range products {
+		prices[product.ID] = product.Price
+	}
+	for i, item := range cart.Items {
+		if price, ok := prices[item.ProductID]; ok {
+			cart.Items[i].Price = price
+		}
+	}
+
+	return products, cartItems, nil
+}
+
+// localize prices products in currency in place.
+func (h *Handler) localize(currency string, products []types.Product) error {
+	pointers := make([]*types.Product, len(products))
+	for i := range products {
+		pointers[i] = &products[i]
+	}
+	return h.currencies.LocalizePrices(currency, pointers...)
+}
+
+// shippingAddress returns the address an order ships to: the address with
+// addressID, which must belong to the user, or their default shipping address
+// when addressID is zero.
+func (h *Handler) shippingAddress(userID, addressID int) (*types.PostalAddress, error) {
+	if addressID != 0 {
+		a, err := h.addressStore.GetAddressByID(addressID)
+		if err != nil || a.UserID != userID {
+			return nil, errAddressNotFound
+		}
+		return &a.PostalAddress, nil
+	}
+
+	addresses, err := h.addressStore.GetAddressesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range addresses {
+		if a.IsDefaultShipping {
+			return &a.PostalAddress, nil
+		}
+	}
+
+	return nil, errAddressRequired
+}
+
+// estimateAddress returns the address to estimate the tax on the user's cart
+// for: the address with addressID, or their default shipping address when
+// addressID is zero. It is nil if they have no default.
+func (h *Handler) estimateAddress(userID, addressID int) (*types.PostalAddress, error) {
+	address, err := h.shippingAddress(userID, addressID)
+	if errors.Is(err, errAddressRequired) {
+		return nil, nil
+	}
+	return address, err
+}
+
+func (h *Handler) createOrder(products []types.Product, cartItems []types.CartCheckoutItem, userID int, address types.PostalAddress, coupon, currency string, shippingMethodID int) (int, *types.PriceBreakdown, error) {
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	orderID, pricing, err := h.placeOrder(tx, products, cartItems, userID, address, coupon, currency, shippingMethodID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return orderID, pricing, nil
+}
+
+// checkoutCart places an order for the contents of the user's persisted cart
+// at current prices in currency, with the cart's coupon, and empties the cart
+// in the same transaction.
+func (h *Handler) checkoutCart(userID int, address types.PostalAddress, currency string, shippingMethodID int) (int, *types.PriceBreakdown, error) {
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	cart, err := h.cartStore.GetCartForUpdate(tx, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	products, cartItems, err := h.cartProducts(cart, currency)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	orderID, pricing, err := h.placeOrder(tx, products, cartItems, userID, address, cart.CouponCode, currency, shippingMethodID)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	return total
+	if err := h.cartStore.DeleteCartItems(tx, cart.ID); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.cartStore.ClearCartCoupon(tx, cart.ID); err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return orderID, pricing, nil
 }
 
-func (h *Handler) createOrder(products []types.Product, cartItems []types.CartCheckoutItem, userID int) (int, float64, error) {
+// placeOrder writes the order, shipping to a copy of address by the method
+// with shippingMethodID, its items, the discount from coupon and the tax
+// inside tx, and reserves stock for cartItems until it is paid. Products are
+// already priced in currency, which the order is charged in at the current
+// exchange rate. The caller owns committing or rolling back tx.
+func (h *Handler) placeOrder(tx types.Tx, products []types.Product, cartItems []types.CartCheckoutItem, userID int, address types.PostalAddress, coupon, currency string, shippingMethodID int) (int, *types.PriceBreakdown, error) {
 	productsMap := make(map[int]types.Product)
 	for _, product := range products {
 		productsMap[product.ID] = product
 	}
 
 	if err := checkIfCartIsInStock(cartItems, productsMap); err != nil {
-		return 0, 0, err
+		return 0, nil, err
 	}
 
-	totalPrice := calculateTotalPrice(cartItems, productsMap)
+	// Every item has a product now, so lines and cartItems line up.
+	lines := priceLines(cartItems, productsMap)
+	pricing, err := h.promotions.PriceForUpdate(tx, userID, coupon, lines)
+	if err != nil {
+		return 0, nil, err
+	}
 
-	for _, item := range cartItems {
-		product := productsMap[item.ProductID]
-		product.Quantity -= item.Quantity
-		h.store.UpdateProduct(product)
+	if err := h.addTax(pricing, lines, address); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.addShipping(pricing, parcel(cartItems, productsMap, pricing), address, shippingMethodID); err != nil {
+		return 0, nil, err
+	}
+	shipment := types.ShippingOption{Cost: types.NewMoney(0, pricing.Total.Currency)}
+	if pricing.Shipping != nil {
+		shipment = *pricing.Shipping
 	}
 
-	orderID, err := h.orderStore.CreateOrder(types.Order{
-		UserID:  userID,
-		Total:   totalPrice,
-		Status:  "pending",
-		Address: "some address",
+	rate, err := h.currencies.ExchangeRate(currency)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	orderID, err := h.orderStore.CreateOrder(tx, types.Order{
+		UserID:           userID,
+		Subtotal:         pricing.Subtotal,
+		DiscountTotal:    pricing.DiscountTotal,
+		TaxTotal:         pricing.Tax.Total,
+		ShippingMethodID: shipment.MethodID,
+		ShippingMethod:   shipment.Name,
+		ShippingTotal:    shipment.Cost,
+		Total:            pricing.Total,
+		Currency:         currency,
+		ExchangeRate:     rate,
+		Status:           types.OrderStatusPending,
+		ShippingAddress:  address,
 	})
 	if err != nil {
-		return 0, 0, err
+		return 0, nil, err
 	}
 
-	for _, item := range cartItems {
-		err := h.orderStore.CreateOrderItem(types.OrderItem{
+	if err := h.inventory.Reserve(tx, orderID, cartItems, address); err != nil {
+		return 0, nil, err
+	}
+
+	for i, item := range cartItems {
+		err := h.orderStore.CreateOrderItem(tx, types.OrderItem{
 			OrderID:   orderID,
 			ProductID: item.ProductID,
 			Quantity:  item.Quantity,
 			Price:     productsMap[item.ProductID].Price,
+			Tax:       pricing.Tax.Items[i],
 		})
 		if err != nil {
-			return 0, 0, err
+			return 0, nil, err
 		}
 	}
 
-	return orderID, totalPrice, nil
-}
\ No newline at end of file
+	for _, d := range pricing.Discounts {
+		if err := h.orderStore.CreateOrderDiscount(tx, orderID, d); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	for _, t := range pricing.Tax.Lines {
+		if err := h.orderStore.CreateOrderTax(tx, orderID, t); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := h.promotions.Redeem(tx, userID, orderID, *pricing); err != nil {
+		return 0, nil, err
+	}
+
+	return orderID, pricing, nil
+}
+
+// startPayment opens the payment for a newly placed order. The order stands
+// even if the provider is unavailable; the customer can start another payment
+// for it later, so a failure is only logged.
+func (h *Handler) startPayment(orderID, userID int, total types.Money) *types.PaymentSession {
+	session, err := h.payments.StartPayment(types.Order{ID: orderID, UserID: userID, Total: total, Currency: total.Currency, Status: types.OrderStatusPending})
+	if err != nil {
+		log.Printf("failed to start payment for order %d: %v", orderID, err)
+		return nil
+	}
+	return session
+}
@@ -13,28 +13,65 @@ func NewCartStore(db *sql.DB) *CartStore {
 	return &CartStore{db: db}
 }
 
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
 func (s *CartStore) GetCartByUserID(userID int) (*types.Cart, error) {
 	cart := &types.Cart{UserID: userID, Items: []types.CartItem{}}
-	row := s.db.QueryRow("SELECT id FROM carts WHERE user_id = ?", userID)
-	if err := row.Scan(&cart.ID); err != nil {
+	var couponCode sql.NullString
+	row := s.db.QueryRow("SELECT id, coupon_code FROM carts WHERE user_id = ?", userID)
+	if err := row.Scan(&cart.ID, &couponCode); err != nil {
 		if err == sql.ErrNoRows {
 			return cart, nil 
 		}
 		return nil, err
 	}
-	rows, err := s.db.Query(`SELECT ci.id, ci.product_id, p.name, p.price, p.image_url, ci.quantity FROM cart_items ci JOIN products p ON ci.product_id = p.id WHERE ci.cart_id = ?`, cart.ID)
+	items, err := getCartItems(s.db, cart.ID)
+	if err != nil {
+		return nil, err
+	}
+	cart.CouponCode = couponCode.String
+	cart.Items = items
+	return cart, nil
+}
+
+// GetCartForUpdate loads the user's cart inside tx and locks its row, so the
+// cart cannot change while it is being checked out.
+func (s *CartStore) GetCartForUpdate(tx types.Tx, userID int) (*types.Cart, error) {
+	cart := &types.Cart{UserID: userID, Items: []types.CartItem{}}
+	var couponCode sql.NullString
+	row := tx.QueryRow("SELECT id, coupon_code FROM carts WHERE user_id = ? FOR UPDATE", userID)
+	if err := row.Scan(&cart.ID, &couponCode); err != nil {
+		if err == sql.ErrNoRows {
+			return cart, nil
+		}
+		return nil, err
+	}
+	items, err := getCartItems(tx, cart.ID)
+	if err != nil {
+		return nil, err
+	}
+	cart.CouponCode = couponCode.String
+	cart.Items = items
+	return cart, nil
+}
+
+func getCartItems(q queryer, cartID int) ([]types.CartItem, error) {
+	rows, err := q.Query(`SELECT ci.id, ci.product_id, p.name, p.price, p.image, ci.quantity FROM cart_items ci JOIN products p ON ci.product_id = p.id WHERE ci.cart_id = ?`, cartID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	items := []types.CartItem{}
 	for rows.Next() {
 		var item types.CartItem
 		if err := rows.Scan(&item.ID, &item.ProductID, &item.Title, &item.Price, &item.Image, &item.Quantity); err != nil {
 			return nil, err
 		}
-		cart.Items = append(cart.Items, item)
+		items = append(items, item)
 	}
-	return cart, nil
+	return items, rows.Err()
 }
 
 func (s *CartStore) AddToCart(userID, productID, quantity int) error {
@@ -43,19 +80,8 @@ func (s *CartStore) AddToCart(userID, productID, quantity int) error {
 		return err
 	}
 	defer tx.Rollback()
-	var cartID int
-	err = tx.QueryRow("SELECT id FROM carts WHERE user_id = ?", userID).Scan(&cartID)
-	if err == sql.ErrNoRows {
-		res, err := tx.Exec("INSERT INTO carts (user_id) VALUES (?)", userID)
-		if err != nil {
-			return err
-		}
-		lastID, err := res.LastInsertId()
-		if err != nil {
-			return err
-		}
-		cartID = int(lastID)
-	} else if err != nil {
+	cartID, err := cartIDForUser(tx, userID)
+	if err != nil {
 		return err
 	}
 	var existingQty int
@@ -66,6 +92,9 @@ func (s *CartStore) AddToCart(userID, productID, quantity int) error {
 			return err
 		}
 	} else if err == nil {
+		if existingQty+quantity > types.MaxItemQuantity {
+			return errTooManyUnits
+		}
 		_, err = tx.Exec("UPDATE cart_items SET quantity = quantity + ? WHERE cart_id = ? AND product_id = ?", quantity, cartID, productID)
 		if err != nil {
 			return err
@@ -95,3 +124,58 @@ func (s *CartStore) ClearCart(userID int) error {
 	_, err = s.db.Exec("DELETE FROM cart_items WHERE cart_id = ?", cartID)
 	return err
 }
+
+func (s *CartStore) DeleteCartItems(tx types.Tx, cartID int) error {
+	_, err := tx.Exec("DELETE FROM cart_items WHERE cart_id = ?", cartID)
+	return err
+}
+
+// SetCartCoupon stores the coupon code to apply at checkout, creating the
+// user's cart if needed. An empty code removes the coupon.
+func (s *CartStore) SetCartCoupon(userID int, code string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	cartID, err := cartIDForUser(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	var couponCode any
+	if code != "" {
+		couponCode = code
+	}
+	if _, err := tx.Exec("UPDATE carts SET coupon_code = ? WHERE id = ?", couponCode, cartID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *CartStore) ClearCartCoupon(tx types.Tx, cartID int) error {
+	_, err := tx.Exec("UPDATE carts SET coupon_code = NULL WHERE id = ?", cartID)
+	return err
+}
+
+// cartIDForUser returns the ID of the user's cart, creating the cart if the
+// user has none yet.
+func cartIDForUser(tx *sql.Tx, userID int) (int, error) {
+	var cartID int
+	err := tx.QueryRow("SELECT id FROM carts WHERE user_id = ?", userID).Scan(&cartID)
+	if err != sql.ErrNoRows {
+		return cartID, err
+	}
+
+	res, err := tx.Exec("INSERT INTO carts (user_id) VALUES (?)", userID)
+	if err != nil {
+		return 0, err
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(lastID), nil
+}
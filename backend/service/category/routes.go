@@ -0,0 +1,221 @@
+package category
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/service/auth"
+	"backend/service/currency"
+	"backend/types"
+	"backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store        types.CategoryStore
+	productStore types.ProductStore
+	userStore    types.UserStore
+	currencies   types.CurrencyService
+}
+
+func NewHandler(store types.CategoryStore, productStore types.ProductStore, userStore types.UserStore, currencies types.CurrencyService) *Handler {
+	return &Handler{store: store, productStore: productStore, userStore: userStore, currencies: currencies}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/categories", h.handleGetCategories).Methods(http.MethodGet)
+	router.HandleFunc("/categories/{slug}/products", h.handleGetCategoryProducts).Methods(http.MethodGet)
+
+	router.HandleFunc("/categories", auth.WithJWTAuth(auth.WithRole(h.handleCreateCategory, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/categories/{categoryID}", auth.WithJWTAuth(auth.WithRole(h.handleUpdateCategory, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/categories/{categoryID}", auth.WithJWTAuth(auth.WithRole(h.handleDeleteCategory, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.store.GetCategories()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, buildTree(categories))
+}
+
+func (h *Handler) handleGetCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	cur, err := currency.FromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	category, err := h.store.GetCategoryBySlug(mux.Vars(r)["slug"])
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	categories, err := h.store.GetCategories()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	products, err := h.productStore.GetProductsByCategoryIDs(DescendantIDs(categories, category.ID))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.currencies.LocalizePrices(cur, products...); err != nil {
+		utils.WriteError(w, currency.ErrorStatus(err), err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, products)
+}
+
+func (h *Handler) handleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	var payload types.CategoryPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	category, status, err := h.categoryFromPayload(0, payload)
+	if err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	category.ID, err = h.store.CreateCategory(*category)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, category)
+}
+
+func (h *Handler) handleUpdateCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid category ID"))
+		return
+	}
+
+	if _, err := h.store.GetCategoryByID(categoryID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var payload types.CategoryPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	category, status, err := h.categoryFromPayload(categoryID, payload)
+	if err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	if err := h.store.UpdateCategory(*category); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, category)
+}
+
+func (h *Handler) handleDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid category ID"))
+		return
+	}
+
+	categories, err := h.store.GetCategories()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	found := false
+	for _, c := range categories {
+		if c.ID == categoryID {
+			found = true
+		}
+		if c.ParentID != nil && *c.ParentID == categoryID {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf("category has subcategories, move or delete them first"))
+			return
+		}
+	}
+	if !found {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("category not found"))
+		return
+	}
+
+	if err := h.store.DeleteCategory(categoryID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// categoryFromPayload validates payload for the category with the given ID
+// (0 when creating) and returns the HTTP status to use if it is rejected.
+func (h *Handler) categoryFromPayload(id int, payload types.CategoryPayload) (*types.Category, int, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors)
+	}
+
+	if payload.Slug == "" {
+		payload.Slug = slugify(payload.Name)
+	}
+	if !slugPattern.MatchString(payload.Slug) {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid slug %q", payload.Slug)
+	}
+
+	if existing, err := h.store.GetCategoryBySlug(payload.Slug); err == nil && existing.ID != id {
+		return nil, http.StatusConflict, fmt.Errorf("category with slug %q already exists", payload.Slug)
+	}
+
+	if payload.ParentID != nil {
+		categories, err := h.store.GetCategories()
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		parentExists := false
+		for _, c := range categories {
+			if c.ID == *payload.ParentID {
+				parentExists = true
+			}
+		}
+		if !parentExists {
+			return nil, http.StatusBadRequest, fmt.Errorf("parent category %d not found", *payload.ParentID)
+		}
+
+		if id != 0 {
+			for _, descendant := range DescendantIDs(categories, id) {
+				if descendant == *payload.ParentID {
+					return nil, http.StatusBadRequest, fmt.Errorf("category cannot be moved under itself or its subcategories")
+				}
+			}
+		}
+	}
+
+	return &types.Category{
+		ID:       id,
+		ParentID: payload.ParentID,
+		Name:     payload.Name,
+		Slug:     payload.Slug,
+		TaxClass: strings.ToLower(strings.TrimSpace(payload.TaxClass)),
+	}, http.StatusOK, nil
+}
@@ -0,0 +1,159 @@
+package category
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/service/currency"
+	"backend/types"
+	"github.com/gorilla/mux"
+)
+
+func intPtr(i int) *int { return &i }
+
+func newMockCategoryStore() *mockCategoryStore {
+	return &mockCategoryStore{categories: []types.Category{
+		{ID: 1, Name: "Clothing", Slug: "clothing"},
+		{ID: 2, ParentID: intPtr(1), Name: "Shoes", Slug: "shoes"},
+		{ID: 3, ParentID: intPtr(2), Name: "Sneakers", Slug: "sneakers"},
+		{ID: 4, Name: "Electronics", Slug: "electronics"},
+	}}
+}
+
+func TestCategoryServiceHandlers(t *testing.T) {
+	serve := func(handler *Handler, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/categories", handler.handleGetCategories).Methods(http.MethodGet)
+		router.HandleFunc("/categories/{slug}/products", handler.handleGetCategoryProducts).Methods(http.MethodGet)
+		router.HandleFunc("/categories", handler.handleCreateCategory).Methods(http.MethodPost)
+		router.HandleFunc("/categories/{categoryID}", handler.handleUpdateCategory).Methods(http.MethodPut)
+		router.HandleFunc("/categories/{categoryID}", handler.handleDeleteCategory).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should return the categories as a tree", func(t *testing.T) {
+		rr := serve(NewHandler(newMockCategoryStore(), nil, nil, nil), http.MethodGet, "/categories", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var tree []types.Category
+		if err := json.NewDecoder(rr.Body).Decode(&tree); err != nil {
+			t.Fatal(err)
+		}
+		if len(tree) != 2 || tree[0].Slug != "clothing" || tree[0].Children[0].Children[0].Slug != "sneakers" {
+			t.Errorf("Unexpected category tree: %+v", tree)
+		}
+	})
+
+	t.Run("should include products of descendant categories", func(t *testing.T) {
+		productStore := &mockProductStore{}
+		rr := serve(NewHandler(newMockCategoryStore(), productStore, nil, currency.NewService(nil)), http.MethodGet, "/categories/shoes/products", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if fmt.Sprint(productStore.categoryIDs) != "[2 3]" {
+			t.Errorf("Expected products of categories [2 3], got %v", productStore.categoryIDs)
+		}
+	})
+
+	t.Run("should derive a slug when creating a category", func(t *testing.T) {
+		store := newMockCategoryStore()
+		rr := serve(NewHandler(store, nil, nil, nil), http.MethodPost, "/categories", types.CategoryPayload{Name: "Running Shoes!", ParentID: intPtr(2)})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		if created := store.categories[len(store.categories)-1]; created.Slug != "running-shoes" {
+			t.Errorf("Expected slug %q, got %q", "running-shoes", created.Slug)
+		}
+	})
+
+	t.Run("should reject a duplicate slug", func(t *testing.T) {
+		rr := serve(NewHandler(newMockCategoryStore(), nil, nil, nil), http.MethodPost, "/categories", types.CategoryPayload{Name: "Shoes"})
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should not move a category under its own descendant", func(t *testing.T) {
+		rr := serve(NewHandler(newMockCategoryStore(), nil, nil, nil), http.MethodPut, "/categories/1", types.CategoryPayload{Name: "Clothing", ParentID: intPtr(3)})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should not delete a category with subcategories", func(t *testing.T) {
+		rr := serve(NewHandler(newMockCategoryStore(), nil, nil, nil), http.MethodDelete, "/categories/2", nil)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should delete a leaf category", func(t *testing.T) {
+		rr := serve(NewHandler(newMockCategoryStore(), nil, nil, nil), http.MethodDelete, "/categories/3", nil)
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+	})
+}
+
+type mockCategoryStore struct {
+	categories []types.Category
+}
+
+func (m *mockCategoryStore) GetCategories() ([]types.Category, error) {
+	return m.categories, nil
+}
+
+func (m *mockCategoryStore) GetCategoryByID(id int) (*types.Category, error) {
+	for _, c := range m.categories {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("category not found")
+}
+
+func (m *mockCategoryStore) GetCategoryBySlug(slug string) (*types.Category, error) {
+	for _, c := range m.categories {
+		if c.Slug == slug {
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("category not found")
+}
+
+func (m *mockCategoryStore) CreateCategory(category types.Category) (int, error) {
+	category.ID = len(m.categories) + 1
+	m.categories = append(m.categories, category)
+	return category.ID, nil
+}
+
+func (m *mockCategoryStore) UpdateCategory(category types.Category) error {
+	return nil
+}
+
+func (m *mockCategoryStore) DeleteCategory(id int) error {
+	return nil
+}
+
+type mockProductStore struct {
+	types.ProductStore
+	categoryIDs []int
+}
+
+func (m *mockProductStore) GetProductsByCategoryIDs(categoryIDs []int) ([]*types.Product, error) {
+	m.categoryIDs = categoryIDs
+	return []*types.Product{}, nil
+}
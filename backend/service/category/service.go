@@ -0,0 +1,95 @@
+package category
+
+import (
+	"regexp"
+	"strings"
+
+	"backend/types"
+)
+
+var (
+	slugPattern     = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	nonSlugRunsExpr = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// slugify derives a URL slug such as "mens-shoes" from a category name.
+func slugify(name string) string {
+	slug := nonSlugRunsExpr.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(slug, "-")
+}
+
+// buildTree nests a flat list of categories under their parents and returns
+// the roots. Categories whose parent is missing are treated as roots.
+func buildTree(categories []types.Category) []*types.Category {
+	nodes := make(map[int]*types.Category, len(categories))
+	for i := range categories {
+		c := categories[i]
+		c.Children = []*types.Category{}
+		nodes[c.ID] = &c
+	}
+
+	roots := []*types.Category{}
+	for i := range categories {
+		node := nodes[categories[i].ID]
+		if node.ParentID != nil {
+			if parent, ok := nodes[*node.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	return roots
+}
+
+// DescendantIDs returns rootID followed by the IDs of every category below it.
+func DescendantIDs(categories []types.Category, rootID int) []int {
+	children := make(map[int][]int)
+	for _, c := range categories {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c.ID)
+		}
+	}
+
+	ids := []int{rootID}
+	seen := map[int]bool{rootID: true}
+	for i := 0; i < len(ids); i++ {
+		for _, id := range children[ids[i]] {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids
+}
+
+// TaxClass returns the tax class of the category with id: its own, the
+// nearest ancestor's or else types.TaxClassStandard. Products without a
+// category are standard too.
+func TaxClass(categories []types.Category, id int) string {
+	byID := make(map[int]types.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+
+	seen := map[int]bool{}
+	for !seen[id] {
+		seen[id] = true
+		c, ok := byID[id]
+		if !ok {
+			break
+		}
+		if c.TaxClass != "" {
+			return c.TaxClass
+		}
+		if c.ParentID == nil {
+			break
+		}
+		id = *c.ParentID
+	}
+
+	return types.TaxClassStandard
+}
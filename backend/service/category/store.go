@@ -0,0 +1,110 @@
+package category
+
+import (
+	"database/sql"
+	"fmt"
+
+	"backend/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetCategories() ([]types.Category, error) {
+	rows, err := s.db.Query("SELECT id, parent_id, name, slug, tax_class FROM categories ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []types.Category{}
+	for rows.Next() {
+		c, err := scanRowsIntoCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, *c)
+	}
+
+	return categories, rows.Err()
+}
+
+func (s *Store) GetCategoryByID(id int) (*types.Category, error) {
+	return s.getCategory("SELECT id, parent_id, name, slug, tax_class FROM categories WHERE id = ?", id)
+}
+
+func (s *Store) GetCategoryBySlug(slug string) (*types.Category, error) {
+	return s.getCategory("SELECT id, parent_id, name, slug, tax_class FROM categories WHERE slug = ?", slug)
+}
+
+func (s *Store) getCategory(query string, arg any) (*types.Category, error) {
+	rows, err := s.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c := new(types.Category)
+	for rows.Next() {
+		c, err = scanRowsIntoCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.ID == 0 {
+		return nil, fmt.Errorf("category not found")
+	}
+
+	return c, nil
+}
+
+func (s *Store) CreateCategory(category types.Category) (int, error) {
+	res, err := s.db.Exec("INSERT INTO categories (parent_id, name, slug, tax_class) VALUES (?, ?, ?, ?)", category.ParentID, category.Name, category.Slug, category.TaxClass)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *Store) UpdateCategory(category types.Category) error {
+	_, err := s.db.Exec("UPDATE categories SET parent_id = ?, name = ?, slug = ?, tax_class = ? WHERE id = ?", category.ParentID, category.Name, category.Slug, category.TaxClass, category.ID)
+	return err
+}
+
+func (s *Store) DeleteCategory(id int) error {
+	_, err := s.db.Exec("DELETE FROM categories WHERE id = ?", id)
+	return err
+}
+
+func scanRowsIntoCategory(rows *sql.Rows) (*types.Category, error) {
+	category := new(types.Category)
+	var parentID sql.NullInt64
+
+	err := rows.Scan(
+		&category.ID,
+		&parentID,
+		&category.Name,
+		&category.Slug,
+		&category.TaxClass,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		category.ParentID = &id
+	}
+
+	return category, nil
+}
@@ -0,0 +1,183 @@
+package currency
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backend/service/auth"
+	"backend/types"
+	"backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store        types.CurrencyStore
+	productStore types.ProductStore
+	userStore    types.UserStore
+}
+
+func NewHandler(store types.CurrencyStore, productStore types.ProductStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, productStore: productStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/exchange-rates", h.handleGetExchangeRates).Methods(http.MethodGet)
+	router.HandleFunc("/admin/exchange-rates/{currency}", auth.WithJWTAuth(auth.WithRole(h.handleSetExchangeRate, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPut)
+
+	router.HandleFunc("/products/{productID}/prices", auth.WithJWTAuth(auth.WithRole(h.handleGetProductPrices, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/products/{productID}/prices/{currency}", auth.WithJWTAuth(auth.WithRole(h.handleSetProductPrice, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{productID}/prices/{currency}", auth.WithJWTAuth(auth.WithRole(h.handleDeleteProductPrice, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.store.GetExchangeRates()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"base":  types.DefaultCurrency(),
+		"rates": rates,
+	})
+}
+
+func (h *Handler) handleSetExchangeRate(w http.ResponseWriter, r *http.Request) {
+	currency, err := foreignCurrency(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.ExchangeRatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	if err := h.store.SetExchangeRate(currency, payload.Rate); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rate, err := h.store.GetExchangeRate(currency)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rate)
+}
+
+func (h *Handler) handleGetProductPrices(w http.ResponseWriter, r *http.Request) {
+	product, err := h.product(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	prices, err := h.store.GetProductPrices(product.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"base":   types.ProductPrice{ProductID: product.ID, Currency: types.DefaultCurrency(), Price: product.Price},
+		"prices": prices,
+	})
+}
+
+func (h *Handler) handleSetProductPrice(w http.ResponseWriter, r *http.Request) {
+	product, err := h.product(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	currency, err := foreignCurrency(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload types.ProductPricePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	// The payload was read in the default currency; read it again in the
+	// price's own so that, say, fractional yen are refused.
+	price, err := types.ParseMoney(payload.Price.String(), currency)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	productPrice := types.ProductPrice{ProductID: product.ID, Currency: currency, Price: price}
+	if err := h.store.SetProductPrice(productPrice); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, productPrice)
+}
+
+func (h *Handler) handleDeleteProductPrice(w http.ResponseWriter, r *http.Request) {
+	product, err := h.product(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	currency, err := foreignCurrency(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.DeleteProductPrice(product.ID, currency); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) product(r *http.Request) (*types.Product, error) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid product ID")
+	}
+
+	return h.productStore.GetProductById(productID)
+}
+
+// foreignCurrency returns the currency in the path of r, which has to be one
+// the store sells in other than the default. Prices in the default currency
+// are the catalog prices themselves.
+func foreignCurrency(r *http.Request) (string, error) {
+	currency, err := Supported(mux.Vars(r)["currency"])
+	if err != nil {
+		return "", err
+	}
+	if currency == types.DefaultCurrency() {
+		return "", fmt.Errorf("%s is the catalog currency, update the product's price instead", currency)
+	}
+	return currency, nil
+}
@@ -0,0 +1,262 @@
+package currency
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/types"
+	"github.com/gorilla/mux"
+)
+
+func newMockCurrencyStore() *mockCurrencyStore {
+	return &mockCurrencyStore{
+		rates: map[string]float64{"EUR": 0.92},
+		prices: map[string]map[int]types.Money{
+			"EUR": {2: types.NewMoney(1500, "EUR")},
+		},
+	}
+}
+
+func TestLocalizePrices(t *testing.T) {
+	products := func() []*types.Product {
+		return []*types.Product{
+			{ID: 1, Price: types.MustParseMoney("19.99"), Currency: types.DefaultCurrency()},
+			{ID: 2, Price: types.MustParseMoney("17.00"), Currency: types.DefaultCurrency()},
+		}
+	}
+
+	t.Run("should prefer the price list and convert the rest", func(t *testing.T) {
+		p := products()
+		if err := NewService(newMockCurrencyStore()).LocalizePrices("eur", p...); err != nil {
+			t.Fatal(err)
+		}
+
+		// 19.99 at 0.92 is 18.3908.
+		if p[0].Price != types.NewMoney(1839, "EUR") || p[0].Currency != "EUR" {
+			t.Errorf("Expected a converted price of 18.39 EUR, got %s %s", p[0].Price, p[0].Currency)
+		}
+		if p[1].Price != types.NewMoney(1500, "EUR") {
+			t.Errorf("Expected the listed price of 15.00 EUR, got %s", p[1].Price)
+		}
+	})
+
+	t.Run("should leave catalog prices alone in the default currency", func(t *testing.T) {
+		p := products()
+		if err := NewService(nil).LocalizePrices(types.DefaultCurrency(), p...); err != nil {
+			t.Fatal(err)
+		}
+		if p[0].Price != types.MustParseMoney("19.99") {
+			t.Errorf("Expected 19.99, got %s", p[0].Price)
+		}
+	})
+
+	t.Run("should refuse to convert without an exchange rate", func(t *testing.T) {
+		err := NewService(newMockCurrencyStore()).LocalizePrices("GBP", products()...)
+		if !errors.Is(err, ErrUnsupportedCurrency) {
+			t.Errorf("Expected an unsupported currency, got %v", err)
+		}
+	})
+
+	t.Run("should convert between two foreign currencies", func(t *testing.T) {
+		store := newMockCurrencyStore()
+		store.rates["GBP"] = 0.8
+
+		got, err := NewService(store).Convert(types.NewMoney(9200, "EUR"), "GBP")
+		if err != nil || got != types.NewMoney(8000, "GBP") {
+			t.Errorf("Expected 80.00 GBP, got %s, %v", got, err)
+		}
+	})
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		header  string
+		want    string
+		invalid bool
+	}{
+		{name: "should default to the store currency", want: types.DefaultCurrency()},
+		{name: "should read the query parameter", query: "?currency=eur", want: "EUR"},
+		{name: "should read the header", header: "gbp", want: "GBP"},
+		{name: "should prefer the query parameter to the header", query: "?currency=gbp", header: "EUR", want: "GBP"},
+		{name: "should reject a currency the store does not sell in", query: "?currency=XYZ", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+
+			got, err := FromRequest(req)
+			if tt.invalid {
+				if !errors.Is(err, ErrUnsupportedCurrency) {
+					t.Errorf("Expected an unsupported currency, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Expected %q, got %q, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestCurrencyHandlers(t *testing.T) {
+	serve := func(handler *Handler, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/exchange-rates/{currency}", handler.handleSetExchangeRate).Methods(http.MethodPut)
+		router.HandleFunc("/products/{productID}/prices/{currency}", handler.handleSetProductPrice).Methods(http.MethodPut)
+		router.HandleFunc("/products/{productID}/prices/{currency}", handler.handleDeleteProductPrice).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	newHandler := func() (*Handler, *mockCurrencyStore) {
+		store := newMockCurrencyStore()
+		productStore := &mockProductStore{products: map[int]*types.Product{
+			1: {ID: 1, Name: "Widget", Price: types.MustParseMoney("10")},
+		}}
+		return NewHandler(store, productStore, nil), store
+	}
+
+	t.Run("should update an exchange rate", func(t *testing.T) {
+		handler, store := newHandler()
+		rr := serve(handler, http.MethodPut, "/admin/exchange-rates/gbp", map[string]any{"rate": 0.79})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if store.rates["GBP"] != 0.79 {
+			t.Errorf("Expected a GBP rate of 0.79, got %v", store.rates["GBP"])
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		path string
+		rate float64
+	}{
+		{name: "should reject a rate for the default currency", path: "/admin/exchange-rates/" + types.DefaultCurrency(), rate: 1},
+		{name: "should reject a rate for an unsupported currency", path: "/admin/exchange-rates/xyz", rate: 1},
+		{name: "should reject a rate that is not positive", path: "/admin/exchange-rates/eur", rate: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, _ := newHandler()
+			rr := serve(handler, http.MethodPut, tt.path, map[string]any{"rate": tt.rate})
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should set and remove a product's price in a currency", func(t *testing.T) {
+		handler, store := newHandler()
+		rr := serve(handler, http.MethodPut, "/products/1/prices/gbp", map[string]any{"price": "8.5"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if got := store.prices["GBP"][1]; got != types.NewMoney(850, "GBP") {
+			t.Errorf("Expected a price of 8.50 GBP, got %s %s", got, got.Currency)
+		}
+
+		rr = serve(handler, http.MethodDelete, "/products/1/prices/gbp", nil)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		if _, ok := store.prices["GBP"][1]; ok {
+			t.Error("Expected the GBP price to be removed")
+		}
+	})
+
+	t.Run("should not price a missing product", func(t *testing.T) {
+		handler, _ := newHandler()
+		rr := serve(handler, http.MethodPut, "/products/9/prices/eur", map[string]any{"price": 5})
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+type mockCurrencyStore struct {
+	rates  map[string]float64
+	prices map[string]map[int]types.Money
+}
+
+func (m *mockCurrencyStore) GetExchangeRates() ([]types.ExchangeRate, error) {
+	rates := []types.ExchangeRate{}
+	for currency, rate := range m.rates {
+		rates = append(rates, types.ExchangeRate{Currency: currency, Rate: rate})
+	}
+	return rates, nil
+}
+
+func (m *mockCurrencyStore) GetExchangeRate(currency string) (*types.ExchangeRate, error) {
+	rate, ok := m.rates[currency]
+	if !ok {
+		return nil, ErrRateNotFound
+	}
+	return &types.ExchangeRate{Currency: currency, Rate: rate}, nil
+}
+
+func (m *mockCurrencyStore) SetExchangeRate(currency string, rate float64) error {
+	m.rates[currency] = rate
+	return nil
+}
+
+func (m *mockCurrencyStore) GetProductPrices(productID int) ([]types.ProductPrice, error) {
+	prices := []types.ProductPrice{}
+	for currency, list := range m.prices {
+		if price, ok := list[productID]; ok {
+			prices = append(prices, types.ProductPrice{ProductID: productID, Currency: currency, Price: price})
+		}
+	}
+	return prices, nil
+}
+
+func (m *mockCurrencyStore) GetPricesInCurrency(currency string, productIDs []int) (map[int]types.Money, error) {
+	prices := make(map[int]types.Money)
+	for _, id := range productIDs {
+		if price, ok := m.prices[currency][id]; ok {
+			prices[id] = price
+		}
+	}
+	return prices, nil
+}
+
+func (m *mockCurrencyStore) SetProductPrice(p types.ProductPrice) error {
+	if m.prices[p.Currency] == nil {
+		m.prices[p.Currency] = make(map[int]types.Money)
+	}
+	m.prices[p.Currency][p.ProductID] = p.Price
+	return nil
+}
+
+func (m *mockCurrencyStore) DeleteProductPrice(productID int, currency string) error {
+	delete(m.prices[currency], productID)
+	return nil
+}
+
+type mockProductStore struct {
+	types.ProductStore
+	products map[int]*types.Product
+}
+
+func (m *mockProductStore) GetProductById(id int) (*types.Product, error) {
+	p, ok := m.products[id]
+	if !ok {
+		return nil, errors.New("product not found")
+	}
+	return p, nil
+}
@@ -0,0 +1,142 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"backend/config"
+	"backend/types"
+)
+
+// ErrUnsupportedCurrency is wrapped by every error about a currency the store
+// cannot price in, either because it does not sell in it or because it has no
+// exchange rate for it.
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// ErrorStatus is the HTTP status for err from pricing in a currency: asking
+// for one the store cannot price in is the client's mistake.
+func ErrorStatus(err error) int {
+	if errors.Is(err, ErrUnsupportedCurrency) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Header names the currency to price a request in when it has no currency
+// query parameter.
+const Header = "X-Currency"
+
+// FromRequest returns the currency r wants prices in: its currency query
+// parameter, its X-Currency header or else the default currency.
+func FromRequest(r *http.Request) (string, error) {
+	currency := r.URL.Query().Get("currency")
+	if currency == "" {
+		currency = r.Header.Get(Header)
+	}
+	if currency == "" {
+		return types.DefaultCurrency(), nil
+	}
+	return Supported(currency)
+}
+
+// Supported returns currency in canonical, upper case form if the store sells
+// in it.
+func Supported(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == types.DefaultCurrency() {
+		return currency, nil
+	}
+
+	for _, c := range config.Envs.Currencies {
+		if strings.EqualFold(c, currency) {
+			return currency, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+}
+
+// Service converts prices between currencies. It implements
+// types.CurrencyService.
+type Service struct {
+	store types.CurrencyStore
+}
+
+func NewService(store types.CurrencyStore) *Service {
+	return &Service{store: store}
+}
+
+func (s *Service) ExchangeRate(currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == types.DefaultCurrency() {
+		return 1, nil
+	}
+
+	rate, err := s.store.GetExchangeRate(currency)
+	if errors.Is(err, ErrRateNotFound) {
+		return 0, fmt.Errorf("%w: no exchange rate for %s", ErrUnsupportedCurrency, currency)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return rate.Rate, nil
+}
+
+func (s *Service) Convert(amount types.Money, currency string) (types.Money, error) {
+	currency = strings.ToUpper(currency)
+	if amount.IsZero() {
+		return types.NewMoney(0, currency), nil
+	}
+	if amount.Currency == currency {
+		return amount, nil
+	}
+
+	from, err := s.ExchangeRate(amount.Currency)
+	if err != nil {
+		return types.Money{}, err
+	}
+	to, err := s.ExchangeRate(currency)
+	if err != nil {
+		return types.Money{}, err
+	}
+
+	return amount.Convert(currency, to/from), nil
+}
+
+func (s *Service) LocalizePrices(currency string, products ...*types.Product) error {
+	currency = strings.ToUpper(currency)
+	if currency == types.DefaultCurrency() || len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+
+	prices, err := s.store.GetPricesInCurrency(currency, ids)
+	if err != nil {
+		return err
+	}
+
+	// The exchange rate is only needed for products without a price list
+	// entry, and only has to exist if there are any.
+	var rate float64
+	for _, p := range products {
+		if price, ok := prices[p.ID]; ok {
+			p.Price = price
+		} else {
+			if rate == 0 {
+				if rate, err = s.ExchangeRate(currency); err != nil {
+					return err
+				}
+			}
+			p.Price = p.Price.Convert(currency, rate)
+		}
+		p.Currency = currency
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package currency
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"backend/types"
+	"backend/utils"
+)
+
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetExchangeRates() ([]types.ExchangeRate, error) {
+	rows, err := s.db.Query("SELECT currency, rate, updated_at FROM exchange_rates ORDER BY currency")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []types.ExchangeRate{}
+	for rows.Next() {
+		var r types.ExchangeRate
+		if err := rows.Scan(&r.Currency, &r.Rate, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+
+	return rates, rows.Err()
+}
+
+func (s *Store) GetExchangeRate(currency string) (*types.ExchangeRate, error) {
+	r := new(types.ExchangeRate)
+	err := s.db.QueryRow("SELECT currency, rate, updated_at FROM exchange_rates WHERE currency = ?", currency).Scan(&r.Currency, &r.Rate, &r.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (s *Store) SetExchangeRate(currency string, rate float64) error {
+	_, err := s.db.Exec("INSERT INTO exchange_rates (currency, rate) VALUES (?, ?) ON DUPLICATE KEY UPDATE rate = VALUES(rate)", currency, rate)
+	return err
+}
+
+func (s *Store) GetProductPrices(productID int) ([]types.ProductPrice, error) {
+	rows, err := s.db.Query("SELECT product_id, currency, price FROM product_prices WHERE product_id = ? ORDER BY currency", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := []types.ProductPrice{}
+	for rows.Next() {
+		var p types.ProductPrice
+		if err := rows.Scan(&p.ProductID, &p.Currency, &p.Price); err != nil {
+			return nil, err
+		}
+		p.Price = p.Price.In(p.Currency)
+		prices = append(prices, p)
+	}
+
+	return prices, rows.Err()
+}
+
+func (s *Store) GetPricesInCurrency(currency string, productIDs []int) (map[int]types.Money, error) {
+	prices := make(map[int]types.Money)
+	if len(productIDs) == 0 {
+		return prices, nil
+	}
+
+	in, ids := utils.InClause(productIDs)
+	query := fmt.Sprintf("SELECT product_id, price FROM product_prices WHERE currency = ? AND product_id IN %s", in)
+
+	rows, err := s.db.Query(query, append([]any{currency}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var price types.Money
+		if err := rows.Scan(&id, &price); err != nil {
+			return nil, err
+		}
+		prices[id] = price.In(currency)
+	}
+
+	return prices, rows.Err()
+}
+
+func (s *Store) SetProductPrice(p types.ProductPrice) error {
+	_, err := s.db.Exec("INSERT INTO product_prices (product_id, currency, price) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE price = VALUES(price)", p.ProductID, p.Currency, p.Price)
+	return err
+}
+
+func (s *Store) DeleteProductPrice(productID int, currency string) error {
+	_, err := s.db.Exec("DELETE FROM product_prices WHERE product_id = ? AND currency = ?", productID, currency)
+	return err
+}
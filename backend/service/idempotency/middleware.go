@@ -0,0 +1,186 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/config"
+	"backend/service/auth"
+	"backend/service/currency"
+	"backend/types"
+	"backend/utils"
+)
+
+// Header is the request header carrying the client's idempotency key.
+const Header = "Idempotency-Key"
+
+const maxKeyLength = 255
+
+var (
+	errKeyReused     = errors.New("idempotency key was already used for a different request")
+	errKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// WithIdempotencyKey makes requests carrying an Idempotency-Key header safe to
+// retry. The first request with a key runs and its response is recorded; a
+// retry with the same key gets the recorded response back without running
+// the handler again. Keys are per user and expire after
+// IDEMPOTENCY_KEY_EXPIRATION. Like auth.WithRole it must be wrapped by
+// auth.WithJWTAuth.
+func WithIdempotencyKey(handlerFunc http.HandlerFunc, store types.IdempotencyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			handlerFunc(w, r)
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s must be at most %d characters", Header, maxKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		userID := auth.GetUserIDFromContext(r.Context())
+		record, created, err := claimKey(store, userID, key, requestHash(r, body))
+		if errors.Is(err, errKeyReused) {
+			utils.WriteError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if errors.Is(err, errKeyInProgress) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !created {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.ResponseStatus)
+			w.Write(record.ResponseBody)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		handlerFunc(rec, r)
+
+		// Server errors roll back whatever the request did, so the key is
+		// released and the client may retry.
+		if rec.status >= http.StatusInternalServerError {
+			if err := store.DeleteIdempotencyKey(record.ID); err != nil {
+				log.Printf("failed to release idempotency key %d: %v", record.ID, err)
+			}
+			return
+		}
+
+		if err := store.SaveIdempotencyResponse(record.ID, rec.status, rec.body.Bytes()); err != nil {
+			log.Printf("failed to record response for idempotency key %d: %v", record.ID, err)
+		}
+	}
+}
+
+// claimKey stores key for the request with the given hash. If the user
+// already used the key, the earlier record is returned instead, provided it
+// belongs to the same request and has a response; an expired key is
+// replaced.
+func claimKey(store types.IdempotencyStore, userID int, key, hash string) (*types.IdempotencyKey, bool, error) {
+	expiry := time.Duration(config.Envs.IdempotencyKeyExpirationInSeconds) * time.Second
+
+	for attempt := 0; attempt < 2; attempt++ {
+		created, err := store.CreateIdempotencyKey(types.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: hash,
+			ExpiresAt:   time.Now().Add(expiry),
+		})
+		if err != nil {
+			return nil, false, err
+		}
+
+		record, err := store.GetIdempotencyKey(userID, key)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if created {
+			return record, true, nil
+		}
+
+		if record.ExpiresAt.Before(time.Now()) {
+			if err := store.DeleteIdempotencyKey(record.ID); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+
+		if record.RequestHash != hash {
+			return nil, false, errKeyReused
+		}
+		if record.ResponseStatus == 0 {
+			return nil, false, errKeyInProgress
+		}
+		return record, false, nil
+	}
+
+	// Another request replaced the expired key first.
+	return nil, false, errKeyInProgress
+}
+
+// requestHash identifies a request by its method, path, query, currency and
+// body, so a key reused for another endpoint, or to price the same payload
+// in another currency, counts as a different request too.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n%s\n", r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get(currency.Header))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// PurgeExpired deletes expired keys every interval. It never returns and is
+// meant to run in its own goroutine.
+func PurgeExpired(store types.IdempotencyStore, interval time.Duration) {
+	for range time.Tick(interval) {
+		n, err := store.DeleteExpiredIdempotencyKeys(time.Now())
+		if err != nil {
+			log.Printf("failed to purge expired idempotency keys: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("purged %d expired idempotency keys", n)
+		}
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of its
+// status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,172 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/service/auth"
+	"backend/service/currency"
+	"backend/types"
+	"backend/utils"
+)
+
+func TestWithIdempotencyKey(t *testing.T) {
+	store := &mockIdempotencyStore{}
+	calls := 0
+	status := http.StatusCreated
+	handler := WithIdempotencyKey(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		utils.WriteJSON(w, status, map[string]int{"order_id": calls})
+	}, store)
+
+	send := func(userID int, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(Header, key)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	t.Run("should run every request without a key", func(t *testing.T) {
+		send(1, "", `{}`)
+		send(1, "", `{}`)
+		if calls != 2 {
+			t.Errorf("Expected the handler to run 2 times, ran %d", calls)
+		}
+	})
+
+	t.Run("should replay the response to a retried request", func(t *testing.T) {
+		calls = 0
+		first := send(1, "key-1", `{"items":[1]}`)
+		retry := send(1, "key-1", `{"items":[1]}`)
+
+		if calls != 1 {
+			t.Errorf("Expected the handler to run once, ran %d", calls)
+		}
+		if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+			t.Errorf("Expected the recorded response %d %s, got %d %s", first.Code, first.Body, retry.Code, retry.Body)
+		}
+		if retry.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("Expected the retry to be marked as replayed")
+		}
+	})
+
+	t.Run("should reject a key reused with a different payload", func(t *testing.T) {
+		rr := send(1, "key-1", `{"items":[2]}`)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+		}
+	})
+
+	t.Run("should reject a key reused with a different query or currency", func(t *testing.T) {
+		tests := []struct {
+			path     string
+			currency string
+		}{
+			{"/checkout?coupon=SAVE10", ""},
+			{"/checkout", "EUR"},
+		}
+
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(`{"items":[1]}`))
+			req.Header.Set(Header, "key-1")
+			req.Header.Set(currency.Header, tt.currency)
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Errorf("Expected status code %d for %s in %q, got %d", http.StatusUnprocessableEntity, tt.path, tt.currency, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should scope keys to the user", func(t *testing.T) {
+		calls = 0
+		rr := send(2, "key-1", `{"items":[2]}`)
+		if rr.Code != http.StatusCreated || calls != 1 {
+			t.Errorf("Expected another user's request to run, got %d after %d calls", rr.Code, calls)
+		}
+	})
+
+	t.Run("should refuse a retry while the request is in progress", func(t *testing.T) {
+		hash := requestHash(httptest.NewRequest(http.MethodPost, "/checkout", nil), []byte(`{}`))
+		store.CreateIdempotencyKey(types.IdempotencyKey{UserID: 1, Key: "key-2", RequestHash: hash, ExpiresAt: time.Now().Add(time.Hour)})
+
+		rr := send(1, "key-2", `{}`)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should release the key after a server error", func(t *testing.T) {
+		calls = 0
+		status = http.StatusInternalServerError
+		send(1, "key-3", `{}`)
+
+		status = http.StatusCreated
+		rr := send(1, "key-3", `{}`)
+		if rr.Code != http.StatusCreated || calls != 2 {
+			t.Errorf("Expected the retry to run, got %d after %d calls", rr.Code, calls)
+		}
+	})
+
+	t.Run("should run the request again once the key expired", func(t *testing.T) {
+		calls = 0
+		send(1, "key-4", `{}`)
+		k, _ := store.GetIdempotencyKey(1, "key-4")
+		k.ExpiresAt = time.Now().Add(-time.Minute)
+
+		rr := send(1, "key-4", `{"items":[3]}`)
+		if rr.Code != http.StatusCreated || calls != 2 {
+			t.Errorf("Expected the request to run, got %d after %d calls", rr.Code, calls)
+		}
+	})
+}
+
+type mockIdempotencyStore struct {
+	keys []*types.IdempotencyKey
+}
+
+func (m *mockIdempotencyStore) CreateIdempotencyKey(k types.IdempotencyKey) (bool, error) {
+	if _, err := m.GetIdempotencyKey(k.UserID, k.Key); err == nil {
+		return false, nil
+	}
+	k.ID = len(m.keys) + 1
+	m.keys = append(m.keys, &k)
+	return true, nil
+}
+
+func (m *mockIdempotencyStore) GetIdempotencyKey(userID int, key string) (*types.IdempotencyKey, error) {
+	for _, k := range m.keys {
+		if k != nil && k.UserID == userID && k.Key == key {
+			return k, nil
+		}
+	}
+	return nil, errKeyNotFound
+}
+
+func (m *mockIdempotencyStore) SaveIdempotencyResponse(id int, status int, body []byte) error {
+	if m.keys[id-1] == nil {
+		return fmt.Errorf("key %d not found", id)
+	}
+	m.keys[id-1].ResponseStatus = status
+	m.keys[id-1].ResponseBody = body
+	return nil
+}
+
+func (m *mockIdempotencyStore) DeleteIdempotencyKey(id int) error {
+	m.keys[id-1] = nil
+	return nil
+}
+
+func (m *mockIdempotencyStore) DeleteExpiredIdempotencyKeys(before time.Time) (int64, error) {
+	return 0, nil
+}
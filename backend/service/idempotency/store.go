@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"backend/types"
+)
+
+var errKeyNotFound = errors.New("idempotency key not found")
+
+const keyColumns = "id, user_id, idempotency_key, request_hash, response_status, response_body, expires_at, created_at"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateIdempotencyKey(k types.IdempotencyKey) (bool, error) {
+	// Without CLIENT_FOUND_ROWS a duplicate key update that changes nothing
+	// reports zero affected rows.
+	res, err := s.db.Exec(
+		"INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, expires_at) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE id = id",
+		k.UserID, k.Key, k.RequestHash, k.ExpiresAt,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (s *Store) GetIdempotencyKey(userID int, key string) (*types.IdempotencyKey, error) {
+	k, err := scanRowsIntoKey(s.db.QueryRow("SELECT "+keyColumns+" FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?", userID, key))
+	if err == sql.ErrNoRows {
+		return nil, errKeyNotFound
+	}
+	return k, err
+}
+
+func (s *Store) SaveIdempotencyResponse(id int, status int, body []byte) error {
+	_, err := s.db.Exec("UPDATE idempotency_keys SET response_status = ?, response_body = ? WHERE id = ?", status, body, id)
+	return err
+}
+
+func (s *Store) DeleteIdempotencyKey(id int) error {
+	_, err := s.db.Exec("DELETE FROM idempotency_keys WHERE id = ?", id)
+	return err
+}
+
+func (s *Store) DeleteExpiredIdempotencyKeys(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM idempotency_keys WHERE expires_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanRowsIntoKey(rows interface{ Scan(dest ...any) error }) (*types.IdempotencyKey, error) {
+	k := new(types.IdempotencyKey)
+
+	err := rows.Scan(
+		&k.ID,
+		&k.UserID,
+		&k.Key,
+		&k.RequestHash,
+		&k.ResponseStatus,
+		&k.ResponseBody,
+		&k.ExpiresAt,
+		&k.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
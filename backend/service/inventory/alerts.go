@@ -0,0 +1,86 @@
+package inventory
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"backend/config"
+	"backend/types"
+)
+
+// Alerts tells staff when products run low and customers when products they
+// asked about can be bought again. Both go by available stock, so stock
+// held for unpaid orders does not count.
+type Alerts struct {
+	store    types.StockAlertStore
+	notifier types.StockNotifier
+	mailer   types.Mailer
+}
+
+func NewAlerts(store types.StockAlertStore, notifier types.StockNotifier, mailer types.Mailer) *Alerts {
+	return &Alerts{store: store, notifier: notifier, mailer: mailer}
+}
+
+// Check sends the alerts that are due. A product alerts staff once when it
+// falls to its reorder threshold and again only after it has been restocked
+// above it; each subscription is emailed once.
+func (a *Alerts) Check() error {
+	if err := a.store.ClearRestockedAlerts(); err != nil {
+		return err
+	}
+
+	low, err := a.store.GetNewLowStock()
+	if err != nil {
+		return err
+	}
+	if len(low) > 0 {
+		if err := a.notifier.NotifyLowStock(low); err != nil {
+			return err
+		}
+
+		ids := make([]int, len(low))
+		for i, l := range low {
+			ids[i] = l.ProductID
+		}
+		if err := a.store.MarkLowStockAlerted(ids); err != nil {
+			return err
+		}
+	}
+
+	subscriptions, err := a.store.GetDueStockSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subscriptions {
+		if err := a.sendBackInStock(sub); err != nil {
+			log.Printf("failed to email back in stock subscription %d: %v", sub.ID, err)
+			continue
+		}
+		if err := a.store.MarkStockSubscriptionNotified(sub.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Alerts) sendBackInStock(sub types.StockSubscription) error {
+	link := fmt.Sprintf("%s/products/%d", config.Envs.FrontendURL, sub.ProductID)
+	return a.mailer.Send(types.Message{
+		To:      sub.Email,
+		Subject: fmt.Sprintf("%s is back in stock", sub.ProductName),
+		Body:    fmt.Sprintf("Hi %s,\n\n%s is back in stock. Order it while it lasts:\n\n%s\n", sub.FirstName, sub.ProductName, link),
+	})
+}
+
+// WatchStock checks for due alerts every interval. It never returns and is
+// meant to run in its own goroutine.
+func WatchStock(a *Alerts, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := a.Check(); err != nil {
+			log.Printf("failed to send stock alerts: %v", err)
+		}
+	}
+}
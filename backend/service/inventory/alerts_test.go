@@ -0,0 +1,120 @@
+package inventory
+
+import (
+	"fmt"
+	"testing"
+
+	"backend/service/mail"
+	"backend/types"
+)
+
+func TestAlerts(t *testing.T) {
+	store := &mockAlertStore{
+		low:           []types.LowStockAlert{{ProductID: 1, Name: "Widget", Available: 2, Threshold: 5}},
+		subscriptions: []types.StockSubscription{{ID: 1, ProductID: 2, ProductName: "Gadget", Email: "jane@example.com", FirstName: "Jane"}},
+	}
+	notifier := &mockNotifier{}
+	mailer := mail.NewMemoryMailer()
+	alerts := NewAlerts(store, notifier, mailer)
+
+	if err := alerts.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should alert staff about low stock once", func(t *testing.T) {
+		if len(notifier.sent) != 1 || notifier.sent[0].ProductID != 1 {
+			t.Fatalf("Expected one alert for product 1, got %+v", notifier.sent)
+		}
+		if !store.alerted[1] {
+			t.Error("Expected product 1 to be marked as alerted")
+		}
+
+		alerts.Check()
+		if len(notifier.sent) != 1 {
+			t.Errorf("Expected no further alerts, got %+v", notifier.sent)
+		}
+	})
+
+	t.Run("should email subscribers once", func(t *testing.T) {
+		messages := mailer.Messages()
+		if len(messages) != 1 || messages[0].To != "jane@example.com" || messages[0].Subject != "Gadget is back in stock" {
+			t.Errorf("Expected one email to jane@example.com, got %+v", messages)
+		}
+		if !store.notified[1] {
+			t.Error("Expected subscription 1 to be marked as notified")
+		}
+	})
+
+	t.Run("should retry alerts the notifier failed to send", func(t *testing.T) {
+		store := &mockAlertStore{low: []types.LowStockAlert{{ProductID: 3, Available: 0, Threshold: 1}}}
+		alerts := NewAlerts(store, &mockNotifier{fail: true}, mailer)
+		if err := alerts.Check(); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+		if store.alerted[3] {
+			t.Error("Expected product 3 not to be marked as alerted")
+		}
+	})
+}
+
+type mockNotifier struct {
+	sent []types.LowStockAlert
+	fail bool
+}
+
+func (m *mockNotifier) NotifyLowStock(alerts []types.LowStockAlert) error {
+	if m.fail {
+		return fmt.Errorf("notifier unavailable")
+	}
+	m.sent = append(m.sent, alerts...)
+	return nil
+}
+
+type mockAlertStore struct {
+	low           []types.LowStockAlert
+	subscriptions []types.StockSubscription
+	alerted       map[int]bool
+	notified      map[int]bool
+}
+
+func (m *mockAlertStore) GetNewLowStock() ([]types.LowStockAlert, error) {
+	low := []types.LowStockAlert{}
+	for _, l := range m.low {
+		if !m.alerted[l.ProductID] {
+			low = append(low, l)
+		}
+	}
+	return low, nil
+}
+
+func (m *mockAlertStore) MarkLowStockAlerted(productIDs []int) error {
+	if m.alerted == nil {
+		m.alerted = map[int]bool{}
+	}
+	for _, id := range productIDs {
+		m.alerted[id] = true
+	}
+	return nil
+}
+
+func (m *mockAlertStore) ClearRestockedAlerts() error { return nil }
+
+func (m *mockAlertStore) CreateStockSubscription(productID, userID int) error { return nil }
+
+func (m *mockAlertStore) GetDueStockSubscriptions() ([]types.StockSubscription, error) {
+	due := []types.StockSubscription{}
+	for _, s := range m.subscriptions {
+		if !m.notified[s.ID] {
+			due = append(due, s)
+		}
+	}
+	return due, nil
+}
+
+func (m *mockAlertStore) MarkStockSubscriptionNotified(id int) error {
+	if m.notified == nil {
+		m.notified = map[int]bool{}
+	}
+	m.notified[id] = true
+	return nil
+}
@@ -0,0 +1,186 @@
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"backend/config"
+	"backend/types"
+)
+
+// NewAllocationStrategy returns the strategy selected by STOCK_ALLOCATION:
+// "single" (the default) ships an order from one location when one has all
+// of it, "nearest" ships every item from the nearest location that has all
+// of that item, and "split" draws on the nearest stock, splitting items
+// between locations wherever it runs out.
+func NewAllocationStrategy(cfg config.Config) (types.AllocationStrategy, error) {
+	switch cfg.StockAllocation {
+	case "single", "":
+		return SingleLocation{}, nil
+	case "nearest":
+		return Nearest{}, nil
+	case "split":
+		return Split{}, nil
+	default:
+		return nil, fmt.Errorf("unknown stock allocation strategy %q", cfg.StockAllocation)
+	}
+}
+
+// SingleLocation ships the whole order from the nearest location that has
+// all of it, so that it goes out as one parcel, and falls back to Nearest
+// when none does.
+type SingleLocation struct{}
+
+func (SingleLocation) Allocate(items []types.CartCheckoutItem, locations []types.StockLocation, stock []types.LocationStock) ([]types.Allocation, error) {
+	available := availableStock(stock)
+
+	for _, l := range locations {
+		if !hasAll(available, l.ID, items) {
+			continue
+		}
+
+		allocations := make([]types.Allocation, len(items))
+		for i, item := range items {
+			allocations[i] = types.Allocation{LocationID: l.ID, ProductID: item.ProductID, Quantity: item.Quantity}
+		}
+		return allocations, nil
+	}
+
+	return Nearest{}.Allocate(items, locations, stock)
+}
+
+// hasAll reports whether location has enough of every one of items, counting
+// items of the same product together.
+func hasAll(available map[[2]int]int, locationID int, items []types.CartCheckoutItem) bool {
+	wanted := map[int]int{}
+	for _, item := range items {
+		wanted[item.ProductID] += item.Quantity
+	}
+	for productID, quantity := range wanted {
+		if available[[2]int{locationID, productID}] < quantity {
+			return false
+		}
+	}
+	return true
+}
+
+// Nearest ships every item from the nearest location that has all of it,
+// only splitting an item between locations when none does.
+type Nearest struct{}
+
+func (Nearest) Allocate(items []types.CartCheckoutItem, locations []types.StockLocation, stock []types.LocationStock) ([]types.Allocation, error) {
+	available := availableStock(stock)
+
+	var allocations []types.Allocation
+	for _, item := range items {
+		whole := false
+		for _, l := range locations {
+			key := [2]int{l.ID, item.ProductID}
+			if available[key] >= item.Quantity {
+				available[key] -= item.Quantity
+				allocations = append(allocations, types.Allocation{LocationID: l.ID, ProductID: item.ProductID, Quantity: item.Quantity})
+				whole = true
+				break
+			}
+		}
+		if whole {
+			continue
+		}
+
+		split, err := drain(available, locations, item)
+		if err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, split...)
+	}
+
+	return allocations, nil
+}
+
+// Split draws every item from the nearest stock, moving on to the next
+// location wherever it runs out.
+type Split struct{}
+
+func (Split) Allocate(items []types.CartCheckoutItem, locations []types.StockLocation, stock []types.LocationStock) ([]types.Allocation, error) {
+	available := availableStock(stock)
+
+	var allocations []types.Allocation
+	for _, item := range items {
+		split, err := drain(available, locations, item)
+		if err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, split...)
+	}
+
+	return allocations, nil
+}
+
+// drain takes item from the stock available at locations in order, taking
+// what it uses out of available.
+func drain(available map[[2]int]int, locations []types.StockLocation, item types.CartCheckoutItem) ([]types.Allocation, error) {
+	var allocations []types.Allocation
+	remaining := item.Quantity
+	for _, l := range locations {
+		key := [2]int{l.ID, item.ProductID}
+		take := min(available[key], remaining)
+		if take <= 0 {
+			continue
+		}
+
+		available[key] -= take
+		remaining -= take
+		allocations = append(allocations, types.Allocation{LocationID: l.ID, ProductID: item.ProductID, Quantity: take})
+		if remaining == 0 {
+			return allocations, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: product %d is not available in the quantity requested", ErrInsufficientStock, item.ProductID)
+}
+
+// availableStock maps location and product IDs to the stock left to sell.
+func availableStock(stock []types.LocationStock) map[[2]int]int {
+	available := make(map[[2]int]int, len(stock))
+	for _, st := range stock {
+		available[[2]int{st.LocationID, st.ProductID}] += max(st.OnHand-st.Reserved, 0)
+	}
+	return available
+}
+
+// nearest returns the active locations, nearest to address first. Without
+// coordinates, a location in the address's region is nearer than one
+// elsewhere in its country, which is nearer than one abroad; locations
+// equally near are taken by priority.
+func nearest(locations []types.StockLocation, address types.PostalAddress) []types.StockLocation {
+	active := []types.StockLocation{}
+	for _, l := range locations {
+		if l.Active {
+			active = append(active, l)
+		}
+	}
+
+	distance := func(l types.StockLocation) int {
+		if !strings.EqualFold(l.Country, address.Country) {
+			return 2
+		}
+		if l.Region == "" || !strings.EqualFold(l.Region, address.Region) {
+			return 1
+		}
+		return 0
+	}
+
+	sort.SliceStable(active, func(i, j int) bool {
+		di, dj := distance(active[i]), distance(active[j])
+		if di != dj {
+			return di < dj
+		}
+		if active[i].Priority != active[j].Priority {
+			return active[i].Priority < active[j].Priority
+		}
+		return active[i].ID < active[j].ID
+	})
+
+	return active
+}
@@ -0,0 +1,115 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+
+	"backend/types"
+)
+
+func TestNearest(t *testing.T) {
+	locations := []types.StockLocation{
+		{ID: 1, Country: "US", Region: "CA", Priority: 0, Active: true},
+		{ID: 2, Country: "US", Region: "NY", Priority: 1, Active: true},
+		{ID: 3, Country: "DE", Priority: 0, Active: true},
+		{ID: 4, Country: "US", Region: "NY", Priority: 0, Active: false},
+		{ID: 5, Country: "US", Priority: 0, Active: true},
+	}
+
+	t.Run("should order active locations by region, country and priority", func(t *testing.T) {
+		got := ids(nearest(locations, types.PostalAddress{Country: "US", Region: "NY"}))
+		if want := []int{2, 1, 5, 3}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("should fall back to priority abroad", func(t *testing.T) {
+		got := ids(nearest(locations, types.PostalAddress{Country: "FR"}))
+		if want := []int{1, 3, 5, 2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	})
+}
+
+func TestAllocate(t *testing.T) {
+	locations := []types.StockLocation{{ID: 1, Active: true}, {ID: 2, Active: true}}
+	stock := []types.LocationStock{
+		{LocationID: 1, ProductID: 1, OnHand: 5, Reserved: 2},
+		{LocationID: 1, ProductID: 2, OnHand: 1},
+		{LocationID: 2, ProductID: 1, OnHand: 4},
+		{LocationID: 2, ProductID: 2, OnHand: 4},
+	}
+	items := []types.CartCheckoutItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 2}}
+
+	tests := []struct {
+		name     string
+		strategy types.AllocationStrategy
+		items    []types.CartCheckoutItem
+		want     []types.Allocation
+	}{
+		{
+			name:     "should ship from one location when one has everything",
+			strategy: SingleLocation{},
+			items:    items,
+			want: []types.Allocation{
+				{LocationID: 2, ProductID: 1, Quantity: 3},
+				{LocationID: 2, ProductID: 2, Quantity: 2},
+			},
+		},
+		{
+			name:     "should ship each item from the nearest location that has it",
+			strategy: Nearest{},
+			items:    items,
+			want: []types.Allocation{
+				{LocationID: 1, ProductID: 1, Quantity: 3},
+				{LocationID: 2, ProductID: 2, Quantity: 2},
+			},
+		},
+		{
+			name:     "should split items across locations",
+			strategy: Split{},
+			items:    items,
+			want: []types.Allocation{
+				{LocationID: 1, ProductID: 1, Quantity: 3},
+				{LocationID: 1, ProductID: 2, Quantity: 1},
+				{LocationID: 2, ProductID: 2, Quantity: 1},
+			},
+		},
+		{
+			name:     "should split an item no location has enough of",
+			strategy: SingleLocation{},
+			items:    []types.CartCheckoutItem{{ProductID: 1, Quantity: 6}},
+			want: []types.Allocation{
+				{LocationID: 1, ProductID: 1, Quantity: 3},
+				{LocationID: 2, ProductID: 1, Quantity: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.strategy.Allocate(tt.items, locations, stock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("should fail when there is not enough stock", func(t *testing.T) {
+		items := []types.CartCheckoutItem{{ProductID: 1, Quantity: 8}}
+		if _, err := (Split{}).Allocate(items, locations, stock); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
+
+func ids(locations []types.StockLocation) []int {
+	ids := make([]int, len(locations))
+	for i, l := range locations {
+		ids[i] = l.ID
+	}
+	return ids
+}
@@ -0,0 +1,374 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/config"
+	"backend/service/auth"
+	"backend/types"
+	"backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store         types.ReservationStore
+	locationStore types.StockLocationStore
+	movementStore types.StockMovementStore
+	alertStore    types.StockAlertStore
+	userStore     types.UserStore
+}
+
+func NewHandler(
+	store types.ReservationStore,
+	locationStore types.StockLocationStore,
+	movementStore types.StockMovementStore,
+	alertStore types.StockAlertStore,
+	userStore types.UserStore,
+) *Handler {
+	return &Handler{
+		store:         store,
+		locationStore: locationStore,
+		movementStore: movementStore,
+		alertStore:    alertStore,
+		userStore:     userStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/products/{productID}/notify-me", auth.WithJWTAuth(h.handleNotifyMe, h.userStore)).Methods(http.MethodPost)
+
+	router.HandleFunc("/admin/inventory", auth.WithJWTAuth(auth.WithRole(h.handleGetStockLevels, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/inventory/reconciliation", auth.WithJWTAuth(auth.WithRole(h.handleGetDiscrepancies, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/inventory/{productID}", auth.WithJWTAuth(auth.WithRole(h.handleGetStockLevel, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+
+	router.HandleFunc("/admin/stock-locations", auth.WithJWTAuth(auth.WithRole(h.handleGetStockLocations, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/stock-locations", auth.WithJWTAuth(auth.WithRole(h.handleCreateStockLocation, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/stock-locations/{locationID}", auth.WithJWTAuth(auth.WithRole(h.handleUpdateStockLocation, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPut)
+
+	router.HandleFunc("/admin/stock-transfers", auth.WithJWTAuth(auth.WithRole(h.handleTransferStock, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/stock-movements", auth.WithJWTAuth(auth.WithRole(h.handleGetStockMovements, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+}
+
+// handleNotifyMe subscribes the user to an email for when a product that is
+// out of stock can be bought again.
+func (h *Handler) handleNotifyMe(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	levels, err := h.store.GetStockLevels(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(levels) == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
+	if levels[0].Available > 0 {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("product %d is in stock", productID))
+		return
+	}
+
+	userID := auth.GetUserIDFromContext(r.Context())
+	if err := h.alertStore.CreateStockSubscription(productID, userID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleGetStockLevels(w http.ResponseWriter, r *http.Request) {
+	levels, err := h.store.GetStockLevels()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, levels)
+}
+
+// handleGetDiscrepancies lists the products whose quantity does not agree
+// with their ledger or with the stock their locations hold.
+func (h *Handler) handleGetDiscrepancies(w http.ResponseWriter, r *http.Request) {
+	reconciliations, err := h.movementStore.ReconcileStock()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	discrepancies := []types.StockReconciliation{}
+	for _, rec := range reconciliations {
+		if !rec.Reconciled {
+			discrepancies = append(discrepancies, rec)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, discrepancies)
+}
+
+// handleGetStockLevel returns a product's stock level along with where it is
+// kept and the reservations holding it.
+func (h *Handler) handleGetStockLevel(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	levels, err := h.store.GetStockLevels(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(levels) == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
+
+	locations, err := h.locationStore.GetLocationStock(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	reservations, err := h.store.GetActiveReservations(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"stock":        levels[0],
+		"locations":    locations,
+		"reservations": reservations,
+	})
+}
+
+func (h *Handler) handleGetStockLocations(w http.ResponseWriter, r *http.Request) {
+	locations, err := h.locationStore.GetStockLocations()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, locations)
+}
+
+func (h *Handler) handleCreateStockLocation(w http.ResponseWriter, r *http.Request) {
+	var payload types.StockLocationPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	location, err := locationFromPayload(&types.StockLocation{Active: true}, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if status, err := h.checkCodeIsFree(location); err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	location.ID, err = h.locationStore.CreateStockLocation(*location)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, location)
+}
+
+// handleUpdateStockLocation edits a location. Locations are never deleted,
+// since the ledger refers to them; deactivating one stops checkout
+// allocating from it.
+func (h *Handler) handleUpdateStockLocation(w http.ResponseWriter, r *http.Request) {
+	locationID, err := strconv.Atoi(mux.Vars(r)["locationID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid stock location ID"))
+		return
+	}
+
+	existing, err := h.locationStore.GetStockLocationByID(locationID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var payload types.StockLocationPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	location, err := locationFromPayload(existing, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if status, err := h.checkCodeIsFree(location); err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	if err := h.locationStore.UpdateStockLocation(*location); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, location)
+}
+
+// checkCodeIsFree fails with the status to report if another location
+// already has location's code.
+func (h *Handler) checkCodeIsFree(location *types.StockLocation) (int, error) {
+	locations, err := h.locationStore.GetStockLocations()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	for _, l := range locations {
+		if l.ID != location.ID && strings.EqualFold(l.Code, location.Code) {
+			return http.StatusConflict, fmt.Errorf("stock location code %s is already in use", location.Code)
+		}
+	}
+
+	return 0, nil
+}
+
+// locationFromPayload validates payload and applies it to location, a new
+// location or the one being updated.
+func locationFromPayload(location *types.StockLocation, payload types.StockLocationPayload) (*types.StockLocation, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return nil, fmt.Errorf("invalid payload: %v", errors)
+	}
+
+	location.Name = payload.Name
+	location.Code = strings.ToUpper(payload.Code)
+	location.Country = strings.ToUpper(payload.Country)
+	location.Region = strings.TrimSpace(payload.Region)
+	location.Priority = payload.Priority
+	if payload.Active != nil {
+		location.Active = *payload.Active
+	}
+
+	return location, nil
+}
+
+func (h *Handler) handleTransferStock(w http.ResponseWriter, r *http.Request) {
+	var payload types.StockTransferPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	for _, id := range []int{payload.FromLocationID, payload.ToLocationID} {
+		if _, err := h.locationStore.GetStockLocationByID(id); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("stock location %d not found", id))
+			return
+		}
+	}
+
+	movement := types.StockMovement{
+		ProductID:      payload.ProductID,
+		FromLocationID: payload.FromLocationID,
+		ToLocationID:   payload.ToLocationID,
+		Quantity:       payload.Quantity,
+		Reason:         types.StockMovementTransfer,
+		ActorID:        auth.GetUserIDFromContext(r.Context()),
+		Note:           payload.Note,
+	}
+
+	id, err := h.movementStore.TransferStock(movement)
+	if errors.Is(err, ErrInsufficientStock) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	movement.ID = id
+
+	utils.WriteJSON(w, http.StatusCreated, movement)
+}
+
+// handleGetStockMovements pages through the ledger, newest first, optionally
+// narrowed down to a product or location.
+func (h *Handler) handleGetStockMovements(w http.ResponseWriter, r *http.Request) {
+	secret := []byte(config.Envs.CursorSecret)
+
+	query := r.URL.Query()
+	filter := types.StockMovementFilter{Page: types.Page{Limit: 50}}
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 200 {
+		filter.Limit = l
+	}
+	if v := query.Get("product_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+			return
+		}
+		filter.ProductID = id
+	}
+	if v := query.Get("location_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid stock location ID"))
+			return
+		}
+		filter.LocationID = id
+	}
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := utils.DecodeCursor(secret, types.CursorStockMovements, v)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.Cursor = cursor
+	}
+
+	// One extra row tells whether there is another page.
+	fetch := filter
+	fetch.Limit++
+	movements, err := h.movementStore.GetStockMovements(fetch)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	movements, hasNext, hasPrev := utils.TrimPage(movements, filter.Page)
+
+	nextCursor, prevCursor, err := utils.PageCursors(secret, movements, hasNext, hasPrev, func(m types.StockMovement) types.Cursor {
+		return types.Cursor{Kind: types.CursorStockMovements, ID: m.ID}
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"movements":   movements,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	})
+}
@@ -0,0 +1,266 @@
+package inventory
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"backend/config"
+	"backend/types"
+)
+
+// Service holds stock for orders through reservations while they await
+// payment. It implements types.InventoryService.
+type Service struct {
+	store      types.ReservationStore
+	locations  types.StockLocationStore
+	movements  types.StockMovementStore
+	orderStore types.OrderStore
+	strategy   types.AllocationStrategy
+	transactor types.Transactor
+}
+
+func NewService(
+	store types.ReservationStore,
+	locations types.StockLocationStore,
+	movements types.StockMovementStore,
+	orderStore types.OrderStore,
+	strategy types.AllocationStrategy,
+	transactor types.Transactor,
+) *Service {
+	return &Service{
+		store:      store,
+		locations:  locations,
+		movements:  movements,
+		orderStore: orderStore,
+		strategy:   strategy,
+		transactor: transactor,
+	}
+}
+
+func (s *Service) Reserve(tx types.Tx, orderID int, items []types.CartCheckoutItem, address types.PostalAddress) error {
+	locations, err := s.locations.GetStockLocations()
+	if err != nil {
+		return err
+	}
+
+	productIDs := make([]int, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+	}
+
+	stock, err := s.store.GetLocationStockForUpdate(tx, productIDs)
+	if err != nil {
+		return err
+	}
+
+	allocations, err := s.strategy.Allocate(items, nearest(locations, address), stock)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(config.Envs.ReservationExpirationInSeconds) * time.Second)
+	for _, a := range allocations {
+		err := s.store.CreateReservation(tx, types.StockReservation{
+			ProductID:  a.ProductID,
+			LocationID: a.LocationID,
+			OrderID:    orderID,
+			Quantity:   a.Quantity,
+			ExpiresAt:  expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) Commit(tx types.Tx, orderID int) error {
+	reservations, err := s.store.GetOrderReservationsForUpdate(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reservations {
+		if r.Status != types.ReservationActive {
+			continue
+		}
+
+		_, err := s.movements.RecordMovement(tx, types.StockMovement{
+			ProductID:      r.ProductID,
+			FromLocationID: r.LocationID,
+			Quantity:       r.Quantity,
+			Reason:         types.StockMovementSale,
+			OrderID:        orderID,
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.store.UpdateReservationStatus(tx, r.ID, types.ReservationCommitted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) Release(tx types.Tx, orderID int) (bool, error) {
+	reservations, err := s.store.GetOrderReservationsForUpdate(tx, orderID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, r := range reservations {
+		switch r.Status {
+		case types.ReservationActive:
+		case types.ReservationCommitted:
+			_, err := s.movements.RecordMovement(tx, types.StockMovement{
+				ProductID:    r.ProductID,
+				ToLocationID: r.LocationID,
+				Quantity:     r.Quantity,
+				Reason:       types.StockMovementReturn,
+				OrderID:      orderID,
+			})
+			if err != nil {
+				return false, err
+			}
+		default:
+			continue
+		}
+
+		if err := s.store.UpdateReservationStatus(tx, r.ID, types.ReservationReleased); err != nil {
+			return false, err
+		}
+	}
+
+	return len(reservations) > 0, nil
+}
+
+// Adjust turns a into a movement into or out of its location, defaulting to
+// the active location with the lowest priority.
+func (s *Service) Adjust(tx types.Tx, a types.StockAdjustment) (*types.StockMovement, error) {
+	if a.Quantity == 0 {
+		return nil, fmt.Errorf("stock adjustment of product %d changes nothing", a.ProductID)
+	}
+
+	if a.LocationID != 0 {
+		if _, err := s.locations.GetStockLocationByID(a.LocationID); err != nil {
+			return nil, err
+		}
+	} else {
+		locations, err := s.locations.GetStockLocations()
+		if err != nil {
+			return nil, err
+		}
+
+		// With no address, nearest sorts locations by priority alone.
+		active := nearest(locations, types.PostalAddress{})
+		if len(active) == 0 {
+			return nil, fmt.Errorf("there is no active stock location")
+		}
+		a.LocationID = active[0].ID
+	}
+
+	m := types.StockMovement{
+		ProductID: a.ProductID,
+		Quantity:  a.Quantity,
+		Reason:    a.Reason,
+		OrderID:   a.OrderID,
+		ActorID:   a.ActorID,
+		Note:      a.Note,
+	}
+	if a.Quantity > 0 {
+		m.ToLocationID = a.LocationID
+	} else {
+		m.FromLocationID = a.LocationID
+		m.Quantity = -a.Quantity
+	}
+
+	id, err := s.movements.RecordMovement(tx, m)
+	if err != nil {
+		return nil, err
+	}
+	m.ID = id
+
+	return &m, nil
+}
+
+// ReleaseExpired cancels the orders still awaiting payment whose
+// reservations expired before now, releasing their stock. Each order is
+// cancelled in a transaction of its own, so one failing does not hold the
+// others; it returns how many were cancelled.
+func (s *Service) ReleaseExpired(now time.Time) (int, error) {
+	orderIDs, err := s.store.GetOrdersWithExpiredReservations(now)
+	if err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	for _, id := range orderIDs {
+		ok, err := s.cancelExpired(id)
+		if err != nil {
+			log.Printf("failed to release expired reservations of order %d: %v", id, err)
+			continue
+		}
+		if ok {
+			cancelled++
+		}
+	}
+
+	return cancelled, nil
+}
+
+// cancelExpired cancels the order with orderID and releases its stock if it
+// is still awaiting payment. Payment may have raced the sweep and committed
+// the reservations already, in which case it leaves the order be.
+func (s *Service) cancelExpired(orderID int) (bool, error) {
+	tx, err := s.transactor.BeginTx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	order, err := s.orderStore.GetOrderForUpdate(tx, orderID)
+	if err != nil {
+		return false, err
+	}
+	if order.Status != types.OrderStatusPending {
+		return false, nil
+	}
+
+	if _, err := s.Release(tx, order.ID); err != nil {
+		return false, err
+	}
+
+	if err := s.orderStore.UpdateOrderStatus(tx, order.ID, types.OrderStatusCancelled); err != nil {
+		return false, err
+	}
+
+	err = s.orderStore.CreateOrderStatusChange(tx, types.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   types.OrderStatusCancelled,
+		Note:       "stock reservation expired before payment",
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// SweepExpired releases expired reservations every interval. It never
+// returns and is meant to run in its own goroutine.
+func SweepExpired(s *Service, interval time.Duration) {
+	for range time.Tick(interval) {
+		n, err := s.ReleaseExpired(time.Now())
+		if err != nil {
+			log.Printf("failed to release expired stock reservations: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("cancelled %d orders with expired stock reservations", n)
+		}
+	}
+}
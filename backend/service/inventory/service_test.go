@@ -0,0 +1,322 @@
+package inventory
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"backend/types"
+)
+
+func TestReleaseExpired(t *testing.T) {
+	now := time.Now()
+	orderStore := &mockOrderStore{orders: map[int]*types.Order{
+		1: {ID: 1, Status: types.OrderStatusPending},
+		2: {ID: 2, Status: types.OrderStatusPaid},
+	}}
+	store := &mockReservationStore{reservations: []types.StockReservation{
+		{ID: 1, ProductID: 1, LocationID: 1, OrderID: 1, Quantity: 2, Status: types.ReservationActive, ExpiresAt: now.Add(-time.Minute)},
+		{ID: 2, ProductID: 1, LocationID: 1, OrderID: 2, Quantity: 1, Status: types.ReservationActive, ExpiresAt: now.Add(-time.Minute)},
+		{ID: 3, ProductID: 1, LocationID: 1, OrderID: 3, Quantity: 1, Status: types.ReservationActive, ExpiresAt: now.Add(time.Minute)},
+	}, onHand: map[[2]int]int{{1, 1}: 5}}
+	service := NewService(store, store, store, orderStore, SingleLocation{}, mockTransactor{})
+
+	n, err := service.ReleaseExpired(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should cancel pending orders and release their stock", func(t *testing.T) {
+		if n != 1 || orderStore.orders[1].Status != types.OrderStatusCancelled {
+			t.Errorf("Expected order 1 alone to be cancelled, got %d cancelled and status %q", n, orderStore.orders[1].Status)
+		}
+		if s := store.reservations[0].Status; s != types.ReservationReleased {
+			t.Errorf("Expected reservation to be %q, got %q", types.ReservationReleased, s)
+		}
+		if len(orderStore.history) != 1 || orderStore.history[0].ActorID != 0 {
+			t.Errorf("Expected one status change by the system, got %+v", orderStore.history)
+		}
+		if q := store.onHand[[2]int{1, 1}]; q != 5 {
+			t.Errorf("Expected product quantity 5, got %d", q)
+		}
+	})
+
+	t.Run("should leave orders that are no longer pending", func(t *testing.T) {
+		if orderStore.orders[2].Status != types.OrderStatusPaid || store.reservations[1].Status != types.ReservationActive {
+			t.Errorf("Expected order 2 to be untouched, got status %q and reservation %q", orderStore.orders[2].Status, store.reservations[1].Status)
+		}
+	})
+
+	t.Run("should leave reservations that have not expired", func(t *testing.T) {
+		if s := store.reservations[2].Status; s != types.ReservationActive {
+			t.Errorf("Expected reservation to be %q, got %q", types.ReservationActive, s)
+		}
+	})
+}
+
+func TestCommitAndRelease(t *testing.T) {
+	store := &mockReservationStore{reservations: []types.StockReservation{
+		{ID: 1, ProductID: 1, LocationID: 1, OrderID: 1, Quantity: 2, Status: types.ReservationActive},
+		{ID: 2, ProductID: 2, LocationID: 2, OrderID: 1, Quantity: 3, Status: types.ReservationActive},
+	}, onHand: map[[2]int]int{{1, 1}: 5, {2, 2}: 3}}
+	service := NewService(store, store, store, nil, SingleLocation{}, mockTransactor{})
+
+	t.Run("should take committed stock off hand at its location", func(t *testing.T) {
+		if err := service.Commit(mockTx{}, 1); err != nil {
+			t.Fatal(err)
+		}
+		if store.onHand[[2]int{1, 1}] != 3 || store.onHand[[2]int{2, 2}] != 0 {
+			t.Errorf("Expected quantities of 3 and 0, got %v", store.onHand)
+		}
+		for _, m := range store.movements {
+			if m.Reason != types.StockMovementSale || m.OrderID != 1 || m.FromLocationID == 0 {
+				t.Errorf("Expected sales for order 1 in the ledger, got %+v", m)
+			}
+		}
+	})
+
+	t.Run("should put committed stock back when released", func(t *testing.T) {
+		reserved, err := service.Release(mockTx{}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reserved {
+			t.Error("Expected the order to have reservations")
+		}
+		if store.onHand[[2]int{1, 1}] != 5 || store.onHand[[2]int{2, 2}] != 3 {
+			t.Errorf("Expected quantities of 5 and 3, got %v", store.onHand)
+		}
+
+		// Releasing again must not restock twice.
+		service.Release(mockTx{}, 1)
+		if store.onHand[[2]int{1, 1}] != 5 {
+			t.Errorf("Expected product quantity 5, got %d", store.onHand[[2]int{1, 1}])
+		}
+	})
+
+	t.Run("should report orders without reservations", func(t *testing.T) {
+		reserved, err := service.Release(mockTx{}, 9)
+		if err != nil || reserved {
+			t.Errorf("Expected no reservations, got %v, %v", reserved, err)
+		}
+	})
+}
+
+func TestReserve(t *testing.T) {
+	store := &mockReservationStore{
+		locations: []types.StockLocation{
+			{ID: 1, Code: "MAIN", Country: "US", Priority: 0, Active: true},
+			{ID: 2, Code: "BER", Country: "DE", Priority: 1, Active: true},
+		},
+		onHand: map[[2]int]int{{1, 1}: 5, {2, 1}: 5},
+	}
+	service := NewService(store, store, store, nil, SingleLocation{}, mockTransactor{})
+	items := []types.CartCheckoutItem{{ProductID: 1, Quantity: 2}}
+
+	t.Run("should reserve stock at the location nearest the address", func(t *testing.T) {
+		err := service.Reserve(mockTx{}, 1, items, types.PostalAddress{Country: "DE"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(store.reservations) != 1 || store.reservations[0].LocationID != 2 {
+			t.Fatalf("Expected one reservation at location 2, got %+v", store.reservations)
+		}
+		if store.reservations[0].ExpiresAt.IsZero() {
+			t.Error("Expected the reservation to expire")
+		}
+	})
+
+	t.Run("should fail when there is not enough stock", func(t *testing.T) {
+		items := []types.CartCheckoutItem{{ProductID: 1, Quantity: 20}}
+		if err := service.Reserve(mockTx{}, 2, items, types.PostalAddress{Country: "US"}); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
+
+func TestAdjust(t *testing.T) {
+	newService := func() (*Service, *mockReservationStore) {
+		store := &mockReservationStore{
+			locations: []types.StockLocation{
+				{ID: 1, Priority: 1, Active: true},
+				{ID: 2, Priority: 0, Active: true},
+				{ID: 3, Priority: 0, Active: false},
+			},
+			onHand: map[[2]int]int{{1, 1}: 4},
+		}
+		return NewService(store, store, store, nil, SingleLocation{}, mockTransactor{}), store
+	}
+
+	t.Run("should add stock at the default location", func(t *testing.T) {
+		service, store := newService()
+		m, err := service.Adjust(mockTx{}, types.StockAdjustment{ProductID: 1, Quantity: 3, Reason: types.StockMovementRestock, ActorID: 9})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.ToLocationID != 2 || m.FromLocationID != 0 || m.Quantity != 3 || m.ActorID != 9 {
+			t.Errorf("Expected 3 units into location 2 by actor 9, got %+v", m)
+		}
+		if q := store.onHand[[2]int{2, 1}]; q != 3 {
+			t.Errorf("Expected quantity 3, got %d", q)
+		}
+	})
+
+	t.Run("should take stock away from a location", func(t *testing.T) {
+		service, store := newService()
+		m, err := service.Adjust(mockTx{}, types.StockAdjustment{ProductID: 1, LocationID: 1, Quantity: -3, Reason: types.StockMovementDamage})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.FromLocationID != 1 || m.ToLocationID != 0 || m.Quantity != 3 {
+			t.Errorf("Expected 3 units out of location 1, got %+v", m)
+		}
+		if q := store.onHand[[2]int{1, 1}]; q != 1 {
+			t.Errorf("Expected quantity 1, got %d", q)
+		}
+	})
+
+	t.Run("should not take away stock a location does not have", func(t *testing.T) {
+		service, _ := newService()
+		_, err := service.Adjust(mockTx{}, types.StockAdjustment{ProductID: 1, LocationID: 1, Quantity: -5, Reason: types.StockMovementAdjustment})
+		if !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("Expected %v, got %v", ErrInsufficientStock, err)
+		}
+	})
+
+	t.Run("should reject an unknown location", func(t *testing.T) {
+		service, _ := newService()
+		_, err := service.Adjust(mockTx{}, types.StockAdjustment{ProductID: 1, LocationID: 7, Quantity: 1, Reason: types.StockMovementRestock})
+		if !errors.Is(err, ErrLocationNotFound) {
+			t.Errorf("Expected %v, got %v", ErrLocationNotFound, err)
+		}
+	})
+}
+
+type mockTx struct{}
+
+func (mockTx) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (mockTx) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (mockTx) QueryRow(query string, args ...any) *sql.Row        { return nil }
+func (mockTx) Commit() error                                      { return nil }
+func (mockTx) Rollback() error                                    { return nil }
+
+type mockTransactor struct{}
+
+func (mockTransactor) BeginTx() (types.Tx, error) {
+	return mockTx{}, nil
+}
+
+type mockReservationStore struct {
+	types.ReservationStore
+	types.StockLocationStore
+	types.StockMovementStore
+	reservations []types.StockReservation
+	locations    []types.StockLocation
+	movements    []types.StockMovement
+	onHand       map[[2]int]int
+}
+
+func (m *mockReservationStore) GetStockLocations() ([]types.StockLocation, error) {
+	return m.locations, nil
+}
+
+func (m *mockReservationStore) GetLocationStockForUpdate(tx types.Tx, productIDs []int) ([]types.LocationStock, error) {
+	stock := []types.LocationStock{}
+	for key, quantity := range m.onHand {
+		st := types.LocationStock{LocationID: key[0], ProductID: key[1], OnHand: quantity}
+		for _, r := range m.reservations {
+			if r.Status == types.ReservationActive && r.LocationID == key[0] && r.ProductID == key[1] {
+				st.Reserved += r.Quantity
+			}
+		}
+		stock = append(stock, st)
+	}
+	return stock, nil
+}
+
+func (m *mockReservationStore) CreateReservation(tx types.Tx, r types.StockReservation) error {
+	r.ID = len(m.reservations) + 1
+	r.Status = types.ReservationActive
+	m.reservations = append(m.reservations, r)
+	return nil
+}
+
+func (m *mockReservationStore) GetStockLocationByID(id int) (*types.StockLocation, error) {
+	for _, l := range m.locations {
+		if l.ID == id {
+			return &l, nil
+		}
+	}
+	return nil, ErrLocationNotFound
+}
+
+func (m *mockReservationStore) RecordMovement(tx types.Tx, mv types.StockMovement) (int, error) {
+	if mv.FromLocationID != 0 {
+		key := [2]int{mv.FromLocationID, mv.ProductID}
+		if m.onHand[key] < mv.Quantity {
+			return 0, fmt.Errorf("%w: location %d does not have %d of product %d on hand", ErrInsufficientStock, mv.FromLocationID, mv.Quantity, mv.ProductID)
+		}
+		m.onHand[key] -= mv.Quantity
+	}
+	if mv.ToLocationID != 0 {
+		m.onHand[[2]int{mv.ToLocationID, mv.ProductID}] += mv.Quantity
+	}
+	m.movements = append(m.movements, mv)
+	return len(m.movements), nil
+}
+
+func (m *mockReservationStore) GetOrderReservationsForUpdate(tx types.Tx, orderID int) ([]types.StockReservation, error) {
+	reservations := []types.StockReservation{}
+	for _, r := range m.reservations {
+		if r.OrderID == orderID {
+			reservations = append(reservations, r)
+		}
+	}
+	return reservations, nil
+}
+
+func (m *mockReservationStore) UpdateReservationStatus(tx types.Tx, id int, status string) error {
+	for i := range m.reservations {
+		if m.reservations[i].ID == id {
+			m.reservations[i].Status = status
+		}
+	}
+	return nil
+}
+
+func (m *mockReservationStore) GetOrdersWithExpiredReservations(now time.Time) ([]int, error) {
+	ids := []int{}
+	for _, r := range m.reservations {
+		if r.Status == types.ReservationActive && r.ExpiresAt.Before(now) {
+			ids = append(ids, r.OrderID)
+		}
+	}
+	return ids, nil
+}
+
+type mockOrderStore struct {
+	types.OrderStore
+	orders  map[int]*types.Order
+	history []types.OrderStatusChange
+}
+
+func (m *mockOrderStore) GetOrderForUpdate(tx types.Tx, id int) (*types.Order, error) {
+	o, ok := m.orders[id]
+	if !ok {
+		return nil, fmt.Errorf("order not found")
+	}
+	cp := *o
+	return &cp, nil
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(tx types.Tx, orderID int, status string) error {
+	m.orders[orderID].Status = status
+	return nil
+}
+
+func (m *mockOrderStore) CreateOrderStatusChange(tx types.Tx, change types.OrderStatusChange) error {
+	m.history = append(m.history, change)
+	return nil
+}
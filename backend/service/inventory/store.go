@@ -0,0 +1,611 @@
+package inventory
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"backend/types"
+	"backend/utils"
+)
+
+var (
+	// ErrLocationNotFound is returned for a stock location that does not
+	// exist.
+	ErrLocationNotFound = errors.New("stock location not found")
+
+	// ErrInsufficientStock is returned when stock is to leave a location
+	// that does not have it.
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+const (
+	reservationColumns = "id, product_id, location_id, order_id, quantity, status, expires_at, created_at"
+	locationColumns    = "id, name, code, country, region, priority, active, created_at"
+	movementColumns    = "id, product_id, from_location_id, to_location_id, quantity, reason, order_id, actor_id, note, created_at"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// GetLocationStockForUpdate locks the stock rows before counting what is
+// reserved against them, so concurrent checkouts reserving the same products
+// queue up behind each other and cannot hold more than is on hand between
+// them.
+func (s *Store) GetLocationStockForUpdate(tx types.Tx, productIDs []int) ([]types.LocationStock, error) {
+	if len(productIDs) == 0 {
+		return []types.LocationStock{}, nil
+	}
+
+	in, args := utils.InClause(productIDs)
+	rows, err := tx.Query("SELECT location_id, product_id, quantity FROM location_stock WHERE product_id IN "+in+" ORDER BY location_id, product_id FOR UPDATE", args...)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := scanLocationStock(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := countReserved(tx, stock, in, args, true); err != nil {
+		return nil, err
+	}
+
+	return stock, nil
+}
+
+// countReserved fills in the stock held by active reservations for the
+// products in the IN clause in. Inside a transaction that locked the stock,
+// lock reads them locked too, so that it sees the reservations of the
+// transactions it queued up behind rather than its snapshot.
+func countReserved(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}, stock []types.LocationStock, in string, args []any, lock bool) error {
+	query := "SELECT location_id, product_id, quantity FROM inventory_reservations WHERE product_id IN " + in + " AND status = ?"
+	if lock {
+		query += " LOCK IN SHARE MODE"
+	}
+
+	rows, err := q.Query(query, append(args, types.ReservationActive)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var locationID, productID, quantity int
+		if err := rows.Scan(&locationID, &productID, &quantity); err != nil {
+			return err
+		}
+		for i := range stock {
+			if stock[i].LocationID == locationID && stock[i].ProductID == productID {
+				stock[i].Reserved += quantity
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Store) CreateReservation(tx types.Tx, r types.StockReservation) error {
+	_, err := tx.Exec(
+		"INSERT INTO inventory_reservations (product_id, location_id, order_id, quantity, status, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		r.ProductID, r.LocationID, r.OrderID, r.Quantity, types.ReservationActive, r.ExpiresAt,
+	)
+	return err
+}
+
+func (s *Store) GetOrderReservationsForUpdate(tx types.Tx, orderID int) ([]types.StockReservation, error) {
+	rows, err := tx.Query("SELECT "+reservationColumns+" FROM inventory_reservations WHERE order_id = ? ORDER BY id FOR UPDATE", orderID)
+	if err != nil {
+		return nil, err
+	}
+	return scanReservations(rows)
+}
+
+func (s *Store) GetActiveReservations(productID int) ([]types.StockReservation, error) {
+	rows, err := s.db.Query("SELECT "+reservationColumns+" FROM inventory_reservations WHERE product_id = ? AND status = ? ORDER BY expires_at, id", productID, types.ReservationActive)
+	if err != nil {
+		return nil, err
+	}
+	return scanReservations(rows)
+}
+
+func (s *Store) UpdateReservationStatus(tx types.Tx, id int, status string) error {
+	_, err := tx.Exec("UPDATE inventory_reservations SET status = ? WHERE id = ?", status, id)
+	return err
+}
+
+// RecordMovement takes stock off hand at m's source location, which must
+// have it, and puts it on hand at its destination, keeping the product's
+// total in step, before appending m to the ledger.
+func (s *Store) RecordMovement(tx types.Tx, m types.StockMovement) (int, error) {
+	delta := 0
+
+	if m.FromLocationID != 0 {
+		res, err := tx.Exec("UPDATE location_stock SET quantity = quantity - ? WHERE location_id = ? AND product_id = ? AND quantity >= ?", m.Quantity, m.FromLocationID, m.ProductID, m.Quantity)
+		if err != nil {
+			return 0, err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if affected == 0 {
+			return 0, fmt.Errorf("%w: location %d does not have %d of product %d on hand", ErrInsufficientStock, m.FromLocationID, m.Quantity, m.ProductID)
+		}
+		delta -= m.Quantity
+	}
+
+	if m.ToLocationID != 0 {
+		_, err := tx.Exec("INSERT INTO location_stock (location_id, product_id, quantity) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE quantity = quantity + VALUES(quantity)", m.ToLocationID, m.ProductID, m.Quantity)
+		if err != nil {
+			return 0, err
+		}
+		delta += m.Quantity
+	}
+
+	if delta != 0 {
+		if _, err := tx.Exec("UPDATE products SET quantity = quantity + ? WHERE id = ?", delta, m.ProductID); err != nil {
+			return 0, err
+		}
+	}
+
+	return createMovement(tx, m)
+}
+
+func (s *Store) GetOrdersWithExpiredReservations(now time.Time) ([]int, error) {
+	rows, err := s.db.Query("SELECT DISTINCT order_id FROM inventory_reservations WHERE status = ? AND expires_at < ? ORDER BY order_id", types.ReservationActive, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (s *Store) GetStockLevels(productIDs ...int) ([]types.StockLevel, error) {
+	query := "SELECT p.id, p.name, p.quantity, COALESCE(SUM(r.quantity), 0) FROM products p " +
+		"LEFT JOIN inventory_reservations r ON r.product_id = p.id AND r.status = ? " +
+		"WHERE p.deleted_at IS NULL"
+	args := []any{types.ReservationActive}
+
+	if len(productIDs) > 0 {
+		in, ids := utils.InClause(productIDs)
+		query += " AND p.id IN " + in
+		args = append(args, ids...)
+	}
+	query += " GROUP BY p.id, p.name, p.quantity ORDER BY p.id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := []types.StockLevel{}
+	for rows.Next() {
+		var l types.StockLevel
+		if err := rows.Scan(&l.ProductID, &l.Name, &l.OnHand, &l.Reserved); err != nil {
+			return nil, err
+		}
+		// On hand stock edited below what is reserved leaves nothing to sell.
+		l.Available = max(l.OnHand-l.Reserved, 0)
+		levels = append(levels, l)
+	}
+
+	return levels, rows.Err()
+}
+
+func (s *Store) GetStockLocations() ([]types.StockLocation, error) {
+	rows, err := s.db.Query("SELECT " + locationColumns + " FROM stock_locations ORDER BY priority, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []types.StockLocation{}
+	for rows.Next() {
+		l, err := scanRowsIntoLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, *l)
+	}
+
+	return locations, rows.Err()
+}
+
+func (s *Store) GetStockLocationByID(id int) (*types.StockLocation, error) {
+	l, err := scanRowsIntoLocation(s.db.QueryRow("SELECT "+locationColumns+" FROM stock_locations WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrLocationNotFound
+	}
+	return l, err
+}
+
+func (s *Store) CreateStockLocation(l types.StockLocation) (int, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO stock_locations (name, code, country, region, priority, active) VALUES (?, ?, ?, ?, ?, ?)",
+		l.Name, l.Code, l.Country, l.Region, l.Priority, l.Active,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) UpdateStockLocation(l types.StockLocation) error {
+	_, err := s.db.Exec(
+		"UPDATE stock_locations SET name = ?, code = ?, country = ?, region = ?, priority = ?, active = ? WHERE id = ?",
+		l.Name, l.Code, l.Country, l.Region, l.Priority, l.Active, l.ID,
+	)
+	return err
+}
+
+func (s *Store) GetLocationStock(productID int) ([]types.LocationStock, error) {
+	in, args := utils.InClause([]int{productID})
+	rows, err := s.db.Query("SELECT location_id, product_id, quantity FROM location_stock WHERE product_id IN "+in+" ORDER BY location_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := scanLocationStock(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := countReserved(s.db, stock, in, args, false); err != nil {
+		return nil, err
+	}
+
+	return stock, nil
+}
+
+// TransferStock locks the stock at both locations, in a fixed order so that
+// opposing transfers cannot deadlock, before checking what the source has
+// available.
+func (s *Store) TransferStock(m types.StockMovement) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT location_id, product_id, quantity FROM location_stock WHERE product_id = ? AND location_id IN (?, ?) ORDER BY location_id FOR UPDATE", m.ProductID, m.FromLocationID, m.ToLocationID)
+	if err != nil {
+		return 0, err
+	}
+	stock, err := scanLocationStock(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	in, args := utils.InClause([]int{m.ProductID})
+	if err := countReserved(tx, stock, in, args, true); err != nil {
+		return 0, err
+	}
+
+	available := 0
+	for _, st := range stock {
+		if st.LocationID == m.FromLocationID {
+			available = max(st.OnHand-st.Reserved, 0)
+		}
+	}
+	if available < m.Quantity {
+		return 0, fmt.Errorf("%w: only %d of product %d available to transfer from location %d", ErrInsufficientStock, available, m.ProductID, m.FromLocationID)
+	}
+
+	id, err := s.RecordMovement(tx, m)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func createMovement(tx types.Tx, m types.StockMovement) (int, error) {
+	res, err := tx.Exec(
+		"INSERT INTO stock_movements (product_id, from_location_id, to_location_id, quantity, reason, order_id, actor_id, note) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		m.ProductID, utils.NullableID(m.FromLocationID), utils.NullableID(m.ToLocationID), m.Quantity, m.Reason, utils.NullableID(m.OrderID), utils.NullableID(m.ActorID), m.Note,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// GetStockMovements pages through the ledger by ID, which orders movements
+// the way they happened.
+func (s *Store) GetStockMovements(filter types.StockMovementFilter) ([]types.StockMovement, error) {
+	where := []string{"1 = 1"}
+	args := []any{}
+	order := "id DESC"
+
+	if filter.ProductID != 0 {
+		where = append(where, "product_id = ?")
+		args = append(args, filter.ProductID)
+	}
+	if filter.LocationID != 0 {
+		where = append(where, "(from_location_id = ? OR to_location_id = ?)")
+		args = append(args, filter.LocationID, filter.LocationID)
+	}
+
+	backward := filter.Cursor != nil && filter.Cursor.Backward
+	if filter.Cursor != nil {
+		if backward {
+			where = append(where, "id > ?")
+			order = "id ASC"
+		} else {
+			where = append(where, "id < ?")
+		}
+		args = append(args, filter.Cursor.ID)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := s.db.Query("SELECT "+movementColumns+" FROM stock_movements WHERE "+strings.Join(where, " AND ")+" ORDER BY "+order+" LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []types.StockMovement{}
+	for rows.Next() {
+		m, err := scanRowsIntoMovement(rows)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, *m)
+	}
+
+	if backward {
+		slices.Reverse(movements)
+	}
+
+	return movements, rows.Err()
+}
+
+// ReconcileStock adds up each product's ledger, stock arriving at a location
+// counting for it and stock leaving one against it; transfers cancel out.
+func (s *Store) ReconcileStock(productIDs ...int) ([]types.StockReconciliation, error) {
+	query := `SELECT p.id, p.quantity,
+		COALESCE((SELECT SUM(ls.quantity) FROM location_stock ls WHERE ls.product_id = p.id), 0),
+		COALESCE((SELECT SUM(IF(m.to_location_id IS NULL, 0, m.quantity)) - SUM(IF(m.from_location_id IS NULL, 0, m.quantity)) FROM stock_movements m WHERE m.product_id = p.id), 0)
+		FROM products p WHERE p.deleted_at IS NULL`
+	var args []any
+	if len(productIDs) > 0 {
+		var in string
+		in, args = utils.InClause(productIDs)
+		query += " AND p.id IN " + in
+	}
+
+	rows, err := s.db.Query(query+" ORDER BY p.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reconciliations := []types.StockReconciliation{}
+	for rows.Next() {
+		var r types.StockReconciliation
+		if err := rows.Scan(&r.ProductID, &r.Quantity, &r.Located, &r.Ledger); err != nil {
+			return nil, err
+		}
+		r.Reconciled = r.Quantity == r.Located && r.Quantity == r.Ledger
+		reconciliations = append(reconciliations, r)
+	}
+
+	return reconciliations, rows.Err()
+}
+
+// availableColumn is the SQL for the stock of product p left to sell.
+const availableColumn = "GREATEST(CAST(p.quantity AS SIGNED) - COALESCE((SELECT SUM(r.quantity) FROM inventory_reservations r WHERE r.product_id = p.id AND r.status = 'active'), 0), 0)"
+
+func (s *Store) GetNewLowStock() ([]types.LowStockAlert, error) {
+	rows, err := s.db.Query(
+		"SELECT id, name, available, reorder_threshold FROM (" +
+			"SELECT p.id, p.name, " + availableColumn + " AS available, p.reorder_threshold FROM products p " +
+			"WHERE p.deleted_at IS NULL AND p.reorder_threshold > 0 AND NOT p.low_stock_alerted" +
+			") low WHERE available <= reorder_threshold ORDER BY id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []types.LowStockAlert{}
+	for rows.Next() {
+		var a types.LowStockAlert
+		if err := rows.Scan(&a.ProductID, &a.Name, &a.Available, &a.Threshold); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+
+	return alerts, rows.Err()
+}
+
+func (s *Store) MarkLowStockAlerted(productIDs []int) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	in, args := utils.InClause(productIDs)
+	_, err := s.db.Exec("UPDATE products SET low_stock_alerted = TRUE WHERE id IN "+in, args...)
+	return err
+}
+
+func (s *Store) ClearRestockedAlerts() error {
+	_, err := s.db.Exec("UPDATE products p SET p.low_stock_alerted = FALSE WHERE p.low_stock_alerted AND " + availableColumn + " > p.reorder_threshold")
+	return err
+}
+
+func (s *Store) CreateStockSubscription(productID, userID int) error {
+	_, err := s.db.Exec("INSERT INTO stock_subscriptions (product_id, user_id) VALUES (?, ?) ON DUPLICATE KEY UPDATE notified_at = NULL", productID, userID)
+	return err
+}
+
+func (s *Store) GetDueStockSubscriptions() ([]types.StockSubscription, error) {
+	rows, err := s.db.Query(
+		"SELECT s.id, s.product_id, p.name, s.user_id, u.email, u.firstName, s.created_at, s.notified_at FROM stock_subscriptions s " +
+			"JOIN products p ON p.id = s.product_id JOIN users u ON u.id = s.user_id " +
+			"WHERE s.notified_at IS NULL AND p.deleted_at IS NULL AND u.deleted_at IS NULL AND " + availableColumn + " > 0 ORDER BY s.id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []types.StockSubscription{}
+	for rows.Next() {
+		var sub types.StockSubscription
+		var notifiedAt sql.NullTime
+		err := rows.Scan(&sub.ID, &sub.ProductID, &sub.ProductName, &sub.UserID, &sub.Email, &sub.FirstName, &sub.CreatedAt, &notifiedAt)
+		if err != nil {
+			return nil, err
+		}
+		if notifiedAt.Valid {
+			sub.NotifiedAt = &notifiedAt.Time
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (s *Store) MarkStockSubscriptionNotified(id int) error {
+	_, err := s.db.Exec("UPDATE stock_subscriptions SET notified_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return err
+}
+
+func scanLocationStock(rows *sql.Rows) ([]types.LocationStock, error) {
+	defer rows.Close()
+
+	stock := []types.LocationStock{}
+	for rows.Next() {
+		var st types.LocationStock
+		if err := rows.Scan(&st.LocationID, &st.ProductID, &st.OnHand); err != nil {
+			return nil, err
+		}
+		stock = append(stock, st)
+	}
+
+	return stock, rows.Err()
+}
+
+func scanReservations(rows *sql.Rows) ([]types.StockReservation, error) {
+	defer rows.Close()
+
+	reservations := []types.StockReservation{}
+	for rows.Next() {
+		r, err := scanRowsIntoReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, *r)
+	}
+
+	return reservations, rows.Err()
+}
+
+// scanRowsIntoReservation reads reservationColumns from either *sql.Rows or
+// *sql.Row.
+func scanRowsIntoReservation(rows interface{ Scan(dest ...any) error }) (*types.StockReservation, error) {
+	r := new(types.StockReservation)
+
+	err := rows.Scan(
+		&r.ID,
+		&r.ProductID,
+		&r.LocationID,
+		&r.OrderID,
+		&r.Quantity,
+		&r.Status,
+		&r.ExpiresAt,
+		&r.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// scanRowsIntoLocation reads locationColumns from either *sql.Rows or
+// *sql.Row.
+func scanRowsIntoLocation(rows interface{ Scan(dest ...any) error }) (*types.StockLocation, error) {
+	l := new(types.StockLocation)
+
+	err := rows.Scan(
+		&l.ID,
+		&l.Name,
+		&l.Code,
+		&l.Country,
+		&l.Region,
+		&l.Priority,
+		&l.Active,
+		&l.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// scanRowsIntoMovement reads movementColumns from either *sql.Rows or
+// *sql.Row.
+func scanRowsIntoMovement(rows interface{ Scan(dest ...any) error }) (*types.StockMovement, error) {
+	m := new(types.StockMovement)
+	var fromLocationID, toLocationID, orderID, actorID sql.NullInt64
+
+	err := rows.Scan(
+		&m.ID,
+		&m.ProductID,
+		&fromLocationID,
+		&toLocationID,
+		&m.Quantity,
+		&m.Reason,
+		&orderID,
+		&actorID,
+		&m.Note,
+		&m.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.FromLocationID = int(fromLocationID.Int64)
+	m.ToLocationID = int(toLocationID.Int64)
+	m.OrderID = int(orderID.Int64)
+	m.ActorID = int(actorID.Int64)
+
+	return m, nil
+}
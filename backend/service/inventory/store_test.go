@@ -0,0 +1,67 @@
+package inventory
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"backend/types"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRecordMovement(t *testing.T) {
+	decrement := regexp.QuoteMeta("UPDATE location_stock SET quantity = quantity - ? WHERE location_id = ? AND product_id = ? AND quantity >= ?")
+	sale := types.StockMovement{ProductID: 1, FromLocationID: 2, Quantity: 3, Reason: types.StockMovementSale, OrderID: 4}
+
+	t.Run("should only take stock a location has on hand", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(decrement).WithArgs(3, 2, 1, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE products SET quantity = quantity + ? WHERE id = ?")).WithArgs(-3, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO stock_movements").WithArgs(1, 2, nil, 3, types.StockMovementSale, 4, nil, "").WillReturnResult(sqlmock.NewResult(9, 1))
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := NewStore(db).RecordMovement(tx, sale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 9 {
+			t.Errorf("Expected movement 9, got %d", id)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should fail without touching the total when the location is short", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(decrement).WithArgs(3, 2, 1, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewStore(db).RecordMovement(tx, sale); !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("Expected %v, got %v", ErrInsufficientStock, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
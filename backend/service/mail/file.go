@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"backend/types"
+)
+
+// FileMailer writes every message to its own .eml file instead of sending it.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(msg types.Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), msg.To)
+	return os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0o644)
+}
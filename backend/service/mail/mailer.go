@@ -0,0 +1,28 @@
+package mail
+
+import (
+	"fmt"
+
+	"backend/config"
+	"backend/types"
+)
+
+// NewMailer returns the mailer selected by the MAILER setting: "smtp" sends
+// real mail, "file" (the default) writes messages to MAIL_DIR for local
+// development and "memory" keeps them in memory.
+func NewMailer(cfg config.Config) (types.Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file", "":
+		return NewFileMailer(cfg.MailDir, cfg.MailFrom), nil
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.Mailer)
+	}
+}
+
+func format(from string, msg types.Message) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", from, msg.To, msg.Subject, msg.Body))
+}
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backend/config"
+	"backend/types"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir, "shop@example.com")
+
+	err := mailer.Send(types.Message{To: "jane@example.com", Subject: "Hello", Body: "Hi Jane"})
+	if err != nil {
+		t.Fatalf("error sending mail: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one message file, got %d", len(files))
+	}
+
+	content, _ := os.ReadFile(files[0])
+	for _, want := range []string{"From: shop@example.com", "To: jane@example.com", "Subject: Hello", "Hi Jane"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected message to contain %q, got %q", want, content)
+		}
+	}
+}
+
+func TestNewMailer(t *testing.T) {
+	if _, err := NewMailer(config.Config{Mailer: "memory"}); err != nil {
+		t.Errorf("expected memory mailer, got %v", err)
+	}
+	if _, err := NewMailer(config.Config{Mailer: "carrier-pigeon"}); err == nil {
+		t.Error("expected an unknown mailer to be rejected")
+	}
+}
@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"sync"
+
+	"backend/types"
+)
+
+// MemoryMailer records sent messages so tests can inspect them.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []types.Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(msg types.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *MemoryMailer) Messages() []types.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]types.Message(nil), m.messages...)
+}
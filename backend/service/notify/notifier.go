@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+
+	"backend/config"
+	"backend/service/mail"
+	"backend/types"
+)
+
+// NewNotifier returns the staff notifier selected by STOCK_NOTIFIER: "log"
+// (the default) writes alerts to the log, "smtp" emails them to
+// STOCK_ALERT_EMAIL through the SMTP_* server and "webhook" posts them as
+// JSON to STOCK_ALERT_WEBHOOK_URL, for a chat or paging integration.
+func NewNotifier(cfg config.Config) (types.StockNotifier, error) {
+	switch cfg.StockNotifier {
+	case "log", "":
+		return LogNotifier{}, nil
+	case "smtp":
+		if cfg.StockAlertEmail == "" {
+			return nil, fmt.Errorf("STOCK_ALERT_EMAIL is required by the smtp notifier")
+		}
+		mailer := mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.MailFrom)
+		return NewMailNotifier(mailer, cfg.StockAlertEmail), nil
+	case "webhook":
+		if cfg.StockAlertWebhookURL == "" {
+			return nil, fmt.Errorf("STOCK_ALERT_WEBHOOK_URL is required by the webhook notifier")
+		}
+		return NewWebhookNotifier(cfg.StockAlertWebhookURL), nil
+	default:
+		return nil, fmt.Errorf("unknown stock notifier %q", cfg.StockNotifier)
+	}
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) NotifyLowStock(alerts []types.LowStockAlert) error {
+	for _, a := range alerts {
+		log.Printf("low stock: product %d (%s) has %d available, reorder threshold %d", a.ProductID, a.Name, a.Available, a.Threshold)
+	}
+	return nil
+}
+
+// MailNotifier emails alerts to a staff address.
+type MailNotifier struct {
+	mailer types.Mailer
+	to     string
+}
+
+func NewMailNotifier(mailer types.Mailer, to string) *MailNotifier {
+	return &MailNotifier{mailer: mailer, to: to}
+}
+
+func (n *MailNotifier) NotifyLowStock(alerts []types.LowStockAlert) error {
+	body := "These products have run low and need reordering:\n\n"
+	for _, a := range alerts {
+		body += fmt.Sprintf("- %s (product %d): %d available, reorder threshold %d\n", a.Name, a.ProductID, a.Available, a.Threshold)
+	}
+
+	return n.mailer.Send(types.Message{
+		To:      n.to,
+		Subject: fmt.Sprintf("Low stock: %d products need reordering", len(alerts)),
+		Body:    body,
+	})
+}
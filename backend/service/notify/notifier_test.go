@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/config"
+	"backend/service/mail"
+	"backend/types"
+)
+
+var alerts = []types.LowStockAlert{{ProductID: 1, Name: "Widget", Available: 2, Threshold: 5}}
+
+func TestMailNotifier(t *testing.T) {
+	mailer := mail.NewMemoryMailer()
+	if err := NewMailNotifier(mailer, "staff@example.com").NotifyLowStock(alerts); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "staff@example.com" || !strings.Contains(messages[0].Body, "Widget (product 1): 2 available") {
+		t.Errorf("Expected one alert to staff@example.com, got %+v", messages)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got struct {
+		Event  string                `json:"event"`
+		Alerts []types.LowStockAlert `json:"alerts"`
+	}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	t.Run("should post the alerts as JSON", func(t *testing.T) {
+		if err := NewWebhookNotifier(server.URL).NotifyLowStock(alerts); err != nil {
+			t.Fatal(err)
+		}
+		if got.Event != "stock.low" || len(got.Alerts) != 1 || got.Alerts[0] != alerts[0] {
+			t.Errorf("Expected the alerts to be posted, got %+v", got)
+		}
+	})
+
+	t.Run("should fail when the webhook does not accept them", func(t *testing.T) {
+		status = http.StatusBadGateway
+		if err := NewWebhookNotifier(server.URL).NotifyLowStock(alerts); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
+
+func TestNewNotifier(t *testing.T) {
+	if _, err := NewNotifier(config.Config{}); err != nil {
+		t.Errorf("Expected the log notifier by default, got %v", err)
+	}
+	if _, err := NewNotifier(config.Config{StockNotifier: "smtp"}); err == nil {
+		t.Error("Expected the smtp notifier to require an address")
+	}
+	if _, err := NewNotifier(config.Config{StockNotifier: "webhook"}); err == nil {
+		t.Error("Expected the webhook notifier to require a URL")
+	}
+	if _, err := NewNotifier(config.Config{StockNotifier: "pager"}); err == nil {
+		t.Error("Expected an unknown notifier to be rejected")
+	}
+}
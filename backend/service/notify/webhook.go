@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"backend/types"
+)
+
+// WebhookNotifier posts alerts as JSON to a URL.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *WebhookNotifier) NotifyLowStock(alerts []types.LowStockAlert) error {
+	body, err := json.Marshal(map[string]any{
+		"event":  "stock.low",
+		"alerts": alerts,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("stock alert webhook answered with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/config"
+	"backend/service/auth"
+	"backend/types"
+	"backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store      types.OrderStore
+	userStore  types.UserStore
+	payments   types.PaymentService
+	inventory  types.InventoryService
+	transactor types.Transactor
+}
+
+func NewHandler(
+	store types.OrderStore,
+	userStore types.UserStore,
+	payments types.PaymentService,
+	inventory types.InventoryService,
+	transactor types.Transactor,
+) *Handler {
+	return &Handler{
+		store:      store,
+		userStore:  userStore,
+		payments:   payments,
+		inventory:  inventory,
+		transactor: transactor,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/orders", auth.WithJWTAuth(h.handleGetOrders, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/orders/{orderID}", auth.WithJWTAuth(h.handleGetOrder, h.userStore)).Methods(http.MethodGet)
+
+	router.HandleFunc("/admin/orders/{orderID}/status", auth.WithJWTAuth(auth.WithRole(h.handleUpdateOrderStatus, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/orders/{orderID}/history", auth.WithJWTAuth(auth.WithRole(h.handleGetOrderHistory, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+}
+
+func (h *Handler) handleGetOrders(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	secret := []byte(config.Envs.CursorSecret)
+
+	query := r.URL.Query()
+	page := types.Page{Limit: 20}
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 100 {
+		page.Limit = l
+	}
+	if s, err := strconv.Atoi(query.Get("skip")); err == nil && s >= 0 {
+		page.Offset = s
+	}
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := utils.DecodeCursor(secret, types.CursorOrders, v)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := time.Parse(time.RFC3339Nano, cursor.Key); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid cursor"))
+			return
+		}
+		page.Cursor = cursor
+		page.Offset = 0
+	}
+
+	// One extra row tells whether there is another page.
+	fetch := page
+	fetch.Limit++
+	orders, err := h.store.GetOrdersByUserID(userID, fetch)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	orders, hasNext, hasPrev := utils.TrimPage(orders, page)
+
+	nextCursor, prevCursor, err := utils.PageCursors(secret, orders, hasNext, hasPrev, func(o types.Order) types.Cursor {
+		return types.Cursor{Kind: types.CursorOrders, Key: o.CreatedAt, ID: o.ID}
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"orders":      orders,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	})
+}
+
+func (h *Handler) handleGetOrder(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	order, err := h.store.GetOrderByID(orderID)
+	// Orders belonging to other users are reported as missing so their IDs
+	// cannot be probed.
+	if err != nil || order.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+		return
+	}
+
+	order.Items, err = h.store.GetOrderItems(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	order.Discounts, err = h.store.GetOrderDiscounts(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	order.Taxes, err = h.store.GetOrderTaxes(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, order)
+}
+
+func (h *Handler) handleUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	actorID := auth.GetUserIDFromContext(r.Context())
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	var payload types.UpdateOrderStatusPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	order, err := h.changeStatus(orderID, payload.Status, actorID, payload.Note)
+	if errors.Is(err, errOrderNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, errInvalidTransition) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, order)
+}
+
+func (h *Handler) handleGetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	history, err := h.store.GetOrderStatusHistory(orderID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, history)
+}
@@ -0,0 +1,472 @@
+package order
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"testing"
+
+	"backend/config"
+	"backend/service/auth"
+	"backend/service/inventory"
+	"backend/types"
+	"backend/utils"
+	"github.com/gorilla/mux"
+)
+
+func TestOrderServiceHandlers(t *testing.T) {
+	store := &mockOrderStore{orders: map[int]*types.Order{
+		1: {ID: 1, UserID: 1, Total: types.MustParseMoney("20"), Status: "pending"},
+		2: {ID: 2, UserID: 2, Total: types.MustParseMoney("35"), Status: "pending"},
+	}}
+	handler := NewHandler(store, nil, nil, nil, mockTransactor{})
+
+	serve := func(userID int, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/orders", handler.handleGetOrders).Methods(http.MethodGet)
+		router.HandleFunc("/orders/{orderID}", handler.handleGetOrder).Methods(http.MethodGet)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should return the user's own order with its items", func(t *testing.T) {
+		rr := serve(1, "/orders/1")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var order types.Order
+		if err := json.NewDecoder(rr.Body).Decode(&order); err != nil {
+			t.Fatal(err)
+		}
+		if len(order.Items) != 1 || order.Items[0].ProductName != "Widget" {
+			t.Errorf("Expected order items joined to product names, got %+v", order.Items)
+		}
+	})
+
+	t.Run("should not expose another user's order", func(t *testing.T) {
+		rr := serve(1, "/orders/2")
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should fail on an invalid order ID", func(t *testing.T) {
+		rr := serve(1, "/orders/abc")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should list only the user's orders", func(t *testing.T) {
+		rr := serve(2, "/orders?limit=10")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var res ordersResponse
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Orders) != 1 || res.Orders[0].ID != 2 || res.NextCursor != nil || res.PrevCursor != nil {
+			t.Errorf("Expected only order 2 on a single page, got %+v", res)
+		}
+	})
+}
+
+type ordersResponse struct {
+	Orders     []types.Order `json:"orders"`
+	NextCursor *string       `json:"next_cursor"`
+	PrevCursor *string       `json:"prev_cursor"`
+}
+
+func TestOrderCursorPagination(t *testing.T) {
+	store := &mockOrderStore{orders: map[int]*types.Order{}}
+	for id := 1; id <= 5; id++ {
+		store.orders[id] = &types.Order{ID: id, UserID: 1, CreatedAt: "2025-06-01T10:00:00Z"}
+	}
+	handler := NewHandler(store, nil, nil, nil, mockTransactor{})
+
+	get := func(query string) ordersResponse {
+		req := httptest.NewRequest(http.MethodGet, "/orders?"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handler.handleGetOrders(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var res ordersResponse
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	ids := func(res ordersResponse) string {
+		var ids []int
+		for _, o := range res.Orders {
+			ids = append(ids, o.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	first := get("limit=2")
+	if ids(first) != "[5 4]" || first.NextCursor == nil || first.PrevCursor != nil {
+		t.Fatalf("Unexpected first page: %s %+v", ids(first), first)
+	}
+
+	second := get("limit=2&cursor=" + url.QueryEscape(*first.NextCursor))
+	if ids(second) != "[3 2]" || second.NextCursor == nil || second.PrevCursor == nil {
+		t.Fatalf("Unexpected second page: %s %+v", ids(second), second)
+	}
+
+	last := get("limit=2&cursor=" + url.QueryEscape(*second.NextCursor))
+	if ids(last) != "[1]" || last.NextCursor != nil {
+		t.Fatalf("Unexpected last page: %s %+v", ids(last), last)
+	}
+
+	back := get("limit=2&cursor=" + url.QueryEscape(*second.PrevCursor))
+	if ids(back) != "[5 4]" || back.PrevCursor != nil {
+		t.Errorf("Unexpected page going back: %s %+v", ids(back), back)
+	}
+
+	secret := []byte(config.Envs.CursorSecret)
+	products, _ := utils.EncodeCursor(secret, types.Cursor{Kind: types.CursorProducts, Sort: types.ProductSortPriceAsc, Key: "9.99", ID: 3})
+	badKey, _ := utils.EncodeCursor(secret, types.Cursor{Kind: types.CursorOrders, Key: "9.99", ID: 3})
+	for name, cursor := range map[string]string{"a forged cursor": "forged", "a product cursor": products, "a cursor with a bad key": badKey} {
+		req := httptest.NewRequest(http.MethodGet, "/orders?cursor="+url.QueryEscape(cursor), nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handler.handleGetOrders(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, name, rr.Code)
+		}
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	var payments *mockPaymentService
+	var reservations *mockReservationStore
+	newHandler := func(status string) (*Handler, *mockOrderStore) {
+		store := &mockOrderStore{orders: map[int]*types.Order{
+			1: {ID: 1, UserID: 1, Total: types.MustParseMoney("20"), Status: status},
+		}}
+		payments = &mockPaymentService{}
+		reservations = &mockReservationStore{quantities: map[int]int{1: 5}}
+		stock := inventory.NewService(reservations, reservations, reservations, store, inventory.SingleLocation{}, mockTransactor{})
+		return NewHandler(store, nil, payments, stock, mockTransactor{}), store
+	}
+
+	reserve := func() {
+		reservations.reservations = []types.StockReservation{{ID: 1, ProductID: 1, LocationID: 1, OrderID: 1, Quantity: 2, Status: types.ReservationActive}}
+	}
+
+	serve := func(handler *Handler, status string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(types.UpdateOrderStatusPayload{Status: status})
+		req := httptest.NewRequest(http.MethodPost, "/admin/orders/1/status", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 9))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/orders/{orderID}/status", handler.handleUpdateOrderStatus).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should advance a pending order to paid and record the change", func(t *testing.T) {
+		handler, store := newHandler(types.OrderStatusPending)
+		rr := serve(handler, types.OrderStatusPaid)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if store.orders[1].Status != types.OrderStatusPaid {
+			t.Errorf("Expected order status %q, got %q", types.OrderStatusPaid, store.orders[1].Status)
+		}
+		if len(store.history) != 1 || store.history[0].ActorID != 9 || store.history[0].FromStatus != types.OrderStatusPending {
+			t.Errorf("Expected one status change by actor 9, got %+v", store.history)
+		}
+	})
+
+	t.Run("should reject an illegal transition", func(t *testing.T) {
+		handler, store := newHandler(types.OrderStatusPending)
+		rr := serve(handler, types.OrderStatusShipped)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if len(store.history) != 0 {
+			t.Errorf("Expected no status changes, got %+v", store.history)
+		}
+	})
+
+	t.Run("should take reserved stock off hand when an order is paid", func(t *testing.T) {
+		handler, _ := newHandler(types.OrderStatusPending)
+		reserve()
+		rr := serve(handler, types.OrderStatusPaid)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if q := reservations.quantities[1]; q != 3 {
+			t.Errorf("Expected product quantity 3, got %d", q)
+		}
+		if m := reservations.movements; len(m) != 1 || m[0].Reason != types.StockMovementSale || m[0].OrderID != 1 {
+			t.Errorf("Expected a sale for order 1 in the ledger, got %+v", m)
+		}
+		if s := reservations.reservations[0].Status; s != types.ReservationCommitted {
+			t.Errorf("Expected reservation to be %q, got %q", types.ReservationCommitted, s)
+		}
+	})
+
+	t.Run("should release the stock reserved for a cancelled order", func(t *testing.T) {
+		handler, _ := newHandler(types.OrderStatusPending)
+		reserve()
+		rr := serve(handler, types.OrderStatusCancelled)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if q := reservations.quantities[1]; q != 5 {
+			t.Errorf("Expected product quantity 5, got %d", q)
+		}
+		if s := reservations.reservations[0].Status; s != types.ReservationReleased {
+			t.Errorf("Expected reservation to be %q, got %q", types.ReservationReleased, s)
+		}
+	})
+
+	t.Run("should restock items when an order placed before reservations is cancelled", func(t *testing.T) {
+		handler, _ := newHandler(types.OrderStatusPaid)
+		rr := serve(handler, types.OrderStatusCancelled)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if q := reservations.quantities[1]; q != 7 {
+			t.Errorf("Expected product quantity 7, got %d", q)
+		}
+		if m := reservations.movements; len(m) != 1 || m[0].Reason != types.StockMovementReturn || m[0].ToLocationID != 1 || m[0].ActorID != 9 {
+			t.Errorf("Expected a return to location 1 by actor 9 in the ledger, got %+v", m)
+		}
+		if len(payments.refunded) != 1 || payments.refunded[0] != 1 {
+			t.Errorf("Expected the payments of cancelled order 1 to be refunded, got %v", payments.refunded)
+		}
+	})
+
+	t.Run("should refund the payments of a refunded order", func(t *testing.T) {
+		handler, _ := newHandler(types.OrderStatusDelivered)
+		rr := serve(handler, types.OrderStatusRefunded)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if len(payments.refunded) != 1 || payments.refunded[0] != 1 {
+			t.Errorf("Expected order 1 to be refunded, got %v", payments.refunded)
+		}
+	})
+
+	t.Run("should keep the order when the refund fails", func(t *testing.T) {
+		handler, store := newHandler(types.OrderStatusDelivered)
+		payments.failRefunds = true
+		rr := serve(handler, types.OrderStatusRefunded)
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		if store.orders[1].Status != types.OrderStatusDelivered {
+			t.Errorf("Expected order status %q, got %q", types.OrderStatusDelivered, store.orders[1].Status)
+		}
+	})
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{types.OrderStatusPending, types.OrderStatusPaid, true},
+		{types.OrderStatusPaid, types.OrderStatusFulfilled, true},
+		{types.OrderStatusFulfilled, types.OrderStatusShipped, true},
+		{types.OrderStatusShipped, types.OrderStatusDelivered, true},
+		{types.OrderStatusDelivered, types.OrderStatusRefunded, true},
+		{types.OrderStatusPending, types.OrderStatusDelivered, false},
+		{types.OrderStatusShipped, types.OrderStatusCancelled, false},
+		{types.OrderStatusCancelled, types.OrderStatusPending, false},
+		{types.OrderStatusRefunded, types.OrderStatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+type mockTx struct{}
+
+func (mockTx) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (mockTx) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (mockTx) QueryRow(query string, args ...any) *sql.Row        { return nil }
+func (mockTx) Commit() error                                      { return nil }
+func (mockTx) Rollback() error                                    { return nil }
+
+type mockTransactor struct{}
+
+func (mockTransactor) BeginTx() (types.Tx, error) {
+	return mockTx{}, nil
+}
+
+// mockReservationStore keeps all stock at a single location.
+type mockReservationStore struct {
+	types.ReservationStore
+	types.StockLocationStore
+	types.StockMovementStore
+	quantities   map[int]int
+	reservations []types.StockReservation
+	movements    []types.StockMovement
+}
+
+func (m *mockReservationStore) GetStockLocations() ([]types.StockLocation, error) {
+	return []types.StockLocation{{ID: 1, Code: "MAIN", Country: "US", Active: true}}, nil
+}
+
+func (m *mockReservationStore) RecordMovement(tx types.Tx, mv types.StockMovement) (int, error) {
+	if mv.FromLocationID != 0 {
+		m.quantities[mv.ProductID] -= mv.Quantity
+	}
+	if mv.ToLocationID != 0 {
+		m.quantities[mv.ProductID] += mv.Quantity
+	}
+	m.movements = append(m.movements, mv)
+	return len(m.movements), nil
+}
+
+func (m *mockReservationStore) GetOrderReservationsForUpdate(tx types.Tx, orderID int) ([]types.StockReservation, error) {
+	reservations := []types.StockReservation{}
+	for _, r := range m.reservations {
+		if r.OrderID == orderID {
+			reservations = append(reservations, r)
+		}
+	}
+	return reservations, nil
+}
+
+func (m *mockReservationStore) UpdateReservationStatus(tx types.Tx, id int, status string) error {
+	for i := range m.reservations {
+		if m.reservations[i].ID == id {
+			m.reservations[i].Status = status
+		}
+	}
+	return nil
+}
+
+type mockOrderStore struct {
+	orders  map[int]*types.Order
+	history []types.OrderStatusChange
+}
+
+func (m *mockOrderStore) CreateOrder(tx types.Tx, order types.Order) (int, error) {
+	return 0, nil
+}
+
+func (m *mockOrderStore) CreateOrderItem(tx types.Tx, item types.OrderItem) error {
+	return nil
+}
+
+// GetOrdersByUserID orders by descending ID, standing in for creation time.
+func (m *mockOrderStore) GetOrdersByUserID(userID int, page types.Page) ([]types.Order, error) {
+	orders := []types.Order{}
+	for _, o := range m.orders {
+		if o.UserID != userID {
+			continue
+		}
+		if page.Cursor != nil && page.Cursor.Backward && o.ID <= page.Cursor.ID {
+			continue
+		}
+		if page.Cursor != nil && !page.Cursor.Backward && o.ID >= page.Cursor.ID {
+			continue
+		}
+		orders = append(orders, *o)
+	}
+
+	backward := page.Cursor != nil && page.Cursor.Backward
+	sort.Slice(orders, func(i, j int) bool {
+		if backward {
+			return orders[i].ID < orders[j].ID
+		}
+		return orders[i].ID > orders[j].ID
+	})
+
+	orders = orders[min(page.Offset, len(orders)):]
+	orders = orders[:min(page.Limit, len(orders))]
+	if backward {
+		slices.Reverse(orders)
+	}
+	return orders, nil
+}
+
+func (m *mockOrderStore) GetOrderByID(id int) (*types.Order, error) {
+	o, ok := m.orders[id]
+	if !ok {
+		return nil, fmt.Errorf("order not found")
+	}
+	cp := *o
+	return &cp, nil
+}
+
+func (m *mockOrderStore) GetOrderItems(orderID int) ([]types.OrderItem, error) {
+	return []types.OrderItem{{ID: 1, OrderID: orderID, ProductID: 1, ProductName: "Widget", Quantity: 2, Price: types.MustParseMoney("10")}}, nil
+}
+
+func (m *mockOrderStore) GetOrderForUpdate(tx types.Tx, id int) (*types.Order, error) {
+	return m.GetOrderByID(id)
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(tx types.Tx, orderID int, status string) error {
+	m.orders[orderID].Status = status
+	return nil
+}
+
+func (m *mockOrderStore) CreateOrderStatusChange(tx types.Tx, change types.OrderStatusChange) error {
+	m.history = append(m.history, change)
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderStatusHistory(orderID int) ([]types.OrderStatusChange, error) {
+	return m.history, nil
+}
+
+func (m *mockOrderStore) CreateOrderDiscount(tx types.Tx, orderID int, discount types.AppliedDiscount) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderDiscounts(orderID int) ([]types.AppliedDiscount, error) {
+	return []types.AppliedDiscount{}, nil
+}
+
+func (m *mockOrderStore) CreateOrderTax(tx types.Tx, orderID int, tax types.TaxLine) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderTaxes(orderID int) ([]types.TaxLine, error) {
+	return []types.TaxLine{}, nil
+}
+
+type mockPaymentService struct {
+	refunded    []int
+	failRefunds bool
+}
+
+func (m *mockPaymentService) StartPayment(order types.Order) (*types.PaymentSession, error) {
+	return &types.PaymentSession{Amount: order.Total, Status: types.PaymentStatusPending}, nil
+}
+
+func (m *mockPaymentService) RefundOrder(tx types.Tx, orderID int) error {
+	if m.failRefunds {
+		return fmt.Errorf("refund failed")
+	}
+	m.refunded = append(m.refunded, orderID)
+	return nil
+}
@@ -0,0 +1,120 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+
+	"backend/types"
+)
+
+var errInvalidTransition = errors.New("invalid order status transition")
+
+// transitions lists, for every order status, the statuses it may move to.
+// Cancelled and refunded orders are final.
+var transitions = map[string][]string{
+	types.OrderStatusPending:   {types.OrderStatusPaid, types.OrderStatusCancelled},
+	types.OrderStatusPaid:      {types.OrderStatusFulfilled, types.OrderStatusCancelled, types.OrderStatusRefunded},
+	types.OrderStatusFulfilled: {types.OrderStatusShipped, types.OrderStatusCancelled, types.OrderStatusRefunded},
+	types.OrderStatusShipped:   {types.OrderStatusDelivered, types.OrderStatusRefunded},
+	types.OrderStatusDelivered: {types.OrderStatusRefunded},
+}
+
+func canTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// changeStatus moves an order to the given status on behalf of actorID and
+// records the change. Paying for an order takes the stock reserved for it
+// off hand, cancelling it gives the stock back, and both cancelling and
+// refunding it refund its captured payments.
+func (h *Handler) changeStatus(orderID int, status string, actorID int, note string) (*types.Order, error) {
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := h.store.GetOrderForUpdate(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canTransition(order.Status, status) {
+		return nil, fmt.Errorf("%w: %s to %s", errInvalidTransition, order.Status, status)
+	}
+
+	if status == types.OrderStatusPaid {
+		if err := h.inventory.Commit(tx, order.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if status == types.OrderStatusCancelled {
+		if err := h.restock(tx, order.ID, actorID); err != nil {
+			return nil, err
+		}
+	}
+
+	if status == types.OrderStatusCancelled || status == types.OrderStatusRefunded {
+		if err := h.payments.RefundOrder(tx, order.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := h.store.UpdateOrderStatus(tx, order.ID, status); err != nil {
+		return nil, err
+	}
+
+	err = h.store.CreateOrderStatusChange(tx, types.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+		ActorID:    actorID,
+		Note:       note,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	order.Status = status
+	return order, nil
+}
+
+// restock gives back the stock of a cancelled order. Orders placed before
+// stock was reserved took it at checkout, so their items are returned to
+// the default location.
+func (h *Handler) restock(tx types.Tx, orderID, actorID int) error {
+	reserved, err := h.inventory.Release(tx, orderID)
+	if err != nil || reserved {
+		return err
+	}
+
+	items, err := h.store.GetOrderItems(orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		_, err := h.inventory.Adjust(tx, types.StockAdjustment{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Reason:    types.StockMovementReturn,
+			OrderID:   orderID,
+			ActorID:   actorID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
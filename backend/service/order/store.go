@@ -2,9 +2,19 @@ package order
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
 	"backend/types"
+	"backend/utils"
 )
 
+var errOrderNotFound = errors.New("order not found")
+
+const orderColumns = "id, userId, subtotal, discountTotal, taxTotal, shippingMethodId, shippingMethod, shippingTotal, total, currency, exchangeRate, status, shippingName, shippingLine1, shippingLine2, shippingCity, shippingRegion, shippingPostalCode, shippingCountry, shippingPhone, createdAt"
+
 type Store struct {
 	db *sql.DB
 }
@@ -13,8 +23,12 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) CreateOrder(order types.Order) (int, error) {
-	res, err := s.db.Exec("INSERT INTO orders (user_id, total, status, address) VALUES (?, ?, ?, ?)", order.UserID, order.Total, order.Status, order.Address)
+func (s *Store) CreateOrder(tx types.Tx, order types.Order) (int, error) {
+	a := order.ShippingAddress
+	res, err := tx.Exec(
+		"INSERT INTO orders (userId, subtotal, discountTotal, taxTotal, shippingMethodId, shippingMethod, shippingTotal, total, currency, exchangeRate, status, shippingName, shippingLine1, shippingLine2, shippingCity, shippingRegion, shippingPostalCode, shippingCountry, shippingPhone) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		order.UserID, order.Subtotal, order.DiscountTotal, order.TaxTotal, utils.NullableID(order.ShippingMethodID), order.ShippingMethod, order.ShippingTotal, order.Total, order.Currency, order.ExchangeRate, order.Status, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone,
+	)
 	if err != nil {
 		return 0, err
 	}
@@ -25,7 +39,242 @@ func (s *Store) CreateOrder(order types.Order) (int, error) {
 	return int(id), nil
 }
 
-func (s *Store) CreateOrderItem(item types.OrderItem) error {
-	_, err := s.db.Exec("INSERT INTO order_items (order_id, product_id, quantity, price) VALUES (?, ?, ?, ?)", item.OrderID, item.ProductID, item.Quantity, item.Price)
+func (s *Store) CreateOrderItem(tx types.Tx, item types.OrderItem) error {
+	_, err := tx.Exec("INSERT INTO order_items (orderId, productId, quantity, price, tax) VALUES (?, ?, ?, ?, ?)", item.OrderID, item.ProductID, item.Quantity, item.Price, item.Tax)
 	return err
 }
+
+// GetOrdersByUserID lists a user's orders newest first. A cursor continues
+// after (or, going backward, before) the order it was issued for.
+func (s *Store) GetOrdersByUserID(userID int, page types.Page) ([]types.Order, error) {
+	where := "userId = ?"
+	args := []any{userID}
+	order := "createdAt DESC, id DESC"
+
+	backward := page.Cursor != nil && page.Cursor.Backward
+	if page.Cursor != nil {
+		createdAt, err := time.Parse(time.RFC3339Nano, page.Cursor.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+
+		if backward {
+			where += " AND (createdAt > ? OR (createdAt = ? AND id > ?))"
+			order = "createdAt ASC, id ASC"
+		} else {
+			where += " AND (createdAt < ? OR (createdAt = ? AND id < ?))"
+		}
+		args = append(args, createdAt, createdAt, page.Cursor.ID)
+	}
+
+	args = append(args, page.Limit, page.Offset)
+	rows, err := s.db.Query("SELECT "+orderColumns+" FROM orders WHERE "+where+" ORDER BY "+order+" LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []types.Order{}
+	for rows.Next() {
+		o, err := scanRowsIntoOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *o)
+	}
+
+	if backward {
+		slices.Reverse(orders)
+	}
+
+	return orders, rows.Err()
+}
+
+func (s *Store) GetOrderByID(id int) (*types.Order, error) {
+	rows, err := s.db.Query("SELECT "+orderColumns+" FROM orders WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	o := new(types.Order)
+	for rows.Next() {
+		o, err = scanRowsIntoOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.ID == 0 {
+		return nil, errOrderNotFound
+	}
+
+	return o, nil
+}
+
+func (s *Store) GetOrderItems(orderID int) ([]types.OrderItem, error) {
+	rows, err := s.db.Query(`SELECT oi.id, oi.orderId, oi.productId, p.name, p.image, oi.quantity, oi.price, oi.tax, o.currency FROM order_items oi JOIN products p ON oi.productId = p.id JOIN orders o ON oi.orderId = o.id WHERE oi.orderId = ? ORDER BY oi.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []types.OrderItem{}
+	for rows.Next() {
+		var item types.OrderItem
+		var currency string
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName, &item.ProductImage, &item.Quantity, &item.Price, &item.Tax, &currency); err != nil {
+			return nil, err
+		}
+		item.Price = item.Price.In(currency)
+		item.Tax = item.Tax.In(currency)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// scanRowsIntoOrder reads orderColumns from either *sql.Rows or *sql.Row.
+func scanRowsIntoOrder(rows interface{ Scan(dest ...any) error }) (*types.Order, error) {
+	order := new(types.Order)
+	a := &order.ShippingAddress
+	var shippingMethodID sql.NullInt64
+
+	err := rows.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Subtotal,
+		&order.DiscountTotal,
+		&order.TaxTotal,
+		&shippingMethodID,
+		&order.ShippingMethod,
+		&order.ShippingTotal,
+		&order.Total,
+		&order.Currency,
+		&order.ExchangeRate,
+		&order.Status,
+		&a.Name,
+		&a.Line1,
+		&a.Line2,
+		&a.City,
+		&a.Region,
+		&a.PostalCode,
+		&a.Country,
+		&a.Phone,
+		&order.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	order.ShippingMethodID = int(shippingMethodID.Int64)
+
+	// Amounts are stored as plain decimals in the order's currency.
+	order.Subtotal = order.Subtotal.In(order.Currency)
+	order.DiscountTotal = order.DiscountTotal.In(order.Currency)
+	order.TaxTotal = order.TaxTotal.In(order.Currency)
+	order.ShippingTotal = order.ShippingTotal.In(order.Currency)
+	order.Total = order.Total.In(order.Currency)
+
+	return order, nil
+}
+
+func (s *Store) GetOrderForUpdate(tx types.Tx, id int) (*types.Order, error) {
+	order, err := scanRowsIntoOrder(tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ? FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		return nil, errOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *Store) UpdateOrderStatus(tx types.Tx, orderID int, status string) error {
+	_, err := tx.Exec("UPDATE orders SET status = ? WHERE id = ?", status, orderID)
+	return err
+}
+
+func (s *Store) CreateOrderStatusChange(tx types.Tx, change types.OrderStatusChange) error {
+	// Changes made by the system have no actor.
+	_, err := tx.Exec("INSERT INTO order_status_history (orderId, fromStatus, toStatus, actorId, note) VALUES (?, ?, ?, ?, ?)", change.OrderID, change.FromStatus, change.ToStatus, utils.NullableID(change.ActorID), change.Note)
+	return err
+}
+
+func (s *Store) GetOrderStatusHistory(orderID int) ([]types.OrderStatusChange, error) {
+	rows, err := s.db.Query("SELECT id, orderId, fromStatus, toStatus, actorId, note, createdAt FROM order_status_history WHERE orderId = ? ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []types.OrderStatusChange{}
+	for rows.Next() {
+		var c types.OrderStatusChange
+		var actorID sql.NullInt64
+		if err := rows.Scan(&c.ID, &c.OrderID, &c.FromStatus, &c.ToStatus, &actorID, &c.Note, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.ActorID = int(actorID.Int64)
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
+
+func (s *Store) CreateOrderDiscount(tx types.Tx, orderID int, d types.AppliedDiscount) error {
+	_, err := tx.Exec("INSERT INTO order_discounts (order_id, promotion_id, code, description, amount) VALUES (?, ?, ?, ?, ?)", orderID, d.PromotionID, d.Code, d.Description, d.Amount)
+	return err
+}
+
+func (s *Store) GetOrderDiscounts(orderID int) ([]types.AppliedDiscount, error) {
+	rows, err := s.db.Query("SELECT d.promotion_id, d.code, d.description, d.amount, o.currency FROM order_discounts d JOIN orders o ON d.order_id = o.id WHERE d.order_id = ? ORDER BY d.id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discounts := []types.AppliedDiscount{}
+	for rows.Next() {
+		var d types.AppliedDiscount
+		var promotionID sql.NullInt64
+		var currency string
+		if err := rows.Scan(&promotionID, &d.Code, &d.Description, &d.Amount, &currency); err != nil {
+			return nil, err
+		}
+		d.PromotionID = int(promotionID.Int64)
+		d.Amount = d.Amount.In(currency)
+		discounts = append(discounts, d)
+	}
+
+	return discounts, rows.Err()
+}
+
+func (s *Store) CreateOrderTax(tx types.Tx, orderID int, t types.TaxLine) error {
+	_, err := tx.Exec("INSERT INTO order_taxes (order_id, tax_rate_id, name, country, region, rate, inclusive, amount) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", orderID, utils.NullableID(t.TaxRateID), t.Name, t.Country, t.Region, t.Rate, t.Inclusive, t.Amount)
+	return err
+}
+
+func (s *Store) GetOrderTaxes(orderID int) ([]types.TaxLine, error) {
+	rows, err := s.db.Query("SELECT t.tax_rate_id, t.name, t.country, t.region, t.rate, t.inclusive, t.amount, o.currency FROM order_taxes t JOIN orders o ON t.order_id = o.id WHERE t.order_id = ? ORDER BY t.id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taxes := []types.TaxLine{}
+	for rows.Next() {
+		var t types.TaxLine
+		var taxRateID sql.NullInt64
+		var currency string
+		if err := rows.Scan(&taxRateID, &t.Name, &t.Country, &t.Region, &t.Rate, &t.Inclusive, &t.Amount, &currency); err != nil {
+			return nil, err
+		}
+		t.TaxRateID = int(taxRateID.Int64)
+		t.Amount = t.Amount.In(currency)
+		taxes = append(taxes, t)
+	}
+
+	return taxes, rows.Err()
+}
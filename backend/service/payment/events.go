@@ -0,0 +1,182 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"backend/types"
+)
+
+const (
+	eventIntentSucceeded = "payment_intent.succeeded"
+	eventIntentFailed    = "payment_intent.payment_failed"
+	eventChargeRefunded  = "charge.refunded"
+)
+
+var errStaleWebhook = errors.New("webhook timestamp outside tolerance")
+
+// ReceiveEvent stores a verified event and processes it. Providers retry
+// deliveries until they are acknowledged, so an event that was processed
+// before is not applied again; applied reports whether this call did.
+func (s *Service) ReceiveEvent(event *types.PaymentEvent, payload []byte) (applied bool, err error) {
+	_, err = s.eventStore.CreateWebhookEvent(types.WebhookEvent{
+		Provider: s.provider.Name(),
+		EventID:  event.ID,
+		Type:     event.Type,
+		IntentID: event.IntentID,
+		Payload:  payload,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return s.ProcessEvent(event.ID, false)
+}
+
+// ProcessEvent applies a stored event. The event row stays locked while it is
+// applied, so concurrent deliveries of the same event wait and then see it
+// processed. force re-applies processed events, for replays after a bug fix;
+// applying an event is a no-op once the payment has moved past it.
+func (s *Service) ProcessEvent(eventID string, force bool) (applied bool, err error) {
+	tx, err := s.transactor.BeginTx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	e, err := s.eventStore.GetWebhookEventForUpdate(tx, s.provider.Name(), eventID)
+	if err != nil {
+		return false, err
+	}
+
+	if e.ProcessedAt != nil && !force {
+		return false, nil
+	}
+
+	status, err := s.applyEvent(tx, e)
+	if err != nil {
+		// Release the row lock before recording the failure outside tx.
+		tx.Rollback()
+		if markErr := s.eventStore.MarkWebhookEventFailed(e.ID, err.Error()); markErr != nil {
+			log.Printf("failed to record failure of webhook event %s: %v", e.EventID, markErr)
+		}
+		return false, err
+	}
+
+	if err := s.eventStore.MarkWebhookEventProcessed(tx, e.ID, status); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// applyEvent moves the event's payment, and through it the order, along. It
+// returns the status to record for the event.
+func (s *Service) applyEvent(tx types.Tx, e *types.WebhookEvent) (string, error) {
+	switch e.Type {
+	case eventIntentSucceeded, eventIntentFailed, eventChargeRefunded:
+	default:
+		return types.WebhookEventIgnored, nil
+	}
+
+	found, err := s.store.GetPaymentByProviderRef(e.Provider, e.IntentID)
+	if errors.Is(err, errPaymentNotFound) {
+		return types.WebhookEventIgnored, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	p, err := s.store.GetPaymentForUpdate(tx, found.ID)
+	if err != nil {
+		return "", err
+	}
+
+	switch e.Type {
+	case eventIntentSucceeded:
+		if p.Status != types.PaymentStatusPending && p.Status != types.PaymentStatusFailed {
+			break
+		}
+
+		order, err := s.orderStore.GetOrderForUpdate(tx, p.OrderID)
+		if err != nil {
+			return "", err
+		}
+
+		// An order cancelled while its payment was under way, say when its
+		// reservation expired, has given its stock back and will not be
+		// fulfilled, so the money is returned.
+		if order.Status == types.OrderStatusCancelled || order.Status == types.OrderStatusRefunded {
+			log.Printf("refunding payment %d for order %d in status %s", p.ID, order.ID, order.Status)
+			if err := s.refund(*p); err != nil {
+				return "", err
+			}
+			if err := s.store.UpdatePaymentStatus(tx, p.ID, types.PaymentStatusRefunded, fmt.Sprintf("order %s before payment", order.Status)); err != nil {
+				return "", err
+			}
+			break
+		}
+		if order.Status != types.OrderStatusPending {
+			log.Printf("payment %d captured for order %d in status %s", p.ID, order.ID, order.Status)
+		}
+
+		if err := s.markCaptured(tx, p, order, 0); err != nil {
+			return "", err
+		}
+
+	case eventIntentFailed:
+		if p.Status == types.PaymentStatusPending {
+			if err := s.store.UpdatePaymentStatus(tx, p.ID, types.PaymentStatusFailed, "payment failed"); err != nil {
+				return "", err
+			}
+		}
+
+	case eventChargeRefunded:
+		if p.Status != types.PaymentStatusCaptured {
+			break
+		}
+
+		if err := s.store.UpdatePaymentStatus(tx, p.ID, types.PaymentStatusRefunded, ""); err != nil {
+			return "", err
+		}
+		if err := s.markRefunded(tx, p); err != nil {
+			return "", err
+		}
+	}
+
+	return types.WebhookEventProcessed, nil
+}
+
+// refundable lists the order statuses from which a refund made at the
+// provider moves an order to refunded.
+var refundable = []string{
+	types.OrderStatusPaid,
+	types.OrderStatusFulfilled,
+	types.OrderStatusShipped,
+	types.OrderStatusDelivered,
+}
+
+// markRefunded moves the order of a payment refunded at the provider to
+// refunded. Stock is not given back; returned goods are restocked by staff.
+func (s *Service) markRefunded(tx types.Tx, p *types.Payment) error {
+	order, err := s.orderStore.GetOrderForUpdate(tx, p.OrderID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(refundable, order.Status) {
+		return nil
+	}
+
+	if err := s.orderStore.UpdateOrderStatus(tx, order.ID, types.OrderStatusRefunded); err != nil {
+		return err
+	}
+
+	return s.orderStore.CreateOrderStatusChange(tx, types.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   types.OrderStatusRefunded,
+		Note:       fmt.Sprintf("payment %d refunded", p.ID),
+	})
+}
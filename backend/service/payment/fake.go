@@ -0,0 +1,113 @@
+package payment
+
+import (
+	"fmt"
+	"sync"
+
+	"backend/types"
+)
+
+const (
+	intentRequiresCapture = "requires_capture"
+	intentRequiresMethod  = "requires_payment_method"
+	intentSucceeded       = "succeeded"
+	intentRefunded        = "refunded"
+)
+
+// FakeProvider keeps intents in memory and answers deterministically, so the
+// payment flow runs without a network. Intents are confirmed on creation and
+// amounts ending in .02 are declined on capture.
+type FakeProvider struct {
+	mu            sync.Mutex
+	webhookSecret string
+	intents       map[string]*types.PaymentIntent
+	refunds       map[string]bool
+	next          int
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		webhookSecret: webhookSecret,
+		intents:       map[string]*types.PaymentIntent{},
+		refunds:       map[string]bool{},
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) CreateIntent(amount int64, currency string, orderID int) (*types.PaymentIntent, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next++
+	id := fmt.Sprintf("pi_fake_%06d", p.next)
+	intent := &types.PaymentIntent{
+		ID:           id,
+		ClientSecret: id + "_secret",
+		Amount:       amount,
+		Currency:     currency,
+		Status:       intentRequiresCapture,
+	}
+	p.intents[id] = intent
+
+	cp := *intent
+	return &cp, nil
+}
+
+func (p *FakeProvider) Capture(intentID string) (*types.PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("no such payment intent: %s", intentID)
+	}
+	if intent.Status != intentRequiresCapture {
+		return nil, fmt.Errorf("payment intent %s cannot be captured in status %s", intentID, intent.Status)
+	}
+
+	if declined(intent.Amount) {
+		intent.Status = intentRequiresMethod
+		return nil, fmt.Errorf("%w: card declined", ErrDeclined)
+	}
+
+	intent.Status = intentSucceeded
+	cp := *intent
+	return &cp, nil
+}
+
+func (p *FakeProvider) Refund(intentID string, amount int64, idempotencyKey string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if idempotencyKey != "" && p.refunds[idempotencyKey] {
+		return nil
+	}
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return fmt.Errorf("no such payment intent: %s", intentID)
+	}
+	if intent.Status != intentSucceeded {
+		return fmt.Errorf("payment intent %s has not been captured", intentID)
+	}
+	if amount > intent.Amount {
+		return fmt.Errorf("refund of %d exceeds captured amount %d", amount, intent.Amount)
+	}
+
+	intent.Status = intentRefunded
+	if idempotencyKey != "" {
+		p.refunds[idempotencyKey] = true
+	}
+	return nil
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, signature string) (*types.PaymentEvent, error) {
+	return verifyEvent(p.webhookSecret, payload, signature)
+}
@@ -0,0 +1,42 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+
+	"backend/config"
+	"backend/types"
+)
+
+// ErrDeclined is returned by providers when the customer's payment method
+// was refused.
+var ErrDeclined = errors.New("payment declined")
+
+// NewProvider returns the provider selected by PAYMENT_PROVIDER: "fake" (the
+// default) answers in process, "stripe" talks to a Stripe-compatible API at
+// STRIPE_API_URL, such as the stand-in started by cmd/paymentstub. Every
+// provider verifies webhooks with PAYMENT_WEBHOOK_SECRET, which has no
+// default, since whoever knows it can mark orders paid.
+func NewProvider(cfg config.Config) (types.PaymentProvider, error) {
+	if cfg.PaymentWebhookSecret == "" {
+		return nil, fmt.Errorf("PAYMENT_WEBHOOK_SECRET is required")
+	}
+
+	switch cfg.PaymentProvider {
+	case "fake", "":
+		return NewFakeProvider(cfg.PaymentWebhookSecret), nil
+	case "stripe":
+		if cfg.StripeSecretKey == "" {
+			return nil, fmt.Errorf("STRIPE_SECRET_KEY is required by the stripe provider")
+		}
+		return NewStripeProvider(cfg.StripeAPIURL, cfg.StripeSecretKey, cfg.PaymentWebhookSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.PaymentProvider)
+	}
+}
+
+// declined mirrors a provider's test cards: amounts ending in .02 are
+// refused, so the failure path can be exercised deterministically.
+func declined(amount int64) bool {
+	return amount%100 == 2
+}
@@ -0,0 +1,108 @@
+package payment
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/types"
+)
+
+func TestProviders(t *testing.T) {
+	server := httptest.NewServer(NewStandInServer("sk_test"))
+	defer server.Close()
+
+	providers := []types.PaymentProvider{
+		NewFakeProvider("whsec"),
+		NewStripeProvider(server.URL, "sk_test", "whsec"),
+	}
+
+	for _, provider := range providers {
+		t.Run(provider.Name(), func(t *testing.T) {
+			intent, err := provider.CreateIntent(2500, "usd", 1)
+			if err != nil {
+				t.Fatalf("error creating intent: %v", err)
+			}
+			if intent.ID == "" || intent.ClientSecret == "" || intent.Amount != 2500 {
+				t.Fatalf("unexpected intent %+v", intent)
+			}
+
+			captured, err := provider.Capture(intent.ID)
+			if err != nil {
+				t.Fatalf("error capturing intent: %v", err)
+			}
+			if captured.Status != intentSucceeded {
+				t.Errorf("expected status %q, got %q", intentSucceeded, captured.Status)
+			}
+
+			if _, err := provider.Capture(intent.ID); err == nil {
+				t.Error("expected a second capture to fail")
+			}
+
+			if err := provider.Refund(intent.ID, 2500, "refund-1"); err != nil {
+				t.Errorf("error refunding intent: %v", err)
+			}
+			if err := provider.Refund(intent.ID, 2500, "refund-1"); err != nil {
+				t.Errorf("expected a retried refund to succeed, got %v", err)
+			}
+			if err := provider.Refund(intent.ID, 2500, "refund-2"); err == nil {
+				t.Error("expected a second refund to fail")
+			}
+
+			declinedIntent, err := provider.CreateIntent(1002, "usd", 2)
+			if err != nil {
+				t.Fatalf("error creating intent: %v", err)
+			}
+			if _, err := provider.Capture(declinedIntent.ID); !errors.Is(err, ErrDeclined) {
+				t.Errorf("expected the payment to be declined, got %v", err)
+			}
+		})
+	}
+
+	t.Run("should reject a wrong API key", func(t *testing.T) {
+		provider := NewStripeProvider(server.URL, "sk_wrong", "whsec")
+		if _, err := provider.CreateIntent(2500, "usd", 1); err == nil {
+			t.Error("expected the request to be refused")
+		}
+	})
+}
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider(config.Config{PaymentWebhookSecret: "whsec"}); err != nil {
+		t.Errorf("Expected the fake provider by default, got %v", err)
+	}
+	if _, err := NewProvider(config.Config{}); err == nil {
+		t.Error("Expected a webhook secret to be required")
+	}
+	if _, err := NewProvider(config.Config{PaymentProvider: "stripe", PaymentWebhookSecret: "whsec"}); err == nil {
+		t.Error("Expected the stripe provider to require a secret key")
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	provider := NewFakeProvider("whsec")
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1"}}}`)
+
+	event, err := provider.VerifyWebhook(payload, SignWebhook("whsec", payload, time.Now()))
+	if err != nil {
+		t.Fatalf("error verifying webhook: %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != "payment_intent.succeeded" || event.IntentID != "pi_1" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	if _, err := provider.VerifyWebhook(payload, SignWebhook("other", payload, time.Now())); err == nil {
+		t.Error("expected a signature made with another secret to be rejected")
+	}
+
+	tampered := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_2"}}}`)
+	if _, err := provider.VerifyWebhook(tampered, SignWebhook("whsec", payload, time.Now())); err == nil {
+		t.Error("expected a tampered payload to be rejected")
+	}
+
+	if _, err := provider.VerifyWebhook(payload, "garbage"); err == nil {
+		t.Error("expected a malformed signature to be rejected")
+	}
+}
@@ -0,0 +1,182 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/config"
+	"backend/service/auth"
+	"backend/service/idempotency"
+	"backend/types"
+	"backend/utils"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	payments         *Service
+	store            types.PaymentStore
+	orderStore       types.OrderStore
+	userStore        types.UserStore
+	idempotencyStore types.IdempotencyStore
+}
+
+func NewHandler(payments *Service, store types.PaymentStore, orderStore types.OrderStore, userStore types.UserStore, idempotencyStore types.IdempotencyStore) *Handler {
+	return &Handler{
+		payments:         payments,
+		store:            store,
+		orderStore:       orderStore,
+		userStore:        userStore,
+		idempotencyStore: idempotencyStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/orders/{orderID}/payments", auth.WithJWTAuth(h.handleGetPayments, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/orders/{orderID}/payments", auth.WithJWTAuth(idempotency.WithIdempotencyKey(h.handleStartPayment, h.idempotencyStore), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/payments/{paymentID}/capture", auth.WithJWTAuth(idempotency.WithIdempotencyKey(h.handleCapture, h.idempotencyStore), h.userStore)).Methods(http.MethodPost)
+
+	router.HandleFunc("/webhooks/payments", h.handleWebhook).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleGetPayments(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.ownOrder(w, r)
+	if !ok {
+		return
+	}
+
+	payments, err := h.store.GetPaymentsByOrderID(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, payments)
+}
+
+// handleStartPayment opens a new payment for a pending order, for instance
+// after the one created at checkout was declined.
+func (h *Handler) handleStartPayment(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.ownOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if order.Status != types.OrderStatusPending {
+		utils.WriteError(w, http.StatusConflict, errOrderNotPayable)
+		return
+	}
+
+	session, err := h.payments.StartPayment(*order)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, session)
+}
+
+func (h *Handler) handleCapture(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	paymentID, err := strconv.Atoi(mux.Vars(r)["paymentID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payment ID"))
+		return
+	}
+
+	p, err := h.store.GetPaymentByID(paymentID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, errPaymentNotFound)
+		return
+	}
+
+	order, err := h.orderStore.GetOrderByID(p.OrderID)
+	if err != nil || order.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, errPaymentNotFound)
+		return
+	}
+
+	p, err = h.payments.Capture(p.ID, userID)
+	if errors.Is(err, ErrDeclined) {
+		utils.WriteError(w, http.StatusPaymentRequired, err)
+		return
+	}
+	if errors.Is(err, errPaymentNotPending) || errors.Is(err, errOrderNotPayable) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, p)
+}
+
+// handleWebhook receives provider notifications. Anything other than a 2xx
+// makes the provider retry later, so only bad requests and failures worth
+// retrying are reported as errors.
+func (h *Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	signature := r.Header.Get("Payment-Signature")
+	if signature == "" {
+		signature = r.Header.Get("Stripe-Signature")
+	}
+
+	event, err := h.payments.provider.VerifyWebhook(payload, signature)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// The signed timestamp keeps a captured delivery from being replayed
+	// later.
+	tolerance := time.Duration(config.Envs.PaymentWebhookToleranceInSeconds) * time.Second
+	if age := time.Since(event.SignedAt); age > tolerance || age < -tolerance {
+		utils.WriteError(w, http.StatusBadRequest, errStaleWebhook)
+		return
+	}
+
+	applied, err := h.payments.ReceiveEvent(event, payload)
+	if err != nil {
+		log.Printf("failed to process webhook event %s: %v", event.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to process event"))
+		return
+	}
+
+	status := "processed"
+	if !applied {
+		status = "duplicate"
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+// ownOrder loads the order named in the URL, writing a 404 unless it belongs
+// to the current user.
+func (h *Handler) ownOrder(w http.ResponseWriter, r *http.Request) (*types.Order, bool) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return nil, false
+	}
+
+	order, err := h.orderStore.GetOrderByID(orderID)
+	if err != nil || order.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+		return nil, false
+	}
+
+	return order, true
+}
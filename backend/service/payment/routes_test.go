@@ -0,0 +1,530 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/service/auth"
+	"backend/types"
+	"github.com/gorilla/mux"
+)
+
+func TestCapture(t *testing.T) {
+	var stock *mockInventory
+	newHandler := func(total string) (*Handler, *mockPaymentStore, *mockOrderStore, *types.PaymentSession) {
+		store := &mockPaymentStore{}
+		stock = &mockInventory{}
+		orderStore := &mockOrderStore{orders: map[int]*types.Order{
+			1: {ID: 1, UserID: 1, Total: types.MustParseMoney(total), Status: types.OrderStatusPending},
+		}}
+		payments := NewService(store, store, orderStore, NewFakeProvider("whsec"), stock, mockTransactor{})
+
+		session, err := payments.StartPayment(*orderStore.orders[1])
+		if err != nil {
+			t.Fatalf("error starting payment: %v", err)
+		}
+
+		return NewHandler(payments, store, orderStore, nil, nil), store, orderStore, session
+	}
+
+	serve := func(handler *Handler, method, path string, userID int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/orders/{orderID}/payments", handler.handleGetPayments).Methods(http.MethodGet)
+		router.HandleFunc("/orders/{orderID}/payments", handler.handleStartPayment).Methods(http.MethodPost)
+		router.HandleFunc("/payments/{paymentID}/capture", handler.handleCapture).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should mark the order paid once the payment is captured", func(t *testing.T) {
+		handler, store, orderStore, session := newHandler("25")
+
+		if orderStore.orders[1].Status != types.OrderStatusPending {
+			t.Fatalf("Expected the order to stay pending until capture, got %q", orderStore.orders[1].Status)
+		}
+
+		rr := serve(handler, http.MethodPost, fmt.Sprintf("/payments/%d/capture", session.PaymentID), 1)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if status := store.payments[0].Status; status != types.PaymentStatusCaptured {
+			t.Errorf("Expected payment status %q, got %q", types.PaymentStatusCaptured, status)
+		}
+		if status := orderStore.orders[1].Status; status != types.OrderStatusPaid {
+			t.Errorf("Expected order status %q, got %q", types.OrderStatusPaid, status)
+		}
+		if len(orderStore.history) != 1 || orderStore.history[0].ActorID != 1 {
+			t.Errorf("Expected one status change by the customer, got %+v", orderStore.history)
+		}
+		if len(stock.committed) != 1 || stock.committed[0] != 1 {
+			t.Errorf("Expected the stock of order 1 to be committed, got %v", stock.committed)
+		}
+
+		rr = serve(handler, http.MethodPost, fmt.Sprintf("/payments/%d/capture", session.PaymentID), 1)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d for a second capture, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should keep the order pending when the payment is declined", func(t *testing.T) {
+		handler, store, orderStore, session := newHandler("10.02")
+
+		rr := serve(handler, http.MethodPost, fmt.Sprintf("/payments/%d/capture", session.PaymentID), 1)
+		if rr.Code != http.StatusPaymentRequired {
+			t.Fatalf("Expected status code %d, got %d", http.StatusPaymentRequired, rr.Code)
+		}
+		if p := store.payments[0]; p.Status != types.PaymentStatusFailed || p.FailureReason == "" {
+			t.Errorf("Expected the payment to be recorded as failed, got %+v", p)
+		}
+		if status := orderStore.orders[1].Status; status != types.OrderStatusPending {
+			t.Errorf("Expected order status %q, got %q", types.OrderStatusPending, status)
+		}
+
+		rr = serve(handler, http.MethodPost, "/orders/1/payments", 1)
+		if rr.Code != http.StatusCreated {
+			t.Errorf("Expected status code %d for a new payment, got %d", http.StatusCreated, rr.Code)
+		}
+
+		rr = serve(handler, http.MethodGet, "/orders/1/payments", 1)
+		var payments []types.Payment
+		json.Unmarshal(rr.Body.Bytes(), &payments)
+		if len(payments) != 2 {
+			t.Errorf("Expected two payment attempts, got %d", len(payments))
+		}
+	})
+
+	t.Run("should hide other users' payments", func(t *testing.T) {
+		handler, _, _, session := newHandler("25")
+
+		rr := serve(handler, http.MethodPost, fmt.Sprintf("/payments/%d/capture", session.PaymentID), 2)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+
+		rr = serve(handler, http.MethodGet, "/orders/1/payments", 2)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should refund captured payments", func(t *testing.T) {
+		handler, store, _, session := newHandler("25")
+		serve(handler, http.MethodPost, fmt.Sprintf("/payments/%d/capture", session.PaymentID), 1)
+
+		if err := handler.payments.RefundOrder(mockTx{}, 1); err != nil {
+			t.Fatalf("error refunding order: %v", err)
+		}
+		if status := store.payments[0].Status; status != types.PaymentStatusRefunded {
+			t.Errorf("Expected payment status %q, got %q", types.PaymentStatusRefunded, status)
+		}
+	})
+
+	t.Run("should not refund twice when a refund is retried", func(t *testing.T) {
+		store := &mockPaymentStore{}
+		orderStore := &mockOrderStore{orders: map[int]*types.Order{
+			1: {ID: 1, UserID: 1, Total: types.MustParseMoney("25"), Status: types.OrderStatusPending},
+		}}
+		provider := &countingProvider{FakeProvider: NewFakeProvider("whsec")}
+		payments := NewService(store, store, orderStore, provider, &mockInventory{}, mockTransactor{})
+
+		session, _ := payments.StartPayment(*orderStore.orders[1])
+		if _, err := payments.Capture(session.PaymentID, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := payments.RefundOrder(mockTx{}, 1); err != nil {
+			t.Fatalf("error refunding order: %v", err)
+		}
+		// The caller's transaction rolled back after the provider refunded.
+		store.payments[0].Status = types.PaymentStatusCaptured
+
+		if err := payments.RefundOrder(mockTx{}, 1); err != nil {
+			t.Fatalf("error refunding order again: %v", err)
+		}
+		if provider.refunds != 1 {
+			t.Errorf("Expected the provider to be asked for one refund, got %d", provider.refunds)
+		}
+		if status := store.payments[0].Status; status != types.PaymentStatusRefunded {
+			t.Errorf("Expected payment status %q, got %q", types.PaymentStatusRefunded, status)
+		}
+	})
+}
+
+type countingProvider struct {
+	*FakeProvider
+	refunds int
+}
+
+func (p *countingProvider) Refund(intentID string, amount int64, idempotencyKey string) error {
+	p.refunds++
+	return p.FakeProvider.Refund(intentID, amount, idempotencyKey)
+}
+
+func TestWebhook(t *testing.T) {
+	store := &mockPaymentStore{}
+	orderStore := &mockOrderStore{orders: map[int]*types.Order{
+		1: {ID: 1, UserID: 1, Total: types.MustParseMoney("25"), Status: types.OrderStatusPending},
+	}}
+	provider := NewFakeProvider("whsec")
+	payments := NewService(store, store, orderStore, provider, &mockInventory{}, mockTransactor{})
+	handler := NewHandler(payments, store, orderStore, nil, nil)
+
+	session, _ := payments.StartPayment(*orderStore.orders[1])
+	intentID := store.payments[session.PaymentID-1].ProviderRef
+
+	event := func(id, eventType string) []byte {
+		return []byte(fmt.Sprintf(`{"id":%q,"type":%q,"data":{"object":{"id":%q}}}`, id, eventType, intentID))
+	}
+
+	deliver := func(payload []byte, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/payments", bytes.NewBuffer(payload))
+		req.Header.Set("Payment-Signature", signature)
+		rr := httptest.NewRecorder()
+		handler.handleWebhook(rr, req)
+		return rr
+	}
+
+	t.Run("should reject an invalid signature", func(t *testing.T) {
+		payload := event("evt_1", eventIntentSucceeded)
+		rr := deliver(payload, SignWebhook("wrong", payload, time.Now()))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject a stale delivery", func(t *testing.T) {
+		payload := event("evt_1", eventIntentSucceeded)
+		rr := deliver(payload, SignWebhook("whsec", payload, time.Now().Add(-time.Hour)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if len(store.events) != 0 {
+			t.Errorf("Expected no stored events, got %d", len(store.events))
+		}
+	})
+
+	t.Run("should record a failed event and apply it on replay", func(t *testing.T) {
+		orderStore.failLocks = true
+		payload := event("evt_1", eventIntentSucceeded)
+
+		rr := deliver(payload, SignWebhook("whsec", payload, time.Now()))
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		if e := store.events[0]; e.Status != types.WebhookEventFailed || e.Error == "" {
+			t.Errorf("Expected the event to be recorded as failed, got %+v", e)
+		}
+
+		orderStore.failLocks = false
+		if _, err := payments.ProcessEvent("evt_1", true); err != nil {
+			t.Fatalf("error replaying event: %v", err)
+		}
+		if status := orderStore.orders[1].Status; status != types.OrderStatusPaid {
+			t.Errorf("Expected order status %q, got %q", types.OrderStatusPaid, status)
+		}
+		if len(orderStore.history) != 1 || orderStore.history[0].ActorID != 0 {
+			t.Errorf("Expected one status change by the system, got %+v", orderStore.history)
+		}
+	})
+
+	t.Run("should process a retried delivery once", func(t *testing.T) {
+		payload := event("evt_1", eventIntentSucceeded)
+
+		rr := deliver(payload, SignWebhook("whsec", payload, time.Now()))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var body map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if body["status"] != "duplicate" {
+			t.Errorf("Expected the delivery to be acknowledged as a duplicate, got %v", body)
+		}
+		if len(store.events) != 1 || len(orderStore.history) != 1 {
+			t.Errorf("Expected one stored event and one status change, got %d and %d", len(store.events), len(orderStore.history))
+		}
+	})
+
+	t.Run("should ignore unknown event types", func(t *testing.T) {
+		payload := event("evt_2", "customer.created")
+
+		rr := deliver(payload, SignWebhook("whsec", payload, time.Now()))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if e := store.events[1]; e.Status != types.WebhookEventIgnored {
+			t.Errorf("Expected the event to be ignored, got %q", e.Status)
+		}
+	})
+
+	t.Run("should record a refund", func(t *testing.T) {
+		payload := []byte(fmt.Sprintf(`{"id":"evt_3","type":%q,"data":{"object":{"id":"ch_1","payment_intent":%q}}}`, eventChargeRefunded, intentID))
+
+		rr := deliver(payload, SignWebhook("whsec", payload, time.Now()))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if status := store.payments[0].Status; status != types.PaymentStatusRefunded {
+			t.Errorf("Expected payment status %q, got %q", types.PaymentStatusRefunded, status)
+		}
+		if status := orderStore.orders[1].Status; status != types.OrderStatusRefunded {
+			t.Errorf("Expected order status %q, got %q", types.OrderStatusRefunded, status)
+		}
+		if len(orderStore.history) != 2 || orderStore.history[1].ToStatus != types.OrderStatusRefunded {
+			t.Errorf("Expected the refund in the order's history, got %+v", orderStore.history)
+		}
+	})
+}
+
+func TestWebhookForCancelledOrder(t *testing.T) {
+	store := &mockPaymentStore{}
+	orderStore := &mockOrderStore{orders: map[int]*types.Order{
+		1: {ID: 1, UserID: 1, Total: types.MustParseMoney("25"), Status: types.OrderStatusPending},
+	}}
+	provider := NewFakeProvider("whsec")
+	stock := &mockInventory{}
+	payments := NewService(store, store, orderStore, provider, stock, mockTransactor{})
+	handler := NewHandler(payments, store, orderStore, nil, nil)
+
+	session, _ := payments.StartPayment(*orderStore.orders[1])
+	intentID := store.payments[session.PaymentID-1].ProviderRef
+
+	// The customer pays only after the order was cancelled.
+	if _, err := provider.Capture(intentID); err != nil {
+		t.Fatal(err)
+	}
+	orderStore.orders[1].Status = types.OrderStatusCancelled
+
+	payload := []byte(fmt.Sprintf(`{"id":"evt_1","type":%q,"data":{"object":{"id":%q}}}`, eventIntentSucceeded, intentID))
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/payments", bytes.NewBuffer(payload))
+	req.Header.Set("Payment-Signature", SignWebhook("whsec", payload, time.Now()))
+	rr := httptest.NewRecorder()
+	handler.handleWebhook(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if status := store.payments[0].Status; status != types.PaymentStatusRefunded {
+		t.Errorf("Expected payment status %q, got %q", types.PaymentStatusRefunded, status)
+	}
+	if status := orderStore.orders[1].Status; status != types.OrderStatusCancelled {
+		t.Errorf("Expected the order to stay cancelled, got %q", status)
+	}
+	if len(stock.committed) != 0 {
+		t.Errorf("Expected no stock to be committed, got %v", stock.committed)
+	}
+}
+
+type mockTx struct{}
+
+func (mockTx) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (mockTx) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (mockTx) QueryRow(query string, args ...any) *sql.Row        { return nil }
+func (mockTx) Commit() error                                      { return nil }
+func (mockTx) Rollback() error                                    { return nil }
+
+type mockTransactor struct{}
+
+func (mockTransactor) BeginTx() (types.Tx, error) {
+	return mockTx{}, nil
+}
+
+type mockInventory struct {
+	types.InventoryService
+	committed []int
+}
+
+func (m *mockInventory) Commit(tx types.Tx, orderID int) error {
+	m.committed = append(m.committed, orderID)
+	return nil
+}
+
+type mockPaymentStore struct {
+	payments []*types.Payment
+	events   []*types.WebhookEvent
+	refunds  map[int]*types.Refund
+}
+
+func (m *mockPaymentStore) CreatePayment(p types.Payment) (int, error) {
+	p.ID = len(m.payments) + 1
+	m.payments = append(m.payments, &p)
+	return p.ID, nil
+}
+
+func (m *mockPaymentStore) GetPaymentByID(id int) (*types.Payment, error) {
+	if id < 1 || id > len(m.payments) {
+		return nil, errPaymentNotFound
+	}
+	cp := *m.payments[id-1]
+	return &cp, nil
+}
+
+func (m *mockPaymentStore) GetPaymentByProviderRef(provider, providerRef string) (*types.Payment, error) {
+	for _, p := range m.payments {
+		if p.Provider == provider && p.ProviderRef == providerRef {
+			cp := *p
+			return &cp, nil
+		}
+	}
+	return nil, errPaymentNotFound
+}
+
+func (m *mockPaymentStore) GetPaymentsByOrderID(orderID int) ([]types.Payment, error) {
+	payments := []types.Payment{}
+	for _, p := range m.payments {
+		if p.OrderID == orderID {
+			payments = append(payments, *p)
+		}
+	}
+	return payments, nil
+}
+
+func (m *mockPaymentStore) GetPaymentForUpdate(tx types.Tx, id int) (*types.Payment, error) {
+	return m.GetPaymentByID(id)
+}
+
+func (m *mockPaymentStore) UpdatePaymentStatus(tx types.Tx, id int, status string, failureReason string) error {
+	m.payments[id-1].Status = status
+	m.payments[id-1].FailureReason = failureReason
+	return nil
+}
+
+func (m *mockPaymentStore) CreateRefund(r types.Refund) (bool, error) {
+	if m.refunds == nil {
+		m.refunds = map[int]*types.Refund{}
+	}
+	if _, ok := m.refunds[r.PaymentID]; ok {
+		return false, nil
+	}
+	m.refunds[r.PaymentID] = &r
+	return true, nil
+}
+
+func (m *mockPaymentStore) GetRefund(paymentID int) (*types.Refund, error) {
+	r, ok := m.refunds[paymentID]
+	if !ok {
+		return nil, errRefundNotFound
+	}
+	cp := *r
+	return &cp, nil
+}
+
+func (m *mockPaymentStore) MarkRefundSucceeded(paymentID int) error {
+	m.refunds[paymentID].Status = types.RefundStatusSucceeded
+	return nil
+}
+
+func (m *mockPaymentStore) CreateWebhookEvent(e types.WebhookEvent) (bool, error) {
+	for _, existing := range m.events {
+		if existing.Provider == e.Provider && existing.EventID == e.EventID {
+			return false, nil
+		}
+	}
+	e.ID = len(m.events) + 1
+	e.Status = types.WebhookEventReceived
+	m.events = append(m.events, &e)
+	return true, nil
+}
+
+func (m *mockPaymentStore) GetWebhookEventForUpdate(tx types.Tx, provider, eventID string) (*types.WebhookEvent, error) {
+	for _, e := range m.events {
+		if e.Provider == provider && e.EventID == eventID {
+			cp := *e
+			return &cp, nil
+		}
+	}
+	return nil, errWebhookEventNotFound
+}
+
+func (m *mockPaymentStore) GetWebhookEventsByStatus(status string) ([]types.WebhookEvent, error) {
+	events := []types.WebhookEvent{}
+	for _, e := range m.events {
+		if e.Status == status {
+			events = append(events, *e)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockPaymentStore) MarkWebhookEventProcessed(tx types.Tx, id int, status string) error {
+	now := time.Now()
+	m.events[id-1].Status = status
+	m.events[id-1].Error = ""
+	m.events[id-1].ProcessedAt = &now
+	return nil
+}
+
+func (m *mockPaymentStore) MarkWebhookEventFailed(id int, reason string) error {
+	m.events[id-1].Status = types.WebhookEventFailed
+	m.events[id-1].Error = reason
+	return nil
+}
+
+type mockOrderStore struct {
+	orders    map[int]*types.Order
+	history   []types.OrderStatusChange
+	failLocks bool
+}
+
+func (m *mockOrderStore) CreateOrder(tx types.Tx, order types.Order) (int, error) { return 0, nil }
+func (m *mockOrderStore) CreateOrderItem(tx types.Tx, item types.OrderItem) error { return nil }
+func (m *mockOrderStore) GetOrdersByUserID(userID int, page types.Page) ([]types.Order, error) {
+	return nil, nil
+}
+func (m *mockOrderStore) GetOrderItems(orderID int) ([]types.OrderItem, error) { return nil, nil }
+
+func (m *mockOrderStore) GetOrderByID(id int) (*types.Order, error) {
+	o, ok := m.orders[id]
+	if !ok {
+		return nil, fmt.Errorf("order not found")
+	}
+	cp := *o
+	return &cp, nil
+}
+
+func (m *mockOrderStore) GetOrderForUpdate(tx types.Tx, id int) (*types.Order, error) {
+	if m.failLocks {
+		return nil, fmt.Errorf("lock wait timeout exceeded")
+	}
+	return m.GetOrderByID(id)
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(tx types.Tx, orderID int, status string) error {
+	m.orders[orderID].Status = status
+	return nil
+}
+
+func (m *mockOrderStore) CreateOrderStatusChange(tx types.Tx, change types.OrderStatusChange) error {
+	m.history = append(m.history, change)
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderStatusHistory(orderID int) ([]types.OrderStatusChange, error) {
+	return m.history, nil
+}
+
+func (m *mockOrderStore) CreateOrderDiscount(tx types.Tx, orderID int, discount types.AppliedDiscount) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderDiscounts(orderID int) ([]types.AppliedDiscount, error) {
+	return []types.AppliedDiscount{}, nil
+}
+
+func (m *mockOrderStore) CreateOrderTax(tx types.Tx, orderID int, tax types.TaxLine) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderTaxes(orderID int) ([]types.TaxLine, error) {
+	return []types.TaxLine{}, nil
+}
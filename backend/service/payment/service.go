@@ -0,0 +1,217 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/config"
+	"backend/types"
+)
+
+var (
+	errPaymentNotPending = errors.New("payment is not pending")
+	errOrderNotPayable   = errors.New("order is not awaiting payment")
+)
+
+// Service takes payments for orders through a PaymentProvider. Orders only
+// become paid once their payment has been captured.
+type Service struct {
+	store      types.PaymentStore
+	eventStore types.WebhookEventStore
+	orderStore types.OrderStore
+	provider   types.PaymentProvider
+	inventory  types.InventoryService
+	transactor types.Transactor
+}
+
+func NewService(
+	store types.PaymentStore,
+	eventStore types.WebhookEventStore,
+	orderStore types.OrderStore,
+	provider types.PaymentProvider,
+	inventory types.InventoryService,
+	transactor types.Transactor,
+) *Service {
+	return &Service{
+		store:      store,
+		eventStore: eventStore,
+		orderStore: orderStore,
+		provider:   provider,
+		inventory:  inventory,
+		transactor: transactor,
+	}
+}
+
+// StartPayment opens a payment intent for the order's total and records the
+// attempt.
+func (s *Service) StartPayment(order types.Order) (*types.PaymentSession, error) {
+	// Providers take lower case currency codes.
+	currency := strings.ToLower(order.Currency)
+	if currency == "" {
+		currency = config.Envs.Currency
+	}
+
+	intent, err := s.provider.CreateIntent(order.Total.Minor, currency, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.store.CreatePayment(types.Payment{
+		OrderID:     order.ID,
+		Provider:    s.provider.Name(),
+		ProviderRef: intent.ID,
+		Amount:      order.Total,
+		Currency:    currency,
+		Status:      types.PaymentStatusPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.PaymentSession{
+		PaymentID:    id,
+		ClientSecret: intent.ClientSecret,
+		Amount:       order.Total,
+		Currency:     currency,
+		Status:       types.PaymentStatusPending,
+	}, nil
+}
+
+// Capture charges a pending payment and marks its order paid on behalf of
+// actorID. A declined payment is recorded as failed and the order stays
+// pending so that the customer can try again.
+func (s *Service) Capture(paymentID int, actorID int) (*types.Payment, error) {
+	tx, err := s.transactor.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	p, err := s.store.GetPaymentForUpdate(tx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != types.PaymentStatusPending {
+		return nil, errPaymentNotPending
+	}
+
+	order, err := s.orderStore.GetOrderForUpdate(tx, p.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != types.OrderStatusPending {
+		return nil, errOrderNotPayable
+	}
+
+	_, err = s.provider.Capture(p.ProviderRef)
+	if errors.Is(err, ErrDeclined) {
+		if err := s.store.UpdatePaymentStatus(tx, p.ID, types.PaymentStatusFailed, err.Error()); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		p.Status, p.FailureReason = types.PaymentStatusFailed, err.Error()
+		return p, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.markCaptured(tx, p, order, actorID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	p.Status = types.PaymentStatusCaptured
+	return p, nil
+}
+
+// markCaptured records that p was captured and, if its order is still
+// pending, marks the order paid and takes the stock reserved for it off
+// hand.
+func (s *Service) markCaptured(tx types.Tx, p *types.Payment, order *types.Order, actorID int) error {
+	if err := s.store.UpdatePaymentStatus(tx, p.ID, types.PaymentStatusCaptured, ""); err != nil {
+		return err
+	}
+
+	if order.Status != types.OrderStatusPending {
+		return nil
+	}
+
+	if err := s.inventory.Commit(tx, order.ID); err != nil {
+		return err
+	}
+
+	if err := s.orderStore.UpdateOrderStatus(tx, order.ID, types.OrderStatusPaid); err != nil {
+		return err
+	}
+
+	return s.orderStore.CreateOrderStatusChange(tx, types.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   types.OrderStatusPaid,
+		ActorID:    actorID,
+		Note:       fmt.Sprintf("payment %d captured", p.ID),
+	})
+}
+
+// RefundOrder refunds every captured payment of an order. It runs inside the
+// caller's transaction so the payments and the order's status change
+// together.
+func (s *Service) RefundOrder(tx types.Tx, orderID int) error {
+	payments, err := s.store.GetPaymentsByOrderID(orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range payments {
+		if p.Status != types.PaymentStatusCaptured {
+			continue
+		}
+
+		if err := s.refund(p); err != nil {
+			return err
+		}
+
+		if err := s.store.UpdatePaymentStatus(tx, p.ID, types.PaymentStatusRefunded, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refund asks the provider to refund p unless it already has. The refund is
+// recorded outside the caller's transaction before the provider is asked,
+// so that a rolled back caller retried later, or a replayed event, finds it.
+// A refund recorded but never confirmed is asked for again under the same
+// idempotency key, which the provider does not refund twice.
+func (s *Service) refund(p types.Payment) error {
+	_, err := s.store.CreateRefund(types.Refund{
+		PaymentID: p.ID,
+		Amount:    p.Amount,
+		Status:    types.RefundStatusRequested,
+	})
+	if err != nil {
+		return err
+	}
+
+	r, err := s.store.GetRefund(p.ID)
+	if err != nil {
+		return err
+	}
+	if r.Status == types.RefundStatusSucceeded {
+		return nil
+	}
+
+	if err := s.provider.Refund(p.ProviderRef, p.Amount.Minor, fmt.Sprintf("refund-payment-%d", p.ID)); err != nil {
+		return err
+	}
+
+	return s.store.MarkRefundSucceeded(p.ID)
+}
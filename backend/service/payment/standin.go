@@ -0,0 +1,116 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backend/utils"
+	"github.com/gorilla/mux"
+)
+
+// StandInServer answers the subset of Stripe's API that StripeProvider uses,
+// backed by a FakeProvider, so the HTTP integration can be exercised offline.
+type StandInServer struct {
+	secretKey string
+	fake      *FakeProvider
+	router    *mux.Router
+}
+
+func NewStandInServer(secretKey string) *StandInServer {
+	s := &StandInServer{
+		secretKey: secretKey,
+		fake:      NewFakeProvider(""),
+		router:    mux.NewRouter(),
+	}
+
+	s.router.HandleFunc("/v1/payment_intents", s.handleCreateIntent).Methods(http.MethodPost)
+	s.router.HandleFunc("/v1/payment_intents/{id}/capture", s.handleCapture).Methods(http.MethodPost)
+	s.router.HandleFunc("/v1/refunds", s.handleRefund).Methods(http.MethodPost)
+
+	return s
+}
+
+func (s *StandInServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.secretKey {
+		writeStripeError(w, http.StatusUnauthorized, "invalid_request_error", "", "Invalid API Key provided")
+		return
+	}
+
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *StandInServer) handleCreateIntent(w http.ResponseWriter, r *http.Request) {
+	amount, err := strconv.ParseInt(r.FormValue("amount"), 10, 64)
+	if err != nil {
+		writeStripeError(w, http.StatusBadRequest, "invalid_request_error", "parameter_invalid_integer", "Invalid integer: amount")
+		return
+	}
+
+	orderID, _ := strconv.Atoi(r.FormValue("metadata[order_id]"))
+	intent, err := s.fake.CreateIntent(amount, r.FormValue("currency"), orderID)
+	if err != nil {
+		writeStripeError(w, http.StatusBadRequest, "invalid_request_error", "amount_too_small", err.Error())
+		return
+	}
+
+	writeIntent(w, intent.ID, intent.Amount, intent.Currency, intent.Status, intent.ClientSecret)
+}
+
+func (s *StandInServer) handleCapture(w http.ResponseWriter, r *http.Request) {
+	intent, err := s.fake.Capture(mux.Vars(r)["id"])
+	if errors.Is(err, ErrDeclined) {
+		writeStripeError(w, http.StatusPaymentRequired, "card_error", "card_declined", "Your card was declined.")
+		return
+	}
+	if err != nil {
+		writeStripeError(w, http.StatusBadRequest, "invalid_request_error", "payment_intent_unexpected_state", err.Error())
+		return
+	}
+
+	writeIntent(w, intent.ID, intent.Amount, intent.Currency, intent.Status, intent.ClientSecret)
+}
+
+func (s *StandInServer) handleRefund(w http.ResponseWriter, r *http.Request) {
+	intentID := r.FormValue("payment_intent")
+	amount, err := strconv.ParseInt(r.FormValue("amount"), 10, 64)
+	if err != nil {
+		writeStripeError(w, http.StatusBadRequest, "invalid_request_error", "parameter_invalid_integer", "Invalid integer: amount")
+		return
+	}
+
+	if err := s.fake.Refund(intentID, amount, r.Header.Get("Idempotency-Key")); err != nil {
+		writeStripeError(w, http.StatusBadRequest, "invalid_request_error", "charge_not_refundable", err.Error())
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"id":             fmt.Sprintf("re_%s", intentID),
+		"object":         "refund",
+		"amount":         amount,
+		"payment_intent": intentID,
+		"status":         "succeeded",
+	})
+}
+
+func writeIntent(w http.ResponseWriter, id string, amount int64, currency, status, clientSecret string) {
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"id":            id,
+		"object":        "payment_intent",
+		"amount":        amount,
+		"currency":      currency,
+		"status":        status,
+		"client_secret": clientSecret,
+	})
+}
+
+func writeStripeError(w http.ResponseWriter, status int, errType, code, message string) {
+	utils.WriteJSON(w, status, map[string]any{
+		"error": map[string]string{
+			"type":    errType,
+			"code":    code,
+			"message": message,
+		},
+	})
+}
@@ -0,0 +1,233 @@
+package payment
+
+import (
+	"database/sql"
+	"errors"
+
+	"backend/types"
+)
+
+var (
+	errPaymentNotFound      = errors.New("payment not found")
+	errWebhookEventNotFound = errors.New("webhook event not found")
+	errRefundNotFound       = errors.New("refund not found")
+)
+
+const (
+	paymentColumns      = "id, order_id, provider, provider_ref, amount, currency, status, failure_reason, created_at"
+	webhookEventColumns = "id, provider, event_id, type, intent_id, payload, status, error, received_at, processed_at"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreatePayment(p types.Payment) (int, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO payments (order_id, provider, provider_ref, amount, currency, status) VALUES (?, ?, ?, ?, ?, ?)",
+		p.OrderID, p.Provider, p.ProviderRef, p.Amount, p.Currency, p.Status,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) GetPaymentByID(id int) (*types.Payment, error) {
+	p, err := scanRowsIntoPayment(s.db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, errPaymentNotFound
+	}
+	return p, err
+}
+
+func (s *Store) GetPaymentsByOrderID(orderID int) ([]types.Payment, error) {
+	rows, err := s.db.Query("SELECT "+paymentColumns+" FROM payments WHERE order_id = ? ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []types.Payment{}
+	for rows.Next() {
+		p, err := scanRowsIntoPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, *p)
+	}
+
+	return payments, rows.Err()
+}
+
+func (s *Store) GetPaymentForUpdate(tx types.Tx, id int) (*types.Payment, error) {
+	p, err := scanRowsIntoPayment(tx.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id = ? FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		return nil, errPaymentNotFound
+	}
+	return p, err
+}
+
+func (s *Store) UpdatePaymentStatus(tx types.Tx, id int, status string, failureReason string) error {
+	_, err := tx.Exec("UPDATE payments SET status = ?, failure_reason = ? WHERE id = ?", status, failureReason, id)
+	return err
+}
+
+func scanRowsIntoPayment(rows interface{ Scan(dest ...any) error }) (*types.Payment, error) {
+	p := new(types.Payment)
+
+	err := rows.Scan(
+		&p.ID,
+		&p.OrderID,
+		&p.Provider,
+		&p.ProviderRef,
+		&p.Amount,
+		&p.Currency,
+		&p.Status,
+		&p.FailureReason,
+		&p.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.Amount = p.Amount.In(p.Currency)
+
+	return p, nil
+}
+
+func (s *Store) GetPaymentByProviderRef(provider, providerRef string) (*types.Payment, error) {
+	p, err := scanRowsIntoPayment(s.db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE provider = ? AND provider_ref = ?", provider, providerRef))
+	if err == sql.ErrNoRows {
+		return nil, errPaymentNotFound
+	}
+	return p, err
+}
+
+func (s *Store) CreateRefund(r types.Refund) (bool, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO refunds (payment_id, amount, status) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE payment_id = payment_id",
+		r.PaymentID, r.Amount, r.Status,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (s *Store) GetRefund(paymentID int) (*types.Refund, error) {
+	r := new(types.Refund)
+	err := s.db.QueryRow("SELECT payment_id, amount, status, created_at FROM refunds WHERE payment_id = ?", paymentID).
+		Scan(&r.PaymentID, &r.Amount, &r.Status, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errRefundNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (s *Store) MarkRefundSucceeded(paymentID int) error {
+	_, err := s.db.Exec("UPDATE refunds SET status = ? WHERE payment_id = ?", types.RefundStatusSucceeded, paymentID)
+	return err
+}
+
+func (s *Store) CreateWebhookEvent(e types.WebhookEvent) (bool, error) {
+	// Without CLIENT_FOUND_ROWS a duplicate key update that changes nothing
+	// reports zero affected rows.
+	res, err := s.db.Exec(
+		"INSERT INTO webhook_events (provider, event_id, type, intent_id, payload) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE id = id",
+		e.Provider, e.EventID, e.Type, e.IntentID, e.Payload,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (s *Store) GetWebhookEventForUpdate(tx types.Tx, provider, eventID string) (*types.WebhookEvent, error) {
+	e, err := scanRowsIntoWebhookEvent(tx.QueryRow("SELECT "+webhookEventColumns+" FROM webhook_events WHERE provider = ? AND event_id = ? FOR UPDATE", provider, eventID))
+	if err == sql.ErrNoRows {
+		return nil, errWebhookEventNotFound
+	}
+	return e, err
+}
+
+func (s *Store) GetWebhookEventsByStatus(status string) ([]types.WebhookEvent, error) {
+	rows, err := s.db.Query("SELECT "+webhookEventColumns+" FROM webhook_events WHERE status = ? ORDER BY id", status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []types.WebhookEvent{}
+	for rows.Next() {
+		e, err := scanRowsIntoWebhookEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *e)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *Store) MarkWebhookEventProcessed(tx types.Tx, id int, status string) error {
+	_, err := tx.Exec("UPDATE webhook_events SET status = ?, error = '', processed_at = CURRENT_TIMESTAMP WHERE id = ?", status, id)
+	return err
+}
+
+func (s *Store) MarkWebhookEventFailed(id int, reason string) error {
+	_, err := s.db.Exec("UPDATE webhook_events SET status = ?, error = LEFT(?, 255) WHERE id = ?", types.WebhookEventFailed, reason, id)
+	return err
+}
+
+func scanRowsIntoWebhookEvent(rows interface{ Scan(dest ...any) error }) (*types.WebhookEvent, error) {
+	e := new(types.WebhookEvent)
+	var processedAt sql.NullTime
+
+	err := rows.Scan(
+		&e.ID,
+		&e.Provider,
+		&e.EventID,
+		&e.Type,
+		&e.IntentID,
+		&e.Payload,
+		&e.Status,
+		&e.Error,
+		&e.ReceivedAt,
+		&processedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if processedAt.Valid {
+		e.ProcessedAt = &processedAt.Time
+	}
+
+	return e, nil
+}
@@ -0,0 +1,130 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/types"
+)
+
+// StripeProvider talks to an API shaped like Stripe's payment intents API:
+// form encoded requests, bearer authentication and manual capture.
+type StripeProvider struct {
+	baseURL       string
+	secretKey     string
+	webhookSecret string
+	client        *http.Client
+}
+
+func NewStripeProvider(baseURL, secretKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type stripeIntent struct {
+	ID           string `json:"id"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+	ClientSecret string `json:"client_secret"`
+}
+
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+func (p *StripeProvider) CreateIntent(amount int64, currency string, orderID int) (*types.PaymentIntent, error) {
+	var intent stripeIntent
+	err := p.post("/v1/payment_intents", url.Values{
+		"amount":             {strconv.FormatInt(amount, 10)},
+		"currency":           {currency},
+		"capture_method":     {"manual"},
+		"metadata[order_id]": {strconv.Itoa(orderID)},
+	}, "", &intent)
+	if err != nil {
+		return nil, err
+	}
+
+	return intent.toPaymentIntent(), nil
+}
+
+func (p *StripeProvider) Capture(intentID string) (*types.PaymentIntent, error) {
+	var intent stripeIntent
+	if err := p.post("/v1/payment_intents/"+url.PathEscape(intentID)+"/capture", url.Values{}, "", &intent); err != nil {
+		return nil, err
+	}
+
+	return intent.toPaymentIntent(), nil
+}
+
+func (p *StripeProvider) Refund(intentID string, amount int64, idempotencyKey string) error {
+	return p.post("/v1/refunds", url.Values{
+		"payment_intent": {intentID},
+		"amount":         {strconv.FormatInt(amount, 10)},
+	}, idempotencyKey, nil)
+}
+
+func (p *StripeProvider) VerifyWebhook(payload []byte, signature string) (*types.PaymentEvent, error) {
+	return verifyEvent(p.webhookSecret, payload, signature)
+}
+
+// post sends form to path. A non-empty idempotencyKey is sent as Stripe's
+// Idempotency-Key header, so a retried request is not carried out twice.
+func (p *StripeProvider) post(path string, form url.Values, idempotencyKey string, out any) error {
+	req, err := http.NewRequest(http.MethodPost, p.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr stripeError
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Error.Type == "card_error" {
+			return fmt.Errorf("%w: %s", ErrDeclined, apiErr.Error.Message)
+		}
+		return fmt.Errorf("payment provider returned %d: %s", resp.StatusCode, apiErr.Error.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (i stripeIntent) toPaymentIntent() *types.PaymentIntent {
+	return &types.PaymentIntent{
+		ID:           i.ID,
+		ClientSecret: i.ClientSecret,
+		Amount:       i.Amount,
+		Currency:     i.Currency,
+		Status:       i.Status,
+	}
+}
@@ -0,0 +1,97 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/types"
+)
+
+// SignWebhook signs payload the way webhook deliveries are signed:
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<payload>">".
+func SignWebhook(secret string, payload []byte, timestamp time.Time) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", t, computeSignature(secret, t, payload))
+}
+
+func computeSignature(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature checks a signature header made by SignWebhook and returns
+// the time it was signed at.
+func verifySignature(secret string, payload []byte, header string) (time.Time, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return time.Time{}, fmt.Errorf("malformed webhook signature")
+	}
+
+	expected := computeSignature(secret, timestamp, payload)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return time.Unix(unix, 0), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid webhook signature")
+}
+
+type webhookEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID            string `json:"id"`
+			PaymentIntent string `json:"payment_intent"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+func verifyEvent(secret string, payload []byte, signature string) (*types.PaymentEvent, error) {
+	signedAt, err := verifySignature(secret, payload, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var event webhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %v", err)
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, fmt.Errorf("invalid webhook payload: missing id or type")
+	}
+
+	// Charge and refund events name their intent; intent events are one.
+	intentID := event.Data.Object.PaymentIntent
+	if intentID == "" {
+		intentID = event.Data.Object.ID
+	}
+
+	return &types.PaymentEvent{
+		ID:       event.ID,
+		Type:     event.Type,
+		IntentID: intentID,
+		SignedAt: signedAt,
+	}, nil
+}
@@ -0,0 +1,194 @@
+package product
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/types"
+)
+
+// categoryTreeQuery selects the ID of the category with the given slug and of
+// every category below it.
+const categoryTreeQuery = `WITH RECURSIVE tree (id) AS (
+	SELECT id FROM categories WHERE slug = ?
+	UNION ALL
+	SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+) SELECT id FROM tree`
+
+type sortOrder struct {
+	column string
+	desc   bool
+}
+
+var sortOrders = map[string]sortOrder{
+	types.ProductSortPriceAsc:  {"price", false},
+	types.ProductSortPriceDesc: {"price", true},
+	types.ProductSortNameAsc:   {"name", false},
+	types.ProductSortNameDesc:  {"name", true},
+	types.ProductSortNewest:    {"createdAt", true},
+}
+
+// listQuery builds the SQL for ListProducts from a filter. Every value coming
+// from the filter is bound as an argument; only fixed fragments are
+// concatenated into the query.
+type listQuery struct {
+	where     []string
+	whereArgs []any
+	seek      string
+	seekArgs  []any
+	order     string
+	orderArgs []any
+	backward  bool
+}
+
+// productSort is the ordering a filter resolves to: its explicit sort, or
+// relevance when searching, or "" for catalogue (ID) order.
+func productSort(filter types.ProductFilter) string {
+	if filter.Sort != "" {
+		return filter.Sort
+	}
+	if fullTextTerms(filter.Query) != "" {
+		return types.ProductSortRelevance
+	}
+	return ""
+}
+
+func newListQuery(filter types.ProductFilter) (*listQuery, error) {
+	q := &listQuery{where: []string{"deleted_at IS NULL"}}
+
+	search := fullTextTerms(filter.Query)
+	if search != "" {
+		q.add("MATCH(name, description) AGAINST (? IN BOOLEAN MODE)", search)
+	}
+	if filter.Category != "" {
+		q.add("category_id IN ("+categoryTreeQuery+")", filter.Category)
+	}
+	if filter.MinPrice != nil {
+		q.add("price >= ?", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		q.add("price <= ?", *filter.MaxPrice)
+	}
+	if filter.InStock {
+		q.add("quantity > 0")
+	}
+
+	sort := productSort(filter)
+	if sort == types.ProductSortRelevance {
+		if filter.Cursor != nil {
+			return nil, fmt.Errorf("cursors are not supported when sorting by relevance, use skip instead")
+		}
+		q.order = "MATCH(name, description) AGAINST (? IN BOOLEAN MODE) DESC, id ASC"
+		q.orderArgs = []any{search}
+		return q, nil
+	}
+
+	order, sorted := sortOrders[sort]
+	if filter.Cursor != nil {
+		q.backward = filter.Cursor.Backward
+		if err := q.seekAfter(order, sorted, filter.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// A backward page is read in reverse and flipped back by the caller.
+	idDir := direction(false, q.backward)
+	if sorted {
+		q.order = fmt.Sprintf("%s %s, id %s", order.column, direction(order.desc, q.backward), idDir)
+	} else {
+		q.order = "id " + idDir
+	}
+
+	return q, nil
+}
+
+// seekAfter restricts the query to rows after the cursor in the direction of
+// travel, using the sort column with the ID as tie breaker.
+func (q *listQuery) seekAfter(order sortOrder, sorted bool, cursor *types.Cursor) error {
+	idOp := comparison(false, q.backward)
+	if !sorted {
+		q.seek = "id " + idOp + " ?"
+		q.seekArgs = []any{cursor.ID}
+		return nil
+	}
+
+	var key any = cursor.Key
+	if order.column == "createdAt" {
+		t, err := time.Parse(time.RFC3339Nano, cursor.Key)
+		if err != nil {
+			return fmt.Errorf("invalid cursor")
+		}
+		key = t
+	}
+
+	q.seek = fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[3]s ?))", order.column, comparison(order.desc, q.backward), idOp)
+	q.seekArgs = []any{key, key, cursor.ID}
+	return nil
+}
+
+func direction(desc, backward bool) string {
+	if desc != backward {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func comparison(desc, backward bool) string {
+	if desc != backward {
+		return "<"
+	}
+	return ">"
+}
+
+// cursorKey is the value of the sort column of p that a cursor pointing at p
+// has to carry.
+func cursorKey(p *types.Product, sort string) string {
+	switch sortOrders[sort].column {
+	case "price":
+		return p.Price.String()
+	case "name":
+		return p.Name
+	case "createdAt":
+		return p.CreatedAt
+	}
+	return ""
+}
+
+func (q *listQuery) add(condition string, args ...any) {
+	q.where = append(q.where, condition)
+	q.whereArgs = append(q.whereArgs, args...)
+}
+
+func (q *listQuery) selectSQL(limit, offset int) (string, []any) {
+	where := q.where
+	args := append([]any{}, q.whereArgs...)
+	if q.seek != "" {
+		where = append(where[:len(where):len(where)], q.seek)
+		args = append(args, q.seekArgs...)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM products WHERE %s ORDER BY %s LIMIT ? OFFSET ?", productColumns, strings.Join(where, " AND "), q.order)
+	args = append(append(args, q.orderArgs...), limit, offset)
+	return query, args
+}
+
+func (q *listQuery) countSQL() (string, []any) {
+	return "SELECT COUNT(*) FROM products WHERE " + strings.Join(q.where, " AND "), q.whereArgs
+}
+
+// fullTextTerms turns a free text search into a boolean mode FULLTEXT query
+// requiring every word as a prefix, e.g. "red sho" becomes "+red* +sho*".
+// Operator characters typed by the user are dropped.
+func fullTextTerms(search string) string {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return strings.ContainsRune(" \t\n+-<>()~*\"@", r)
+	})
+
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = "+" + w + "*"
+	}
+
+	return strings.Join(terms, " ")
+}
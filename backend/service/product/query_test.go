@@ -0,0 +1,149 @@
+package product
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/types"
+)
+
+func mustListQuery(t *testing.T, filter types.ProductFilter) *listQuery {
+	t.Helper()
+	q, err := newListQuery(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestListQuery(t *testing.T) {
+	t.Run("should only exclude deleted products by default", func(t *testing.T) {
+		query, args := mustListQuery(t, types.ProductFilter{}).selectSQL(10, 20)
+
+		if !strings.Contains(query, "WHERE deleted_at IS NULL ORDER BY id ASC LIMIT ? OFFSET ?") {
+			t.Errorf("Unexpected query: %s", query)
+		}
+		if fmt.Sprint(args) != "[10 20]" {
+			t.Errorf("Unexpected args: %v", args)
+		}
+	})
+
+	t.Run("should bind every filter value", func(t *testing.T) {
+		minPrice, maxPrice := types.MustParseMoney("5"), types.MustParseMoney("50")
+		q := mustListQuery(t, types.ProductFilter{
+			Query:    "red shoes",
+			Category: "shoes",
+			MinPrice: &minPrice,
+			MaxPrice: &maxPrice,
+			InStock:  true,
+			Sort:     types.ProductSortPriceDesc,
+		})
+
+		query, args := q.selectSQL(10, 0)
+		for _, fragment := range []string{
+			"MATCH(name, description) AGAINST (? IN BOOLEAN MODE)",
+			"category_id IN (WITH RECURSIVE",
+			"price >= ?",
+			"price <= ?",
+			"quantity > 0",
+			"ORDER BY price DESC, id ASC",
+		} {
+			if !strings.Contains(query, fragment) {
+				t.Errorf("Expected query to contain %q: %s", fragment, query)
+			}
+		}
+		if fmt.Sprint(args) != "[+red* +shoes* shoes 5.00 50.00 10 0]" {
+			t.Errorf("Unexpected args: %v", args)
+		}
+
+		countQuery, countArgs := q.countSQL()
+		if strings.Contains(countQuery, "ORDER BY") || len(countArgs) != 4 {
+			t.Errorf("Unexpected count query: %s %v", countQuery, countArgs)
+		}
+	})
+
+	t.Run("should rank by relevance when searching without a sort", func(t *testing.T) {
+		query, args := mustListQuery(t, types.ProductFilter{Query: "watch"}).selectSQL(10, 0)
+
+		if !strings.Contains(query, "ORDER BY MATCH(name, description) AGAINST (? IN BOOLEAN MODE) DESC") {
+			t.Errorf("Unexpected query: %s", query)
+		}
+		if fmt.Sprint(args) != "[+watch* +watch* 10 0]" {
+			t.Errorf("Unexpected args: %v", args)
+		}
+	})
+}
+
+func TestListQueryKeyset(t *testing.T) {
+	t.Run("should seek past the cursor in sort order", func(t *testing.T) {
+		q := mustListQuery(t, types.ProductFilter{
+			Page: types.Page{Cursor: &types.Cursor{Sort: types.ProductSortPriceDesc, Key: "9.99", ID: 7}},
+			Sort: types.ProductSortPriceDesc,
+		})
+
+		query, args := q.selectSQL(5, 0)
+		if !strings.Contains(query, "(price < ? OR (price = ? AND id > ?)) ORDER BY price DESC, id ASC") {
+			t.Errorf("Unexpected query: %s", query)
+		}
+		if fmt.Sprint(args) != "[9.99 9.99 7 5 0]" {
+			t.Errorf("Unexpected args: %v", args)
+		}
+
+		if countQuery, _ := q.countSQL(); strings.Contains(countQuery, "id > ?") {
+			t.Errorf("Expected the count to ignore the cursor: %s", countQuery)
+		}
+	})
+
+	t.Run("should read backward pages in reverse", func(t *testing.T) {
+		q := mustListQuery(t, types.ProductFilter{
+			Page: types.Page{Cursor: &types.Cursor{Sort: types.ProductSortNameAsc, Key: "m", ID: 3, Backward: true}},
+			Sort: types.ProductSortNameAsc,
+		})
+
+		query, _ := q.selectSQL(5, 0)
+		if !strings.Contains(query, "(name < ? OR (name = ? AND id < ?)) ORDER BY name DESC, id DESC") || !q.backward {
+			t.Errorf("Unexpected query: %s", query)
+		}
+	})
+
+	t.Run("should seek by ID in catalogue order", func(t *testing.T) {
+		query, args := mustListQuery(t, types.ProductFilter{Page: types.Page{Cursor: &types.Cursor{ID: 10}}}).selectSQL(5, 0)
+		if !strings.Contains(query, "AND id > ? ORDER BY id ASC") || fmt.Sprint(args) != "[10 5 0]" {
+			t.Errorf("Unexpected query: %s %v", query, args)
+		}
+	})
+
+	t.Run("should parse creation time keys", func(t *testing.T) {
+		_, args := mustListQuery(t, types.ProductFilter{
+			Page: types.Page{Cursor: &types.Cursor{Sort: types.ProductSortNewest, Key: "2025-06-01T10:00:00Z", ID: 1}},
+			Sort: types.ProductSortNewest,
+		}).selectSQL(5, 0)
+		if _, ok := args[0].(time.Time); !ok {
+			t.Errorf("Expected a time argument, got %T", args[0])
+		}
+	})
+
+	t.Run("should refuse cursors for relevance ranking", func(t *testing.T) {
+		_, err := newListQuery(types.ProductFilter{Query: "watch", Page: types.Page{Cursor: &types.Cursor{ID: 1}}})
+		if err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
+func TestFullTextTerms(t *testing.T) {
+	tests := map[string]string{
+		"":                     "",
+		"apple":                "+apple*",
+		"  apple   watch ":     "+apple* +watch*",
+		`-apple +"watch"* (x)`: "+apple* +watch* +x*",
+	}
+
+	for input, want := range tests {
+		if got := fullTextTerms(input); got != want {
+			t.Errorf("fullTextTerms(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -1,109 +1,264 @@
 package product
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"backend/config"
 	"backend/service/auth"
+	"backend/service/currency"
+	"backend/service/inventory"
 	"backend/types"
 	"backend/utils"
 )
 
 type Handler struct {
-	store     types.ProductStore
-	userStore types.UserStore
+	store         types.ProductStore
+	categoryStore types.CategoryStore
+	movementStore types.StockMovementStore
+	userStore     types.UserStore
+	currencies    types.CurrencyService
+	inventory     types.InventoryService
+	transactor    types.Transactor
 }
 
-func NewHandler(store types.ProductStore, userStore types.UserStore) *Handler {
-	return &Handler{store: store, userStore: userStore}
+func NewHandler(
+	store types.ProductStore,
+	categoryStore types.CategoryStore,
+	movementStore types.StockMovementStore,
+	userStore types.UserStore,
+	currencies types.CurrencyService,
+	inventory types.InventoryService,
+	transactor types.Transactor,
+) *Handler {
+	return &Handler{
+		store:         store,
+		categoryStore: categoryStore,
+		movementStore: movementStore,
+		userStore:     userStore,
+		currencies:    currencies,
+		inventory:     inventory,
+		transactor:    transactor,
+	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/products", h.handleGetProducts).Methods(http.MethodGet)
 	router.HandleFunc("/products/{productID}", h.handleGetProduct).Methods(http.MethodGet)
 
-	router.HandleFunc("/products", auth.WithJWTAuth(h.handleCreateProduct, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products", auth.WithJWTAuth(auth.WithRole(h.handleCreateProduct, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products/{productID}", auth.WithJWTAuth(auth.WithRole(h.handleUpdateProduct, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/products/{productID}", auth.WithJWTAuth(auth.WithRole(h.handlePatchProduct, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPatch)
+	router.HandleFunc("/products/{productID}", auth.WithJWTAuth(auth.WithRole(h.handleDeleteProduct, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodDelete)
+
+	router.HandleFunc("/products/{productID}/stock-adjustments", auth.WithJWTAuth(auth.WithRole(h.handleAdjustStock, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/products/{productID}/stock-history", auth.WithJWTAuth(auth.WithRole(h.handleGetStockHistory, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
 }
 
 func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	limitStr := query.Get("limit")
-	skipStr := query.Get("skip")
-	search := query.Get("q")
-
-	limit := 100
-	skip := 0
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
-		}
+	secret := []byte(config.Envs.CursorSecret)
+
+	cur, err := currency.FromRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
 	}
-	if skipStr != "" {
-		if s, err := strconv.Atoi(skipStr); err == nil {
-			skip = s
+
+	filter, err := parseProductFilter(r.URL.Query(), cur, secret)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Prices are filtered and sorted on the catalog price, so bounds in
+	// another currency are converted to it. Products with a price list entry
+	// in that currency may fall slightly outside them.
+	for _, bound := range []*types.Money{filter.MinPrice, filter.MaxPrice} {
+		if bound == nil {
+			continue
+		}
+		if *bound, err = h.currencies.Convert(*bound, types.DefaultCurrency()); err != nil {
+			utils.WriteError(w, currency.ErrorStatus(err), err)
+			return
 		}
 	}
 
-	products, err := h.store.GetProducts()
+	// One extra row tells whether there is another page.
+	fetch := filter
+	fetch.Limit++
+	products, total, err := h.store.ListProducts(fetch)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	if search != "" {
-		filtered := make([]*types.Product, 0)
-		for _, p := range products {
-			if containsIgnoreCase(p.Name, search) || containsIgnoreCase(p.Description, search) {
-				filtered = append(filtered, p)
+	products, hasNext, hasPrev := utils.TrimPage(products, filter.Page)
+
+	var nextCursor, prevCursor *string
+	if sort := productSort(filter); sort != types.ProductSortRelevance {
+		nextCursor, prevCursor, err = utils.PageCursors(secret, products, hasNext, hasPrev, func(p *types.Product) types.Cursor {
+			return types.Cursor{Kind: types.CursorProducts, Sort: sort, Key: cursorKey(p, sort), ID: p.ID}
+		})
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	// Cursors carry catalog prices, so products are only localized once
+	// they have been issued.
+	if err := h.currencies.LocalizePrices(cur, products...); err != nil {
+		utils.WriteError(w, currency.ErrorStatus(err), err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"products":    products,
+		"currency":    cur,
+		"total":       total,
+		"limit":       filter.Limit,
+		"skip":        filter.Offset,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	})
+}
+
+const maxProductsLimit = 100
+
+// parseProductFilter reads a product listing query. Price bounds are in
+// currency.
+func parseProductFilter(query url.Values, currency string, secret []byte) (types.ProductFilter, error) {
+	filter := types.ProductFilter{
+		Page:     types.Page{Limit: maxProductsLimit},
+		Query:    strings.TrimSpace(query.Get("q")),
+		Category: query.Get("category"),
+		Sort:     query.Get("sort"),
+	}
+
+	switch filter.Sort {
+	case "", types.ProductSortRelevance, types.ProductSortPriceAsc, types.ProductSortPriceDesc,
+		types.ProductSortNameAsc, types.ProductSortNameDesc, types.ProductSortNewest:
+	default:
+		return filter, fmt.Errorf("invalid sort %q", filter.Sort)
+	}
+
+	if v := query.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			return filter, fmt.Errorf("invalid limit")
+		}
+		filter.Limit = min(l, maxProductsLimit)
+	}
+
+	// skip is the original name of the offset parameter and is still accepted.
+	for _, name := range []string{"skip", "offset"} {
+		if v := query.Get(name); v != "" {
+			o, err := strconv.Atoi(v)
+			if err != nil || o < 0 {
+				return filter, fmt.Errorf("invalid %s", name)
 			}
+			filter.Offset = o
 		}
-		products = filtered
 	}
 
-	start := skip
-	end := skip + limit
-	if start > len(products) {
-		start = len(products)
+	var err error
+	if filter.MinPrice, err = parsePrice(query, "min_price", currency); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = parsePrice(query, "max_price", currency); err != nil {
+		return filter, err
 	}
-	if end > len(products) {
-		end = len(products)
+
+	if v := query.Get("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid in_stock")
+		}
+		filter.InStock = inStock
 	}
-	paginated := products[start:end]
 
-	utils.WriteJSON(w, http.StatusOK, paginated)
+	// A cursor takes precedence over skip. It is only valid for the ordering
+	// it was issued for, and relevance ranking has no stable keyset.
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := utils.DecodeCursor(secret, types.CursorProducts, v)
+		if err != nil {
+			return filter, err
+		}
+		sort := productSort(filter)
+		if sort == types.ProductSortRelevance {
+			return filter, fmt.Errorf("cursors are not supported when sorting by relevance, use skip instead")
+		}
+		if cursor.Sort != sort {
+			return filter, fmt.Errorf("cursor does not match sort %q", sort)
+		}
+		filter.Cursor = cursor
+		filter.Offset = 0
+	}
+
+	return filter, nil
 }
 
-func containsIgnoreCase(s, substr string) bool {
-	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+func parsePrice(query url.Values, name, currency string) (*types.Money, error) {
+	v := query.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	price, err := types.ParseMoney(v, currency)
+	if err != nil || price.IsNegative() {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+
+	return &price, nil
 }
 
 func (h *Handler) handleGetProduct(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	str, ok := vars["productID"]
-	if !ok {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing product ID"))
+	productID, err := parseProductID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	productID, err := strconv.Atoi(str)
+	cur, err := currency.FromRequest(r)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	product, err := h.store.GetProductById(productID)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err := h.currencies.LocalizePrices(cur, product); err != nil {
+		utils.WriteError(w, currency.ErrorStatus(err), err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, product)
 }
 
+func parseProductID(r *http.Request) (int, error) {
+	str, ok := mux.Vars(r)["productID"]
+	if !ok {
+		return 0, fmt.Errorf("missing product ID")
+	}
+
+	productID, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid product ID")
+	}
+
+	return productID, nil
+}
+
 func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 	var product types.CreateProductPayload
 	if err := utils.ParseJSON(r, &product); err != nil {
@@ -117,11 +272,312 @@ func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.store.CreateProduct(product)
+	if err := h.checkCategory(product.CategoryID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	productID, err := h.store.CreateProduct(tx, product)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The product starts out empty; its opening stock is its first restock.
+	if product.Quantity > 0 {
+		_, err := h.inventory.Adjust(tx, types.StockAdjustment{
+			ProductID: productID,
+			Quantity:  product.Quantity,
+			Reason:    types.StockMovementRestock,
+			ActorID:   auth.GetUserIDFromContext(r.Context()),
+			Note:      "opening stock",
+		})
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetProductById(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseProductID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	product, err := h.store.GetProductById(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var payload types.UpdateProductPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.saveProduct(w, r, product, payload)
+}
+
+// handlePatchProduct applies a JSON merge patch: fields omitted from the body
+// keep their current values.
+func (h *Handler) handlePatchProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseProductID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	product, err := h.store.GetProductById(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	payload := types.UpdateProductPayload{
+		Name:             product.Name,
+		Description:      product.Description,
+		Image:            product.Image,
+		Price:            product.Price,
+		CategoryID:       product.CategoryID,
+		Weight:           product.Weight,
+		Length:           product.Length,
+		Width:            product.Width,
+		Height:           product.Height,
+		ReorderThreshold: product.ReorderThreshold,
+	}
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.saveProduct(w, r, product, payload)
+}
+
+// saveProduct applies payload to product. Stock is not part of a product
+// edit; it only changes through stock adjustments, which the ledger records.
+func (h *Handler) saveProduct(w http.ResponseWriter, r *http.Request, product *types.Product, payload types.UpdateProductPayload) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	if err := h.checkCategory(payload.CategoryID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	product.Name = payload.Name
+	product.Description = payload.Description
+	product.Image = payload.Image
+	product.Price = payload.Price
+	product.CategoryID = payload.CategoryID
+	product.Weight = payload.Weight
+	product.Length = payload.Length
+	product.Width = payload.Width
+	product.Height = payload.Height
+	product.ReorderThreshold = payload.ReorderThreshold
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := h.store.UpdateProduct(tx, *product); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+// checkCategory rejects a category that does not exist up front, rather
+// than leaving it to fail on the foreign key.
+func (h *Handler) checkCategory(categoryID int) error {
+	if categoryID == 0 {
+		return nil
+	}
+
+	if _, err := h.categoryStore.GetCategoryByID(categoryID); err != nil {
+		return fmt.Errorf("category not found")
+	}
+
+	return nil
+}
+
+func (h *Handler) handleAdjustStock(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseProductID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.store.GetProductById(productID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var payload types.StockAdjustmentPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors))
+		return
+	}
+
+	switch {
+	case (payload.Reason == types.StockMovementRestock || payload.Reason == types.StockMovementReturn) && payload.Quantity < 0:
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("a %s must add stock", payload.Reason))
+		return
+	case payload.Reason == types.StockMovementDamage && payload.Quantity > 0:
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("damage must take stock away"))
+		return
+	}
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	movement, err := h.inventory.Adjust(tx, types.StockAdjustment{
+		ProductID:  productID,
+		LocationID: payload.LocationID,
+		Quantity:   payload.Quantity,
+		Reason:     payload.Reason,
+		OrderID:    payload.OrderID,
+		ActorID:    auth.GetUserIDFromContext(r.Context()),
+		Note:       payload.Note,
+	})
+	if errors.Is(err, inventory.ErrLocationNotFound) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if errors.Is(err, inventory.ErrInsufficientStock) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, movement)
+}
+
+// handleGetStockHistory pages through a product's ledger, newest first,
+// alongside how its quantity reconciles with it.
+func (h *Handler) handleGetStockHistory(w http.ResponseWriter, r *http.Request) {
+	secret := []byte(config.Envs.CursorSecret)
+
+	productID, err := parseProductID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	reconciliations, err := h.movementStore.ReconcileStock(productID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if len(reconciliations) == 0 {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
+
+	query := r.URL.Query()
+	filter := types.StockMovementFilter{Page: types.Page{Limit: 50}, ProductID: productID}
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 200 {
+		filter.Limit = l
+	}
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := utils.DecodeCursor(secret, types.CursorStockMovements, v)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.Cursor = cursor
+	}
 
-	utils.WriteJSON(w, http.StatusCreated, product)
-}
\ No newline at end of file
+	// One extra row tells whether there is another page.
+	fetch := filter
+	fetch.Limit++
+	movements, err := h.movementStore.GetStockMovements(fetch)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	movements, hasNext, hasPrev := utils.TrimPage(movements, filter.Page)
+
+	nextCursor, prevCursor, err := utils.PageCursors(secret, movements, hasNext, hasPrev, func(m types.StockMovement) types.Cursor {
+		return types.Cursor{Kind: types.CursorStockMovements, ID: m.ID}
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"stock":       reconciliations[0],
+		"movements":   movements,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	})
+}
+
+func (h *Handler) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := parseProductID(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.DeleteProduct(productID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,414 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"backend/config"
+	"backend/service/auth"
+	"backend/service/currency"
+	"backend/service/inventory"
+	"backend/types"
+	"backend/utils"
+	"github.com/gorilla/mux"
+)
+
+func TestProductServiceHandlers(t *testing.T) {
+	newStore := func() *mockProductStore {
+		return &mockProductStore{products: map[int]*types.Product{
+			1: {ID: 1, Name: "Widget", Description: "A widget", Price: types.MustParseMoney("10"), Quantity: 4},
+		}}
+	}
+
+	serve := func(handler *Handler, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 9))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/products/{productID}/stock-adjustments", handler.handleAdjustStock).Methods(http.MethodPost)
+		router.HandleFunc("/products/{productID}/stock-history", handler.handleGetStockHistory).Methods(http.MethodGet)
+		router.HandleFunc("/products", handler.handleCreateProduct).Methods(http.MethodPost)
+		router.HandleFunc("/products/{productID}", handler.handleGetProduct).Methods(http.MethodGet)
+		router.HandleFunc("/products/{productID}", handler.handleUpdateProduct).Methods(http.MethodPut)
+		router.HandleFunc("/products/{productID}", handler.handlePatchProduct).Methods(http.MethodPatch)
+		router.HandleFunc("/products/{productID}", handler.handleDeleteProduct).Methods(http.MethodDelete)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should return the created product with its ID", func(t *testing.T) {
+		stock := &mockInventory{}
+		payload := map[string]any{"name": "Gadget", "price": 7, "quantity": 3}
+		rr := serve(NewHandler(newStore(), nil, nil, nil, nil, stock, mockTransactor{}), http.MethodPost, "/products", payload)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var p types.Product
+		json.NewDecoder(rr.Body).Decode(&p)
+		if p.ID != 2 || p.Name != "Gadget" {
+			t.Errorf("Expected product 2 named Gadget, got %+v", p)
+		}
+		if a := stock.adjustments; len(a) != 1 || a[0].ProductID != 2 || a[0].Quantity != 3 {
+			t.Errorf("Expected opening stock of 3 for product 2, got %+v", a)
+		}
+	})
+
+	t.Run("should patch only the fields that are sent", func(t *testing.T) {
+		store := newStore()
+		stock := &mockInventory{}
+		rr := serve(NewHandler(store, nil, nil, nil, currency.NewService(nil), stock, mockTransactor{}), http.MethodPatch, "/products/1", map[string]any{"price": 12.5})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		p := store.products[1]
+		if p.Price != types.MustParseMoney("12.5") || p.Name != "Widget" || p.Quantity != 4 {
+			t.Errorf("Expected only the price to change, got %+v", p)
+		}
+		if len(stock.adjustments) != 0 {
+			t.Errorf("Expected no stock adjustments, got %+v", stock.adjustments)
+		}
+	})
+
+	t.Run("should leave stock to adjustments on a full update", func(t *testing.T) {
+		store := newStore()
+		stock := &mockInventory{}
+		payload := map[string]any{"name": "Gizmo", "price": 11}
+		rr := serve(NewHandler(store, nil, nil, nil, currency.NewService(nil), stock, mockTransactor{}), http.MethodPut, "/products/1", payload)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if p := store.products[1]; p.Name != "Gizmo" || p.Quantity != 4 {
+			t.Errorf("Expected the product renamed with its stock untouched, got %+v", p)
+		}
+		if len(stock.adjustments) != 0 {
+			t.Errorf("Expected no stock adjustments, got %+v", stock.adjustments)
+		}
+	})
+
+	t.Run("should record stock adjustments", func(t *testing.T) {
+		stock := &mockInventory{}
+		payload := types.StockAdjustmentPayload{LocationID: 2, Quantity: -2, Reason: types.StockMovementDamage, Note: "dropped"}
+		rr := serve(NewHandler(newStore(), nil, nil, nil, nil, stock, mockTransactor{}), http.MethodPost, "/products/1/stock-adjustments", payload)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		a := stock.adjustments
+		if len(a) != 1 || a[0].ProductID != 1 || a[0].LocationID != 2 || a[0].Quantity != -2 || a[0].ActorID != 9 {
+			t.Errorf("Expected damage of 2 at location 2 by actor 9, got %+v", a)
+		}
+	})
+
+	for _, payload := range []types.StockAdjustmentPayload{
+		{Quantity: -2, Reason: types.StockMovementRestock},
+		{Quantity: 2, Reason: types.StockMovementDamage},
+		{Quantity: 0, Reason: types.StockMovementAdjustment},
+		{Quantity: 2, Reason: types.StockMovementSale},
+	} {
+		t.Run("should reject a "+payload.Reason+" of "+fmt.Sprint(payload.Quantity), func(t *testing.T) {
+			rr := serve(NewHandler(newStore(), nil, nil, nil, nil, &mockInventory{}, mockTransactor{}), http.MethodPost, "/products/1/stock-adjustments", payload)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should refuse to take away stock that is not there", func(t *testing.T) {
+		stock := &mockInventory{err: inventory.ErrInsufficientStock}
+		payload := types.StockAdjustmentPayload{Quantity: -9, Reason: types.StockMovementAdjustment}
+		rr := serve(NewHandler(newStore(), nil, nil, nil, nil, stock, mockTransactor{}), http.MethodPost, "/products/1/stock-adjustments", payload)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should page through stock history with its own cursors only", func(t *testing.T) {
+		movements := &mockMovementStore{}
+		for id := 1; id <= 3; id++ {
+			movements.movements = append(movements.movements, types.StockMovement{ID: id, ProductID: 1, Quantity: 1, Reason: types.StockMovementRestock})
+		}
+		handler := NewHandler(newStore(), nil, movements, nil, nil, nil, nil)
+
+		rr := serve(handler, http.MethodGet, "/products/1/stock-history?limit=2", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var page struct {
+			NextCursor *string `json:"next_cursor"`
+		}
+		json.NewDecoder(rr.Body).Decode(&page)
+		if page.NextCursor == nil {
+			t.Fatal("Expected a cursor to the next page")
+		}
+
+		rr = serve(handler, http.MethodGet, "/products/1/stock-history?cursor="+url.QueryEscape(*page.NextCursor), nil)
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		products, _ := utils.EncodeCursor([]byte(config.Envs.CursorSecret), types.Cursor{Kind: types.CursorProducts, ID: 3})
+		rr = serve(handler, http.MethodGet, "/products/1/stock-history?cursor="+url.QueryEscape(products), nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for a product cursor, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should price a product in the requested currency", func(t *testing.T) {
+		currencies := currency.NewService(&mockCurrencyStore{rates: map[string]float64{"EUR": 0.9}})
+		handler := NewHandler(newStore(), nil, nil, nil, currencies, nil, nil)
+
+		rr := serve(handler, http.MethodGet, "/products/1?currency=eur", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var p types.Product
+		if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Price != types.MustParseMoney("9") || p.Currency != "EUR" {
+			t.Errorf("Expected 9.00 EUR, got %s %s", p.Price, p.Currency)
+		}
+
+		rr = serve(handler, http.MethodGet, "/products/1?currency=gbp", nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d without a GBP rate, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject an invalid patch", func(t *testing.T) {
+		store := newStore()
+		rr := serve(NewHandler(store, nil, nil, nil, currency.NewService(nil), nil, nil), http.MethodPatch, "/products/1", map[string]any{"weight": -1})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject an unknown category", func(t *testing.T) {
+		categories := &mockCategoryStore{categories: []types.Category{{ID: 2, Name: "Tools"}}}
+		handler := NewHandler(newStore(), categories, nil, nil, currency.NewService(nil), nil, mockTransactor{})
+
+		rr := serve(handler, http.MethodPatch, "/products/1", map[string]any{"category_id": 3})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		rr = serve(handler, http.MethodPatch, "/products/1", map[string]any{"category_id": 2})
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should require all fields on update", func(t *testing.T) {
+		store := newStore()
+		rr := serve(NewHandler(store, nil, nil, nil, currency.NewService(nil), nil, nil), http.MethodPut, "/products/1", map[string]any{"quantity": 2})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should hide a product once it is deleted", func(t *testing.T) {
+		store := newStore()
+		handler := NewHandler(store, nil, nil, nil, currency.NewService(nil), nil, nil)
+
+		rr := serve(handler, http.MethodDelete, "/products/1", nil)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		rr = serve(handler, http.MethodGet, "/products/1", nil)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+
+		rr = serve(handler, http.MethodDelete, "/products/1", nil)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestParseProductFilter(t *testing.T) {
+	t.Run("should parse every supported parameter", func(t *testing.T) {
+		query, _ := url.ParseQuery("q=watch&category=shoes&min_price=10&max_price=99.5&in_stock=true&sort=price_asc&limit=500&skip=40")
+		filter, err := parseProductFilter(query, types.DefaultCurrency(), []byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if filter.Query != "watch" || filter.Category != "shoes" || *filter.MinPrice != types.MustParseMoney("10") || *filter.MaxPrice != types.MustParseMoney("99.5") ||
+			!filter.InStock || filter.Sort != types.ProductSortPriceAsc || filter.Limit != maxProductsLimit || filter.Offset != 40 {
+			t.Errorf("Unexpected filter: %+v", filter)
+		}
+	})
+
+	t.Run("should accept a cursor only for the sort it was issued for", func(t *testing.T) {
+		secret := []byte("secret")
+		token, _ := utils.EncodeCursor(secret, types.Cursor{Kind: types.CursorProducts, Sort: types.ProductSortPriceAsc, Key: "5", ID: 3})
+
+		filter, err := parseProductFilter(url.Values{"sort": {"price_asc"}, "cursor": {token}, "skip": {"20"}}, types.DefaultCurrency(), secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filter.Cursor == nil || filter.Cursor.ID != 3 || filter.Offset != 0 {
+			t.Errorf("Expected the cursor to replace skip, got %+v", filter)
+		}
+
+		if _, err := parseProductFilter(url.Values{"sort": {"name_asc"}, "cursor": {token}}, types.DefaultCurrency(), secret); err == nil {
+			t.Error("Expected a cursor for another sort to be rejected")
+		}
+		if _, err := parseProductFilter(url.Values{"sort": {"price_asc"}, "cursor": {token}}, types.DefaultCurrency(), []byte("other")); err == nil {
+			t.Error("Expected a cursor with a bad signature to be rejected")
+		}
+
+		orders, _ := utils.EncodeCursor(secret, types.Cursor{Kind: types.CursorOrders, Key: "2025-06-01T10:00:00Z", ID: 3})
+		if _, err := parseProductFilter(url.Values{"cursor": {orders}}, types.DefaultCurrency(), secret); err == nil {
+			t.Error("Expected a cursor issued for another listing to be rejected")
+		}
+	})
+
+	for _, raw := range []string{"sort=popular", "limit=0", "skip=-1", "min_price=abc", "min_price=-1", "max_price=9.999", "in_stock=maybe"} {
+		t.Run("should reject "+raw, func(t *testing.T) {
+			query, _ := url.ParseQuery(raw)
+			if _, err := parseProductFilter(query, types.DefaultCurrency(), []byte("secret")); err == nil {
+				t.Errorf("Expected an error for %q", raw)
+			}
+		})
+	}
+}
+
+type mockProductStore struct {
+	products map[int]*types.Product
+}
+
+func (m *mockProductStore) GetProductById(id int) (*types.Product, error) {
+	p, ok := m.products[id]
+	if !ok {
+		return nil, fmt.Errorf("product not found")
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (m *mockProductStore) GetProductsById(ids []int) ([]types.Product, error) {
+	return nil, nil
+}
+
+func (m *mockProductStore) ListProducts(filter types.ProductFilter) ([]*types.Product, int, error) {
+	return nil, 0, nil
+}
+
+func (m *mockProductStore) CreateProduct(tx types.Tx, product types.CreateProductPayload) (int, error) {
+	id := len(m.products) + 1
+	m.products[id] = &types.Product{ID: id, Name: product.Name, Description: product.Description, Price: product.Price}
+	return id, nil
+}
+
+func (m *mockProductStore) UpdateProduct(tx types.Tx, p types.Product) error {
+	m.products[p.ID] = &p
+	return nil
+}
+
+func (m *mockProductStore) DeleteProduct(productID int) error {
+	if _, ok := m.products[productID]; !ok {
+		return fmt.Errorf("product not found")
+	}
+	delete(m.products, productID)
+	return nil
+}
+
+func (m *mockProductStore) GetProductsByCategoryIDs(categoryIDs []int) ([]*types.Product, error) {
+	return nil, nil
+}
+
+type mockInventory struct {
+	types.InventoryService
+	adjustments []types.StockAdjustment
+	err         error
+}
+
+func (m *mockInventory) Adjust(tx types.Tx, a types.StockAdjustment) (*types.StockMovement, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.adjustments = append(m.adjustments, a)
+	return &types.StockMovement{ID: len(m.adjustments), ProductID: a.ProductID, Quantity: a.Quantity, Reason: a.Reason}, nil
+}
+
+type mockTx struct{}
+
+func (mockTx) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (mockTx) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (mockTx) QueryRow(query string, args ...any) *sql.Row        { return nil }
+func (mockTx) Commit() error                                      { return nil }
+func (mockTx) Rollback() error                                    { return nil }
+
+type mockTransactor struct{}
+
+func (mockTransactor) BeginTx() (types.Tx, error) {
+	return mockTx{}, nil
+}
+
+type mockMovementStore struct {
+	types.StockMovementStore
+	movements []types.StockMovement
+}
+
+func (m *mockMovementStore) ReconcileStock(productIDs ...int) ([]types.StockReconciliation, error) {
+	return []types.StockReconciliation{{ProductID: productIDs[0], Reconciled: true}}, nil
+}
+
+func (m *mockMovementStore) GetStockMovements(filter types.StockMovementFilter) ([]types.StockMovement, error) {
+	movements := []types.StockMovement{}
+	for i := len(m.movements) - 1; i >= 0 && len(movements) < filter.Limit; i-- {
+		if filter.Cursor == nil || m.movements[i].ID < filter.Cursor.ID {
+			movements = append(movements, m.movements[i])
+		}
+	}
+	return movements, nil
+}
+
+type mockCategoryStore struct {
+	types.CategoryStore
+	categories []types.Category
+}
+
+func (m *mockCategoryStore) GetCategoryByID(id int) (*types.Category, error) {
+	for _, c := range m.categories {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("category not found")
+}
+
+type mockCurrencyStore struct {
+	types.CurrencyStore
+	rates map[string]float64
+}
+
+func (m *mockCurrencyStore) GetExchangeRate(code string) (*types.ExchangeRate, error) {
+	rate, ok := m.rates[code]
+	if !ok {
+		return nil, currency.ErrRateNotFound
+	}
+	return &types.ExchangeRate{Currency: code, Rate: rate}, nil
+}
+
+func (m *mockCurrencyStore) GetPricesInCurrency(currency string, productIDs []int) (map[int]types.Money, error) {
+	return map[int]types.Money{}, nil
+}
@@ -3,10 +3,13 @@ package product
 import (
 	"database/sql"
 	"fmt"
-	"strings"
+	"slices"
 	"backend/types"
+	"backend/utils"
 )
 
+const productColumns = "id, name, description, image, price, quantity, createdAt, category_id, weight, length, width, height, reorder_threshold"
+
 type Store struct {
 	db *sql.DB
 }
@@ -17,27 +20,47 @@ func NewStore(db *sql.DB) *Store {
 	}
 }
 
-func (s *Store) GetProducts() ([]*types.Product, error) {
-	rows, err := s.db.Query("SELECT * FROM products")
+// ListProducts returns one page of products matching filter together with the
+// total number of matches.
+func (s *Store) ListProducts(filter types.ProductFilter) ([]*types.Product, int, error) {
+	q, err := newListQuery(filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	countQuery, countArgs := q.countSQL()
+	var total int
+	if err := s.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, err
 	}
 
+	query, args := q.selectSQL(filter.Limit, filter.Offset)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
 	products := make([]*types.Product, 0)
 	for rows.Next() {
 		p, err := scanRowsIntoProduct(rows)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		products = append(products, p)
 	}
 
-	return products, nil
+	if q.backward {
+		slices.Reverse(products)
+	}
+
+	return products, total, rows.Err()
 }
 
 func scanRowsIntoProduct(rows *sql.Rows) (*types.Product, error) {
 	product := new(types.Product)
+	var categoryID sql.NullInt64
 
 	err := rows.Scan(
 		&product.ID,
@@ -47,16 +70,65 @@ func scanRowsIntoProduct(rows *sql.Rows) (*types.Product, error) {
 		&product.Price,
 		&product.Quantity,
 		&product.CreatedAt,
+		&categoryID,
+		&product.Weight,
+		&product.Length,
+		&product.Width,
+		&product.Height,
+		&product.ReorderThreshold,
 	)
 	if err != nil {
 		return nil, err
 	}
+	product.CategoryID = int(categoryID.Int64)
+	product.Currency = product.Price.Currency
 
 	return product, nil
 }
 
-func (s *Store) CreateProduct(product types.CreateProductPayload) error {
-	_, err := s.db.Exec("INSERT INTO products (name, price, image, description, quantity) VALUES (?, ?, ?, ?, ?)", product.Name, product.Price, product.Image, product.Description, product.Quantity)
+func (s *Store) GetProductsByCategoryIDs(categoryIDs []int) ([]*types.Product, error) {
+	if len(categoryIDs) == 0 {
+		return []*types.Product{}, nil
+	}
+
+	in, args := utils.InClause(categoryIDs)
+	query := fmt.Sprintf("SELECT %s FROM products WHERE category_id IN %s AND deleted_at IS NULL ORDER BY id", productColumns, in)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make([]*types.Product, 0)
+	for rows.Next() {
+		p, err := scanRowsIntoProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		products = append(products, p)
+	}
+
+	return products, rows.Err()
+}
+
+func (s *Store) CreateProduct(tx types.Tx, product types.CreateProductPayload) (int, error) {
+	res, err := tx.Exec("INSERT INTO products (name, price, image, description, quantity, category_id, weight, length, width, height, reorder_threshold) VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?)", product.Name, product.Price, product.Image, product.Description, utils.NullableID(product.CategoryID), product.Weight, product.Length, product.Width, product.Height, product.ReorderThreshold)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) UpdateProduct(tx types.Tx, product types.Product) error {
+	_, err := tx.Exec("UPDATE products SET name = ?, price = ?, image = ?, description = ?, category_id = ?, weight = ?, length = ?, width = ?, height = ?, reorder_threshold = ? WHERE id = ? AND deleted_at IS NULL", product.Name, product.Price, product.Image, product.Description, utils.NullableID(product.CategoryID), product.Weight, product.Length, product.Width, product.Height, product.ReorderThreshold, product.ID)
 	if err != nil {
 		return err
 	}
@@ -64,17 +136,27 @@ func (s *Store) CreateProduct(product types.CreateProductPayload) error {
 	return nil
 }
 
-func (s *Store) UpdateProduct(product types.Product) error {
-	_, err := s.db.Exec("UPDATE products SET name = ?, price = ?, image = ?, description = ?, quantity = ? WHERE id = ?", product.Name, product.Price, product.Image, product.Description, product.Quantity, product.ID)
+// DeleteProduct soft deletes a product so that order items referencing it
+// stay valid while it disappears from the catalog.
+func (s *Store) DeleteProduct(productID int) error {
+	res, err := s.db.Exec("UPDATE products SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", productID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return fmt.Errorf("product not found")
+	}
 
 	return nil
 }
 
 func (s *Store) GetProductById(productID int) (*types.Product, error) {
-	rows, err := s.db.Query("SELECT * FROM products WHERE id = ?", productID)
+	rows, err := s.db.Query("SELECT "+productColumns+" FROM products WHERE id = ? AND deleted_at IS NULL", productID)
 	if err != nil {
 		return nil, err
 	}
@@ -87,18 +169,21 @@ func (s *Store) GetProductById(productID int) (*types.Product, error) {
 		}
 	}
 
+	if p.ID == 0 {
+		return nil, fmt.Errorf("product not found")
+	}
+
 	return p, nil
 }
 
 func (s *Store) GetProductsById(productIDs []int) ([]types.Product, error) {
-	placeholders := strings.Repeat(",?", len(productIDs)-1)
-	query := fmt.Sprintf("SELECT * FROM products WHERE id IN (?%s)", placeholders)
-
-	args := make([]interface{}, len(productIDs))
-	for i, v := range productIDs {
-		args[i] = v
+	if len(productIDs) == 0 {
+		return []types.Product{}, nil
 	}
 
+	in, args := utils.InClause(productIDs)
+	query := fmt.Sprintf("SELECT %s FROM products WHERE id IN %s AND deleted_at IS NULL", productColumns, in)
+
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,28 @@
+package product
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetProductsById(t *testing.T) {
+	t.Run("should not query for no products", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		products, err := NewStore(db).GetProductsById(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(products) != 0 {
+			t.Errorf("Expected no products, got %d", len(products))
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
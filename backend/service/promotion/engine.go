@@ -0,0 +1,91 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"backend/types"
+)
+
+// ErrInvalidCoupon is wrapped by every error explaining why a coupon cannot
+// be used.
+var ErrInvalidCoupon = errors.New("invalid coupon")
+
+// check returns why p cannot be used at now on a cart worth subtotal by a
+// user who has used it userUses times, or nil if it can.
+func check(p *types.Promotion, subtotal types.Money, userUses int, now time.Time) error {
+	switch {
+	case !p.Active:
+		return fmt.Errorf("%w: %s is no longer available", ErrInvalidCoupon, p.Code)
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return fmt.Errorf("%w: %s is not valid until %s", ErrInvalidCoupon, p.Code, p.StartsAt.Format(time.DateOnly))
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return fmt.Errorf("%w: %s expired on %s", ErrInvalidCoupon, p.Code, p.EndsAt.Format(time.DateOnly))
+	case p.MaxUses > 0 && p.UsedCount >= p.MaxUses:
+		return fmt.Errorf("%w: %s has been fully redeemed", ErrInvalidCoupon, p.Code)
+	case p.MaxUsesPerUser > 0 && userUses >= p.MaxUsesPerUser:
+		return fmt.Errorf("%w: you have already used %s", ErrInvalidCoupon, p.Code)
+	case subtotal.Cmp(p.MinSpend) < 0:
+		return fmt.Errorf("%w: %s requires a minimum spend of %s", ErrInvalidCoupon, p.Code, p.MinSpend)
+	}
+	return nil
+}
+
+// discount returns the amount p takes off lines, of which only those inScope
+// are eligible. The discount never exceeds what the eligible lines cost.
+func discount(p *types.Promotion, lines []types.PriceLine, inScope func(types.PriceLine) bool) (types.Money, error) {
+	var eligible types.Money
+	var scoped []types.PriceLine
+	units := 0
+	for _, l := range lines {
+		if !inScope(l) {
+			continue
+		}
+		eligible = eligible.Add(l.UnitPrice.Mul(l.Quantity))
+		scoped = append(scoped, l)
+		units += l.Quantity
+	}
+
+	if units == 0 {
+		return types.Money{}, fmt.Errorf("%w: %s does not apply to any item in the cart", ErrInvalidCoupon, p.Code)
+	}
+
+	var amount types.Money
+	switch p.Type {
+	case types.PromotionPercentage:
+		amount = eligible.Percent(p.Value)
+	case types.PromotionFixed:
+		amount = p.Amount
+	case types.PromotionBuyXGetY:
+		group := p.BuyQuantity + p.GetQuantity
+		if units < group {
+			return types.Money{}, fmt.Errorf("%w: %s needs %d eligible items in the cart", ErrInvalidCoupon, p.Code, group)
+		}
+
+		// The cheapest items are the discounted ones, each rounded on its
+		// own as it would be on a receipt.
+		sort.SliceStable(scoped, func(i, j int) bool { return scoped[i].UnitPrice.Cmp(scoped[j].UnitPrice) < 0 })
+		free := units / group * p.GetQuantity
+		for _, l := range scoped {
+			n := min(free, l.Quantity)
+			amount = amount.Add(l.UnitPrice.Percent(p.Value).Mul(n))
+			if free -= n; free == 0 {
+				break
+			}
+		}
+	}
+
+	return amount.Min(eligible), nil
+}
+
+// subtotal returns what lines cost before any discount.
+func subtotal(lines []types.PriceLine) types.Money {
+	// The zero total takes the currency of the lines.
+	var total types.Money
+	for _, l := range lines {
+		total = total.Add(l.UnitPrice.Mul(l.Quantity))
+	}
+	return total
+}
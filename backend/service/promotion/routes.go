@@ -0,0 +1,144 @@
+package promotion
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backend/service/auth"
+	"backend/types"
+	"backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store     types.PromotionStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.PromotionStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/promotions", auth.WithJWTAuth(auth.WithRole(h.handleGetPromotions, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/promotions", auth.WithJWTAuth(auth.WithRole(h.handleCreatePromotion, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/promotions/{promotionID}", auth.WithJWTAuth(auth.WithRole(h.handleUpdatePromotion, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPut)
+}
+
+func (h *Handler) handleGetPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := h.store.GetPromotions()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, promotions)
+}
+
+func (h *Handler) handleCreatePromotion(w http.ResponseWriter, r *http.Request) {
+	var payload types.PromotionPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	promotion, status, err := h.promotionFromPayload(&types.Promotion{Active: true}, payload)
+	if err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	promotion.ID, err = h.store.CreatePromotion(*promotion)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, promotion)
+}
+
+func (h *Handler) handleUpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := strconv.Atoi(mux.Vars(r)["promotionID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid promotion ID"))
+		return
+	}
+
+	existing, err := h.store.GetPromotionByID(promotionID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var payload types.PromotionPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	promotion, status, err := h.promotionFromPayload(existing, payload)
+	if err != nil {
+		utils.WriteError(w, status, err)
+		return
+	}
+
+	if err := h.store.UpdatePromotion(*promotion); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, promotion)
+}
+
+// promotionFromPayload validates payload and applies it to p, a new
+// promotion or the one being updated. It returns the HTTP status to use if
+// the payload is rejected.
+func (h *Handler) promotionFromPayload(p *types.Promotion, payload types.PromotionPayload) (*types.Promotion, int, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", errors)
+	}
+
+	if payload.Type == types.PromotionFixed && payload.Amount.IsZero() {
+		return nil, http.StatusBadRequest, fmt.Errorf("fixed promotions need an amount")
+	}
+	if payload.Type != types.PromotionFixed && payload.Value <= 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("%s promotions need a value", payload.Type)
+	}
+	if payload.Type == types.PromotionBuyXGetY && (payload.BuyQuantity < 1 || payload.GetQuantity < 1) {
+		return nil, http.StatusBadRequest, fmt.Errorf("buy_x_get_y promotions need a buy_quantity and a get_quantity")
+	}
+	if payload.ProductID != nil && payload.CategoryID != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("a promotion is limited to a product or a category, not both")
+	}
+	if payload.StartsAt != nil && payload.EndsAt != nil && !payload.EndsAt.After(*payload.StartsAt) {
+		return nil, http.StatusBadRequest, fmt.Errorf("ends_at must be after starts_at")
+	}
+
+	code := normaliseCode(payload.Code)
+	if existing, err := h.store.GetPromotionByCode(code); err == nil && existing.ID != p.ID {
+		return nil, http.StatusConflict, fmt.Errorf("promotion with code %q already exists", code)
+	}
+
+	p.Code = code
+	p.Description = payload.Description
+	p.Type = payload.Type
+	p.Value = payload.Value
+	p.Amount = payload.Amount
+	p.MinSpend = payload.MinSpend
+	p.BuyQuantity = payload.BuyQuantity
+	p.GetQuantity = payload.GetQuantity
+	p.ProductID = payload.ProductID
+	p.CategoryID = payload.CategoryID
+	p.MaxUses = payload.MaxUses
+	p.MaxUsesPerUser = payload.MaxUsesPerUser
+	p.StartsAt = payload.StartsAt
+	p.EndsAt = payload.EndsAt
+	if payload.Active != nil {
+		p.Active = *payload.Active
+	}
+
+	return p, http.StatusOK, nil
+}
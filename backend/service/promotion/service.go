@@ -0,0 +1,167 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/service/category"
+	"backend/types"
+)
+
+// Service prices carts with coupon codes. It implements
+// types.PromotionService.
+type Service struct {
+	store         types.PromotionStore
+	categoryStore types.CategoryStore
+	currencies    types.CurrencyService
+}
+
+func NewService(store types.PromotionStore, categoryStore types.CategoryStore, currencies types.CurrencyService) *Service {
+	return &Service{store: store, categoryStore: categoryStore, currencies: currencies}
+}
+
+// normaliseCode makes codes case insensitive; they are stored upper case.
+func normaliseCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (s *Service) Price(userID int, code string, lines []types.PriceLine) (*types.PriceBreakdown, error) {
+	if code == "" {
+		return s.apply(nil, 0, lines)
+	}
+
+	p, err := s.store.GetPromotionByCode(normaliseCode(code))
+	if err != nil {
+		return nil, lookupError(code, err)
+	}
+
+	uses := 0
+	if p.MaxUsesPerUser > 0 {
+		if uses, err = s.store.CountRedemptions(p.ID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.apply(p, uses, lines)
+}
+
+func (s *Service) PriceForUpdate(tx types.Tx, userID int, code string, lines []types.PriceLine) (*types.PriceBreakdown, error) {
+	if code == "" {
+		return s.apply(nil, 0, lines)
+	}
+
+	p, err := s.store.GetPromotionByCodeForUpdate(tx, normaliseCode(code))
+	if err != nil {
+		return nil, lookupError(code, err)
+	}
+
+	uses := 0
+	if p.MaxUsesPerUser > 0 {
+		if uses, err = s.store.CountRedemptionsForUpdate(tx, p.ID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.apply(p, uses, lines)
+}
+
+func (s *Service) Redeem(tx types.Tx, userID, orderID int, breakdown types.PriceBreakdown) error {
+	for _, d := range breakdown.Discounts {
+		if err := s.store.CreateRedemption(tx, d.PromotionID, userID, orderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lookupError(code string, err error) error {
+	if errors.Is(err, ErrPromotionNotFound) {
+		return fmt.Errorf("%w: %s does not exist", ErrInvalidCoupon, code)
+	}
+	return err
+}
+
+// apply prices lines with p, which is nil when no coupon is used, for a
+// user who has used p uses times.
+func (s *Service) apply(p *types.Promotion, uses int, lines []types.PriceLine) (*types.PriceBreakdown, error) {
+	b := &types.PriceBreakdown{Subtotal: subtotal(lines), Discounts: []types.AppliedDiscount{}}
+	b.DiscountTotal = types.NewMoney(0, b.Subtotal.Currency)
+	b.Total = b.Subtotal
+
+	if p == nil {
+		return b, nil
+	}
+
+	p, err := s.localize(p, b.Subtotal.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := check(p, b.Subtotal, uses, time.Now()); err != nil {
+		return nil, err
+	}
+
+	inScope, err := s.scope(p)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := discount(p, lines, inScope)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Discounts = append(b.Discounts, types.AppliedDiscount{
+		PromotionID: p.ID,
+		Code:        p.Code,
+		Description: p.Description,
+		Amount:      amount,
+	})
+	b.DiscountTotal = amount
+	b.Total = b.Subtotal.Sub(amount)
+
+	return b, nil
+}
+
+// localize returns a copy of p with its amounts, which are in the default
+// currency, converted into currency.
+func (s *Service) localize(p *types.Promotion, currency string) (*types.Promotion, error) {
+	if currency == "" || currency == types.DefaultCurrency() {
+		return p, nil
+	}
+
+	localized := *p
+	var err error
+	if localized.Amount, err = s.currencies.Convert(p.Amount, currency); err != nil {
+		return nil, err
+	}
+	if localized.MinSpend, err = s.currencies.Convert(p.MinSpend, currency); err != nil {
+		return nil, err
+	}
+	return &localized, nil
+}
+
+// scope returns which lines p applies to. A category scope includes its
+// subcategories.
+func (s *Service) scope(p *types.Promotion) (func(types.PriceLine) bool, error) {
+	switch {
+	case p.ProductID != nil:
+		return func(l types.PriceLine) bool { return l.ProductID == *p.ProductID }, nil
+
+	case p.CategoryID != nil:
+		categories, err := s.categoryStore.GetCategories()
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make(map[int]bool)
+		for _, id := range category.DescendantIDs(categories, *p.CategoryID) {
+			ids[id] = true
+		}
+		return func(l types.PriceLine) bool { return ids[l.CategoryID] }, nil
+	}
+
+	return func(types.PriceLine) bool { return true }, nil
+}
@@ -0,0 +1,138 @@
+package promotion
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/types"
+)
+
+func TestPrice(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	shoes, boots, widget := 1, 2, 1
+
+	// Two pairs of shoes at 30 and one pair of boots at 50 (a subcategory of
+	// shoes), plus a 20 hat outside both: 130 in all.
+	lines := []types.PriceLine{
+		{ProductID: 1, CategoryID: shoes, UnitPrice: types.MustParseMoney("30"), Quantity: 2},
+		{ProductID: 2, CategoryID: boots, UnitPrice: types.MustParseMoney("50"), Quantity: 1},
+		{ProductID: 3, CategoryID: 3, UnitPrice: types.MustParseMoney("20"), Quantity: 1},
+	}
+
+	tests := []struct {
+		name      string
+		promotion types.Promotion
+		inactive  bool
+		userUses  int
+		discount  string
+		invalid   bool
+	}{
+		{name: "should take a percentage off the cart", promotion: types.Promotion{Type: types.PromotionPercentage, Value: 10}, discount: "13"},
+		{name: "should take a fixed amount off the cart", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("15")}, discount: "15"},
+		{name: "should not discount more than the eligible items cost", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("100"), ProductID: &widget}, discount: "60"},
+		{name: "should round a percentage to the cent", promotion: types.Promotion{Type: types.PromotionPercentage, Value: 8.875}, discount: "11.54"},
+		{name: "should limit the discount to a product", promotion: types.Promotion{Type: types.PromotionPercentage, Value: 50, ProductID: &widget}, discount: "30"},
+		{name: "should include subcategories in a category", promotion: types.Promotion{Type: types.PromotionPercentage, Value: 10, CategoryID: &shoes}, discount: "11"},
+		{name: "should give the cheapest items away with buy X get Y", promotion: types.Promotion{Type: types.PromotionBuyXGetY, Value: 100, BuyQuantity: 1, GetQuantity: 1}, discount: "50"},
+		{name: "should half price the free item with buy X get Y at 50", promotion: types.Promotion{Type: types.PromotionBuyXGetY, Value: 50, BuyQuantity: 2, GetQuantity: 1, CategoryID: &shoes}, discount: "15"},
+		{name: "should need enough items for buy X get Y", promotion: types.Promotion{Type: types.PromotionBuyXGetY, Value: 100, BuyQuantity: 1, GetQuantity: 1, ProductID: &boots}, invalid: true},
+		{name: "should require the minimum spend", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), MinSpend: types.MustParseMoney("150")}, invalid: true},
+		{name: "should reject a coupon before it starts", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), StartsAt: &future}, invalid: true},
+		{name: "should reject an expired coupon", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), EndsAt: &past}, invalid: true},
+		{name: "should reject an inactive coupon", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("5")}, inactive: true, invalid: true},
+		{name: "should reject a fully redeemed coupon", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), MaxUses: 3, UsedCount: 3}, invalid: true},
+		{name: "should reject a coupon the user has used up", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), MaxUsesPerUser: 1}, userUses: 1, invalid: true},
+		{name: "should reject a coupon for items not in the cart", promotion: types.Promotion{Type: types.PromotionFixed, Amount: types.MustParseMoney("5"), ProductID: new(int)}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.promotion
+			p.ID = 1
+			p.Code = "CODE"
+			p.Active = !tt.inactive
+
+			store := &mockPromotionStore{promotion: p, uses: tt.userUses}
+			s := NewService(store, &mockCategoryStore{}, nil)
+
+			b, err := s.Price(1, "code", lines)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidCoupon) {
+					t.Errorf("Expected an invalid coupon, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			discount := types.MustParseMoney(tt.discount)
+			if b.Subtotal != types.MustParseMoney("130") || b.DiscountTotal != discount || b.Total != types.MustParseMoney("130").Sub(discount) {
+				t.Errorf("Expected 130 less %s, got %+v", tt.discount, b)
+			}
+		})
+	}
+
+	t.Run("should price without a coupon", func(t *testing.T) {
+		b, err := NewService(&mockPromotionStore{}, nil, nil).Price(1, "", lines)
+		if err != nil || b.Total != types.MustParseMoney("130") || len(b.Discounts) != 0 {
+			t.Errorf("Expected a total of 130 without discounts, got %+v, %v", b, err)
+		}
+	})
+
+	t.Run("should reject an unknown code", func(t *testing.T) {
+		_, err := NewService(&mockPromotionStore{}, nil, nil).Price(1, "NOPE", lines)
+		if !errors.Is(err, ErrInvalidCoupon) {
+			t.Errorf("Expected an invalid coupon, got %v", err)
+		}
+	})
+}
+
+type mockPromotionStore struct {
+	promotion types.Promotion
+	uses      int
+}
+
+func (m *mockPromotionStore) GetPromotions() ([]types.Promotion, error)         { return nil, nil }
+func (m *mockPromotionStore) GetPromotionByID(id int) (*types.Promotion, error) { return nil, nil }
+func (m *mockPromotionStore) CreatePromotion(p types.Promotion) (int, error)    { return 0, nil }
+func (m *mockPromotionStore) UpdatePromotion(p types.Promotion) error           { return nil }
+
+func (m *mockPromotionStore) GetPromotionByCode(code string) (*types.Promotion, error) {
+	if m.promotion.Code != code {
+		return nil, ErrPromotionNotFound
+	}
+	p := m.promotion
+	return &p, nil
+}
+
+func (m *mockPromotionStore) GetPromotionByCodeForUpdate(tx types.Tx, code string) (*types.Promotion, error) {
+	return m.GetPromotionByCode(code)
+}
+
+func (m *mockPromotionStore) CountRedemptions(promotionID, userID int) (int, error) {
+	return m.uses, nil
+}
+
+func (m *mockPromotionStore) CountRedemptionsForUpdate(tx types.Tx, promotionID, userID int) (int, error) {
+	return m.uses, nil
+}
+
+func (m *mockPromotionStore) CreateRedemption(tx types.Tx, promotionID, userID, orderID int) error {
+	return nil
+}
+
+type mockCategoryStore struct {
+	types.CategoryStore
+}
+
+func (m *mockCategoryStore) GetCategories() ([]types.Category, error) {
+	shoes := 1
+	return []types.Category{
+		{ID: 1, Name: "Shoes"},
+		{ID: 2, Name: "Boots", ParentID: &shoes},
+		{ID: 3, Name: "Hats"},
+	}, nil
+}
@@ -0,0 +1,159 @@
+package promotion
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"backend/types"
+)
+
+var ErrPromotionNotFound = errors.New("promotion not found")
+
+const promotionColumns = "id, code, description, type, value, amount, min_spend, buy_quantity, get_quantity, product_id, category_id, max_uses, max_uses_per_user, used_count, starts_at, ends_at, active, created_at"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetPromotions() ([]types.Promotion, error) {
+	rows, err := s.db.Query("SELECT " + promotionColumns + " FROM promotions ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := []types.Promotion{}
+	for rows.Next() {
+		p, err := scanRowsIntoPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, *p)
+	}
+
+	return promotions, rows.Err()
+}
+
+func (s *Store) GetPromotionByID(id int) (*types.Promotion, error) {
+	return getPromotion(s.db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE id = ?", id))
+}
+
+func (s *Store) GetPromotionByCode(code string) (*types.Promotion, error) {
+	return getPromotion(s.db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE code = ?", code))
+}
+
+func (s *Store) GetPromotionByCodeForUpdate(tx types.Tx, code string) (*types.Promotion, error) {
+	return getPromotion(tx.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE code = ? FOR UPDATE", code))
+}
+
+func getPromotion(row *sql.Row) (*types.Promotion, error) {
+	p, err := scanRowsIntoPromotion(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrPromotionNotFound
+	}
+	return p, err
+}
+
+func (s *Store) CreatePromotion(p types.Promotion) (int, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO promotions (code, description, type, value, amount, min_spend, buy_quantity, get_quantity, product_id, category_id, max_uses, max_uses_per_user, starts_at, ends_at, active) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		p.Code, p.Description, p.Type, p.Value, p.Amount, p.MinSpend, p.BuyQuantity, p.GetQuantity, p.ProductID, p.CategoryID, p.MaxUses, p.MaxUsesPerUser, p.StartsAt, p.EndsAt, p.Active,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) UpdatePromotion(p types.Promotion) error {
+	_, err := s.db.Exec(
+		"UPDATE promotions SET code = ?, description = ?, type = ?, value = ?, amount = ?, min_spend = ?, buy_quantity = ?, get_quantity = ?, product_id = ?, category_id = ?, max_uses = ?, max_uses_per_user = ?, starts_at = ?, ends_at = ?, active = ? WHERE id = ?",
+		p.Code, p.Description, p.Type, p.Value, p.Amount, p.MinSpend, p.BuyQuantity, p.GetQuantity, p.ProductID, p.CategoryID, p.MaxUses, p.MaxUsesPerUser, p.StartsAt, p.EndsAt, p.Active, p.ID,
+	)
+	return err
+}
+
+func (s *Store) CountRedemptions(promotionID, userID int) (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ?", promotionID, userID).Scan(&n)
+	return n, err
+}
+
+// CountRedemptionsForUpdate counts inside tx with a locking read, which sees
+// redemptions committed after tx started.
+func (s *Store) CountRedemptionsForUpdate(tx types.Tx, promotionID, userID int) (int, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ? LOCK IN SHARE MODE", promotionID, userID).Scan(&n)
+	return n, err
+}
+
+func (s *Store) CreateRedemption(tx types.Tx, promotionID, userID, orderID int) error {
+	_, err := tx.Exec("INSERT INTO promotion_redemptions (promotion_id, user_id, order_id) VALUES (?, ?, ?)", promotionID, userID, orderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE promotions SET used_count = used_count + 1 WHERE id = ?", promotionID)
+	return err
+}
+
+func scanRowsIntoPromotion(rows interface{ Scan(dest ...any) error }) (*types.Promotion, error) {
+	p := new(types.Promotion)
+	var productID, categoryID sql.NullInt64
+	var startsAt, endsAt sql.NullTime
+
+	err := rows.Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.Type,
+		&p.Value,
+		&p.Amount,
+		&p.MinSpend,
+		&p.BuyQuantity,
+		&p.GetQuantity,
+		&productID,
+		&categoryID,
+		&p.MaxUses,
+		&p.MaxUsesPerUser,
+		&p.UsedCount,
+		&startsAt,
+		&endsAt,
+		&p.Active,
+		&p.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if productID.Valid {
+		id := int(productID.Int64)
+		p.ProductID = &id
+	}
+	if categoryID.Valid {
+		id := int(categoryID.Int64)
+		p.CategoryID = &id
+	}
+	p.StartsAt = nullTime(startsAt)
+	p.EndsAt = nullTime(endsAt)
+
+	return p, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
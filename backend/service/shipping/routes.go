@@ -0,0 +1,160 @@
+package shipping
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend/service/auth"
+	"backend/types"
+	"backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store     types.ShippingMethodStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.ShippingMethodStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/shipping-methods", auth.WithJWTAuth(auth.WithRole(h.handleGetShippingMethods, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/shipping-methods", auth.WithJWTAuth(auth.WithRole(h.handleCreateShippingMethod, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/shipping-methods/{methodID}", auth.WithJWTAuth(auth.WithRole(h.handleUpdateShippingMethod, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/admin/shipping-methods/{methodID}", auth.WithJWTAuth(auth.WithRole(h.handleDeleteShippingMethod, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetShippingMethods(w http.ResponseWriter, r *http.Request) {
+	methods, err := h.store.GetShippingMethods()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, methods)
+}
+
+func (h *Handler) handleCreateShippingMethod(w http.ResponseWriter, r *http.Request) {
+	var payload types.ShippingMethodPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	method, err := methodFromPayload(&types.ShippingMethod{Active: true}, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	method.ID, err = h.store.CreateShippingMethod(*method)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, method)
+}
+
+func (h *Handler) handleUpdateShippingMethod(w http.ResponseWriter, r *http.Request) {
+	methodID, err := strconv.Atoi(mux.Vars(r)["methodID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping method ID"))
+		return
+	}
+
+	existing, err := h.store.GetShippingMethodByID(methodID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var payload types.ShippingMethodPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	method, err := methodFromPayload(existing, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.UpdateShippingMethod(*method); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, method)
+}
+
+func (h *Handler) handleDeleteShippingMethod(w http.ResponseWriter, r *http.Request) {
+	methodID, err := strconv.Atoi(mux.Vars(r)["methodID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping method ID"))
+		return
+	}
+
+	if _, err := h.store.GetShippingMethodByID(methodID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err := h.store.DeleteShippingMethod(methodID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// methodFromPayload validates payload and applies it to m, a new method or
+// the one being updated.
+func methodFromPayload(m *types.ShippingMethod, payload types.ShippingMethodPayload) (*types.ShippingMethod, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return nil, fmt.Errorf("invalid payload: %v", errors)
+	}
+
+	if payload.Type == types.ShippingWeightBased && len(payload.Tiers) == 0 {
+		return nil, fmt.Errorf("weight_based methods need tiers")
+	}
+	if payload.Type != types.ShippingWeightBased && len(payload.Tiers) > 0 {
+		return nil, fmt.Errorf("only weight_based methods have tiers")
+	}
+	if payload.Type == types.ShippingFreeOver && payload.FreeOver.IsZero() {
+		return nil, fmt.Errorf("free_over methods need a free_over amount")
+	}
+
+	tiers := append([]types.ShippingTier{}, payload.Tiers...)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MaxWeight < tiers[j].MaxWeight })
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i].MaxWeight == tiers[i-1].MaxWeight {
+			return nil, fmt.Errorf("more than one tier for %d grams", tiers[i].MaxWeight)
+		}
+	}
+
+	countries := []string{}
+	for _, c := range payload.Countries {
+		countries = append(countries, strings.ToUpper(c))
+	}
+
+	m.Name = payload.Name
+	m.Type = payload.Type
+	m.Rate = payload.Rate
+	m.FreeOver = payload.FreeOver
+	m.Tiers = tiers
+	m.Countries = countries
+	if payload.Active != nil {
+		m.Active = *payload.Active
+	}
+
+	return m, nil
+}
@@ -0,0 +1,123 @@
+package shipping
+
+import (
+	"sort"
+	"strings"
+
+	"backend/types"
+)
+
+// volumetricDivisor turns the volume of an item in cubic millimetres into
+// the grams carriers bill it as, at 5000 cubic centimetres to the kilogram.
+const volumetricDivisor = 5000
+
+// BillableWeight returns the grams one of product ships as: its weight or,
+// for a bulky item, its volumetric weight if that is more.
+func BillableWeight(p types.Product) int {
+	return max(p.Weight, p.Length*p.Width*p.Height/volumetricDivisor)
+}
+
+// Provider quotes from the shipping methods in the store. It implements
+// types.ShippingRateProvider.
+type Provider struct {
+	store      types.ShippingMethodStore
+	currencies types.CurrencyService
+}
+
+func NewProvider(store types.ShippingMethodStore, currencies types.CurrencyService) *Provider {
+	return &Provider{store: store, currencies: currencies}
+}
+
+func (p *Provider) Quote(address types.PostalAddress, parcel types.Parcel) ([]types.ShippingOption, error) {
+	methods, err := p.store.GetShippingMethods()
+	if err != nil {
+		return nil, err
+	}
+
+	currency := parcel.Value.Currency
+	if currency == "" {
+		currency = types.DefaultCurrency()
+	}
+
+	options := []types.ShippingOption{}
+	for _, m := range methods {
+		if !m.Active || !shipsTo(m, address.Country) {
+			continue
+		}
+
+		cost, ok, err := p.cost(m, parcel, currency)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		options = append(options, types.ShippingOption{MethodID: m.ID, Name: m.Name, Type: m.Type, Cost: cost})
+	}
+
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Cost.Cmp(options[j].Cost) < 0
+	})
+
+	return options, nil
+}
+
+// cost returns what shipping parcel by m costs in currency, or false if m
+// cannot take it.
+func (p *Provider) cost(m types.ShippingMethod, parcel types.Parcel, currency string) (types.Money, bool, error) {
+	rate := m.Rate
+
+	switch m.Type {
+	case types.ShippingPickup:
+		return types.NewMoney(0, currency), true, nil
+
+	case types.ShippingFreeOver:
+		threshold, err := p.currencies.Convert(m.FreeOver, currency)
+		if err != nil {
+			return types.Money{}, false, err
+		}
+		if parcel.Value.Cmp(threshold) >= 0 {
+			return types.NewMoney(0, currency), true, nil
+		}
+
+	case types.ShippingWeightBased:
+		tier, ok := tierFor(m.Tiers, parcel.Weight)
+		if !ok {
+			return types.Money{}, false, nil
+		}
+		rate = tier.Rate
+	}
+
+	cost, err := p.currencies.Convert(rate, currency)
+	if err != nil {
+		return types.Money{}, false, err
+	}
+	return cost, true, nil
+}
+
+// tierFor returns the lightest of tiers that takes weight grams.
+func tierFor(tiers []types.ShippingTier, weight int) (types.ShippingTier, bool) {
+	var found *types.ShippingTier
+	for i, t := range tiers {
+		if weight <= t.MaxWeight && (found == nil || t.MaxWeight < found.MaxWeight) {
+			found = &tiers[i]
+		}
+	}
+	if found == nil {
+		return types.ShippingTier{}, false
+	}
+	return *found, true
+}
+
+func shipsTo(m types.ShippingMethod, country string) bool {
+	if len(m.Countries) == 0 {
+		return true
+	}
+	for _, c := range m.Countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
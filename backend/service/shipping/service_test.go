@@ -0,0 +1,95 @@
+package shipping
+
+import (
+	"testing"
+
+	"backend/types"
+)
+
+func TestBillableWeight(t *testing.T) {
+	t.Run("should bill a dense item by its weight", func(t *testing.T) {
+		if w := BillableWeight(types.Product{Weight: 800, Length: 100, Width: 100, Height: 100}); w != 800 {
+			t.Errorf("Expected 800, got %d", w)
+		}
+	})
+
+	t.Run("should bill a bulky item by its volume", func(t *testing.T) {
+		if w := BillableWeight(types.Product{Weight: 800, Length: 500, Width: 400, Height: 300}); w != 12000 {
+			t.Errorf("Expected 12000, got %d", w)
+		}
+	})
+}
+
+func TestQuote(t *testing.T) {
+	money := types.MustParseMoney
+	provider := NewProvider(&mockShippingMethodStore{methods: []types.ShippingMethod{
+		{ID: 1, Name: "Tracked", Type: types.ShippingWeightBased, Active: true, Tiers: []types.ShippingTier{
+			{MaxWeight: 5000, Rate: money("8")},
+			{MaxWeight: 2000, Rate: money("5")},
+		}},
+		{ID: 2, Name: "Free over 100", Type: types.ShippingFreeOver, Rate: money("6"), FreeOver: money("100"), Active: true},
+		{ID: 3, Name: "Europe", Type: types.ShippingFlatRate, Rate: money("15"), Countries: []string{"FR", "DE"}, Active: true},
+	}}, mockCurrencyService{})
+
+	quote := func(country string, weight int, value types.Money) map[int]types.Money {
+		options, err := provider.Quote(types.PostalAddress{Country: country}, types.Parcel{Weight: weight, Value: value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		costs := map[int]types.Money{}
+		for _, o := range options {
+			costs[o.MethodID] = o.Cost
+		}
+		return costs
+	}
+
+	t.Run("should pick the lightest tier that takes the parcel", func(t *testing.T) {
+		if costs := quote("US", 1500, money("20")); costs[1] != money("5") {
+			t.Errorf("Expected 5.00, got %v", costs)
+		}
+		if costs := quote("US", 3000, money("20")); costs[1] != money("8") {
+			t.Errorf("Expected 8.00, got %v", costs)
+		}
+	})
+
+	t.Run("should leave out a method no tier takes the parcel for", func(t *testing.T) {
+		if _, ok := quote("US", 6000, money("20"))[1]; ok {
+			t.Error("Expected no quote for a 6kg parcel")
+		}
+	})
+
+	t.Run("should ship free from the threshold up", func(t *testing.T) {
+		if costs := quote("US", 100, money("99.99")); costs[2] != money("6") {
+			t.Errorf("Expected 6.00 below the threshold, got %v", costs[2])
+		}
+		if costs := quote("US", 100, money("100")); !costs[2].IsZero() {
+			t.Errorf("Expected free shipping at the threshold, got %v", costs[2])
+		}
+	})
+
+	t.Run("should only offer a method in its countries", func(t *testing.T) {
+		if _, ok := quote("US", 100, money("20"))[3]; ok {
+			t.Error("Expected no European shipping to the US")
+		}
+		if costs := quote("fr", 100, money("20")); costs[3] != money("15") {
+			t.Errorf("Expected 15.00 to France, got %v", costs[3])
+		}
+	})
+}
+
+type mockShippingMethodStore struct {
+	types.ShippingMethodStore
+	methods []types.ShippingMethod
+}
+
+func (m *mockShippingMethodStore) GetShippingMethods() ([]types.ShippingMethod, error) {
+	return m.methods, nil
+}
+
+type mockCurrencyService struct {
+	types.CurrencyService
+}
+
+func (mockCurrencyService) Convert(amount types.Money, currency string) (types.Money, error) {
+	return amount.In(currency), nil
+}
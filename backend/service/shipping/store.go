@@ -0,0 +1,184 @@
+package shipping
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"backend/types"
+)
+
+var errShippingMethodNotFound = errors.New("shipping method not found")
+
+const shippingMethodColumns = "id, name, type, rate, free_over, countries, active, created_at"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetShippingMethods() ([]types.ShippingMethod, error) {
+	rows, err := s.db.Query("SELECT " + shippingMethodColumns + " FROM shipping_methods ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	methods := []types.ShippingMethod{}
+	for rows.Next() {
+		m, err := scanRowsIntoShippingMethod(rows)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tiers, err := s.getTiers("SELECT method_id, max_weight, rate FROM shipping_rate_tiers ORDER BY method_id, max_weight")
+	if err != nil {
+		return nil, err
+	}
+	for i := range methods {
+		methods[i].Tiers = append(methods[i].Tiers, tiers[methods[i].ID]...)
+	}
+
+	return methods, nil
+}
+
+func (s *Store) GetShippingMethodByID(id int) (*types.ShippingMethod, error) {
+	m, err := scanRowsIntoShippingMethod(s.db.QueryRow("SELECT "+shippingMethodColumns+" FROM shipping_methods WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, errShippingMethodNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tiers, err := s.getTiers("SELECT method_id, max_weight, rate FROM shipping_rate_tiers WHERE method_id = ? ORDER BY max_weight", id)
+	if err != nil {
+		return nil, err
+	}
+	m.Tiers = append(m.Tiers, tiers[id]...)
+
+	return m, nil
+}
+
+// getTiers returns the tiers query selects keyed by the ID of their method.
+func (s *Store) getTiers(query string, args ...any) (map[int][]types.ShippingTier, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := make(map[int][]types.ShippingTier)
+	for rows.Next() {
+		var methodID int
+		var t types.ShippingTier
+		if err := rows.Scan(&methodID, &t.MaxWeight, &t.Rate); err != nil {
+			return nil, err
+		}
+		tiers[methodID] = append(tiers[methodID], t)
+	}
+
+	return tiers, rows.Err()
+}
+
+func (s *Store) CreateShippingMethod(m types.ShippingMethod) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO shipping_methods (name, type, rate, free_over, countries, active) VALUES (?, ?, ?, ?, ?, ?)",
+		m.Name, m.Type, m.Rate, m.FreeOver, strings.Join(m.Countries, ","), m.Active,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := createTiers(tx, int(id), m.Tiers); err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+func (s *Store) UpdateShippingMethod(m types.ShippingMethod) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE shipping_methods SET name = ?, type = ?, rate = ?, free_over = ?, countries = ?, active = ? WHERE id = ?",
+		m.Name, m.Type, m.Rate, m.FreeOver, strings.Join(m.Countries, ","), m.Active, m.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM shipping_rate_tiers WHERE method_id = ?", m.ID); err != nil {
+		return err
+	}
+
+	if err := createTiers(tx, m.ID, m.Tiers); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func createTiers(tx *sql.Tx, methodID int, tiers []types.ShippingTier) error {
+	for _, t := range tiers {
+		if _, err := tx.Exec("INSERT INTO shipping_rate_tiers (method_id, max_weight, rate) VALUES (?, ?, ?)", methodID, t.MaxWeight, t.Rate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteShippingMethod(id int) error {
+	_, err := s.db.Exec("DELETE FROM shipping_methods WHERE id = ?", id)
+	return err
+}
+
+// scanRowsIntoShippingMethod reads shippingMethodColumns from either
+// *sql.Rows or *sql.Row.
+func scanRowsIntoShippingMethod(rows interface{ Scan(dest ...any) error }) (*types.ShippingMethod, error) {
+	m := &types.ShippingMethod{Tiers: []types.ShippingTier{}, Countries: []string{}}
+	var countries string
+
+	err := rows.Scan(
+		&m.ID,
+		&m.Name,
+		&m.Type,
+		&m.Rate,
+		&m.FreeOver,
+		&countries,
+		&m.Active,
+		&m.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if countries != "" {
+		m.Countries = strings.Split(countries, ",")
+	}
+
+	return m, nil
+}
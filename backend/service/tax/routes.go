@@ -0,0 +1,136 @@
+package tax
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/service/auth"
+	"backend/types"
+	"backend/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store     types.TaxRateStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.TaxRateStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/tax-rates", auth.WithJWTAuth(auth.WithRole(h.handleGetTaxRates, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/tax-rates", auth.WithJWTAuth(auth.WithRole(h.handleCreateTaxRate, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/tax-rates/{taxRateID}", auth.WithJWTAuth(auth.WithRole(h.handleUpdateTaxRate, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/admin/tax-rates/{taxRateID}", auth.WithJWTAuth(auth.WithRole(h.handleDeleteTaxRate, types.RoleStaff, types.RoleAdmin), h.userStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetTaxRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.store.GetTaxRates()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rates)
+}
+
+func (h *Handler) handleCreateTaxRate(w http.ResponseWriter, r *http.Request) {
+	var payload types.TaxRatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rate, err := taxRateFromPayload(&types.TaxRate{}, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rate.ID, err = h.store.CreateTaxRate(*rate)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, rate)
+}
+
+func (h *Handler) handleUpdateTaxRate(w http.ResponseWriter, r *http.Request) {
+	taxRateID, err := strconv.Atoi(mux.Vars(r)["taxRateID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid tax rate ID"))
+		return
+	}
+
+	existing, err := h.store.GetTaxRateByID(taxRateID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var payload types.TaxRatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rate, err := taxRateFromPayload(existing, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.UpdateTaxRate(*rate); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, rate)
+}
+
+func (h *Handler) handleDeleteTaxRate(w http.ResponseWriter, r *http.Request) {
+	taxRateID, err := strconv.Atoi(mux.Vars(r)["taxRateID"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid tax rate ID"))
+		return
+	}
+
+	if _, err := h.store.GetTaxRateByID(taxRateID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err := h.store.DeleteTaxRate(taxRateID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// taxRateFromPayload validates payload and applies it to rate, a new rate or
+// the one being updated.
+func taxRateFromPayload(rate *types.TaxRate, payload types.TaxRatePayload) (*types.TaxRate, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		return nil, fmt.Errorf("invalid payload: %v", errors)
+	}
+
+	rate.Name = payload.Name
+	rate.Country = strings.ToUpper(payload.Country)
+	rate.Region = strings.TrimSpace(payload.Region)
+	rate.TaxClass = strings.ToLower(strings.TrimSpace(payload.TaxClass))
+	if rate.TaxClass == "" {
+		rate.TaxClass = types.TaxClassStandard
+	}
+	rate.Rate = payload.Rate
+	rate.Inclusive = payload.Inclusive
+
+	return rate, nil
+}
@@ -0,0 +1,146 @@
+package tax
+
+import (
+	"strings"
+
+	"backend/service/category"
+	"backend/types"
+)
+
+// Calculator is the built-in, rules based tax calculator. It implements
+// types.TaxCalculator.
+//
+// Every rate for the destination's country and region whose tax class
+// matches a line's applies to that line. Inclusive rates are taken out of the
+// line's price, which already contains them; exclusive ones are charged on
+// what is left.
+type Calculator struct {
+	store         types.TaxRateStore
+	categoryStore types.CategoryStore
+}
+
+func NewCalculator(store types.TaxRateStore, categoryStore types.CategoryStore) *Calculator {
+	return &Calculator{store: store, categoryStore: categoryStore}
+}
+
+func (c *Calculator) Calculate(address types.PostalAddress, lines []types.PriceLine, discount types.Money) (*types.TaxBreakdown, error) {
+	var zero types.Money
+	if len(lines) > 0 {
+		zero = types.NewMoney(0, lines[0].UnitPrice.Currency)
+	}
+
+	b := &types.TaxBreakdown{
+		Lines:     []types.TaxLine{},
+		Items:     make([]types.Money, len(lines)),
+		Total:     zero,
+		Exclusive: zero,
+	}
+	for i := range b.Items {
+		b.Items[i] = zero
+	}
+
+	if address.Country == "" || len(lines) == 0 {
+		return b, nil
+	}
+
+	rates, err := c.store.GetTaxRatesForAddress(strings.ToUpper(address.Country), address.Region)
+	if err != nil || len(rates) == 0 {
+		return b, err
+	}
+
+	categories, err := c.categoryStore.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	// Tax lines are kept in the order of the rates, whichever line first
+	// used them.
+	taxLines := make(map[int]*types.TaxLine)
+	order := []int{}
+	charge := func(r types.TaxRate, amount types.Money) {
+		t, ok := taxLines[r.ID]
+		if !ok {
+			t = &types.TaxLine{
+				TaxRateID: r.ID,
+				Name:      r.Name,
+				Country:   r.Country,
+				Region:    r.Region,
+				Rate:      r.Rate,
+				Inclusive: r.Inclusive,
+				Amount:    zero,
+			}
+			taxLines[r.ID] = t
+			order = append(order, r.ID)
+		}
+		t.Amount = t.Amount.Add(amount)
+	}
+
+	amounts := lineAmounts(lines, discount)
+	for i, l := range lines {
+		class := category.TaxClass(categories, l.CategoryID)
+
+		var inclusive, exclusive []types.TaxRate
+		inclusiveRate := 0.0
+		for _, r := range rates {
+			if r.TaxClass != class {
+				continue
+			}
+			if r.Inclusive {
+				inclusive = append(inclusive, r)
+				inclusiveRate += r.Rate
+			} else {
+				exclusive = append(exclusive, r)
+			}
+		}
+
+		net := amounts[i]
+		for _, r := range inclusive {
+			tax := amounts[i].Scale(r.Rate, 100+inclusiveRate)
+			net = net.Sub(tax)
+			b.Items[i] = b.Items[i].Add(tax)
+			charge(r, tax)
+		}
+		for _, r := range exclusive {
+			tax := net.Percent(r.Rate)
+			b.Items[i] = b.Items[i].Add(tax)
+			b.Exclusive = b.Exclusive.Add(tax)
+			charge(r, tax)
+		}
+
+		b.Total = b.Total.Add(b.Items[i])
+	}
+
+	for _, id := range order {
+		b.Lines = append(b.Lines, *taxLines[id])
+	}
+
+	return b, nil
+}
+
+// lineAmounts returns what each of lines costs once discount has been spread
+// over them in proportion to their price. The shares are rounded so that
+// they add up to exactly discount.
+func lineAmounts(lines []types.PriceLine, discount types.Money) []types.Money {
+	amounts := make([]types.Money, len(lines))
+	var subtotal types.Money
+	for i, l := range lines {
+		amounts[i] = l.UnitPrice.Mul(l.Quantity)
+		subtotal = subtotal.Add(amounts[i])
+	}
+
+	if discount.IsZero() || subtotal.IsZero() {
+		return amounts
+	}
+
+	// Each line takes the discount on everything up to and including it
+	// less what the lines before it took.
+	var running, taken types.Money
+	for i := range amounts {
+		running = running.Add(amounts[i])
+		upTo := discount.Scale(float64(running.Minor), float64(subtotal.Minor))
+		amounts[i] = amounts[i].Sub(upTo.Sub(taken))
+		taken = upTo
+	}
+
+	return amounts
+}
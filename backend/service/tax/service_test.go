@@ -0,0 +1,127 @@
+package tax
+
+import (
+	"strings"
+	"testing"
+
+	"backend/types"
+)
+
+func TestCalculate(t *testing.T) {
+	parent := 1
+	categories := []types.Category{
+		{ID: 1, Name: "Food", Slug: "food", TaxClass: "reduced"},
+		{ID: 2, Name: "Snacks", Slug: "snacks", ParentID: &parent},
+		{ID: 3, Name: "Gift cards", Slug: "gift-cards", TaxClass: "exempt"},
+	}
+	rates := []types.TaxRate{
+		{ID: 1, Name: "VAT", Country: "GB", TaxClass: types.TaxClassStandard, Rate: 20, Inclusive: true},
+		{ID: 2, Name: "VAT (reduced)", Country: "GB", TaxClass: "reduced", Rate: 5, Inclusive: true},
+		{ID: 3, Name: "GST", Country: "CA", TaxClass: types.TaxClassStandard, Rate: 5},
+		{ID: 4, Name: "PST", Country: "CA", Region: "BC", TaxClass: types.TaxClassStandard, Rate: 7},
+	}
+	calculator := NewCalculator(&mockTaxRateStore{rates: rates}, &mockCategoryStore{categories: categories})
+
+	line := func(price string, quantity, categoryID int) types.PriceLine {
+		return types.PriceLine{UnitPrice: types.MustParseMoney(price), Quantity: quantity, CategoryID: categoryID}
+	}
+	money := types.MustParseMoney
+
+	t.Run("should take tax out of prices that include it", func(t *testing.T) {
+		b, err := calculator.Calculate(types.PostalAddress{Country: "gb"}, []types.PriceLine{line("12.00", 1, 0), line("10.50", 2, 2), line("25.00", 1, 3)}, types.Money{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Snacks are reduced rate because Food is; gift cards have no rate.
+		if b.Items[0] != money("2.00") || b.Items[1] != money("1.00") || !b.Items[2].IsZero() {
+			t.Errorf("Expected item taxes of 2.00, 1.00 and nothing, got %v", b.Items)
+		}
+		if b.Total != money("3.00") || !b.Exclusive.IsZero() {
+			t.Errorf("Expected 3.00 of tax already in the prices, got %s and %s on top", b.Total, b.Exclusive)
+		}
+		if len(b.Lines) != 2 || b.Lines[0].Name != "VAT" || b.Lines[1].Amount != money("1.00") {
+			t.Errorf("Expected VAT and reduced VAT lines, got %+v", b.Lines)
+		}
+	})
+
+	t.Run("should add national and regional tax on top of prices", func(t *testing.T) {
+		b, err := calculator.Calculate(types.PostalAddress{Country: "CA", Region: "BC"}, []types.PriceLine{line("19.99", 1, 0)}, types.Money{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 5% of 19.99 is 0.9995 and 7% is 1.3993.
+		if b.Total != money("2.40") || b.Exclusive != money("2.40") {
+			t.Errorf("Expected 2.40 of tax on top, got %+v", b)
+		}
+	})
+
+	t.Run("should only charge national tax outside the region", func(t *testing.T) {
+		b, err := calculator.Calculate(types.PostalAddress{Country: "CA", Region: "ON"}, []types.PriceLine{line("19.99", 1, 0)}, types.Money{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Total != money("1.00") || len(b.Lines) != 1 {
+			t.Errorf("Expected 1.00 of GST only, got %+v", b)
+		}
+	})
+
+	t.Run("should spread a discount over the lines before taxing them", func(t *testing.T) {
+		lines := []types.PriceLine{line("10.00", 1, 0), line("10.00", 1, 0), line("10.00", 1, 0)}
+		amounts := lineAmounts(lines, money("10.00"))
+
+		total := types.Money{}
+		for _, a := range amounts {
+			total = total.Add(a)
+		}
+		if amounts[0] != money("6.67") || amounts[1] != money("6.66") || total != money("20.00") {
+			t.Errorf("Expected 6.67, 6.66 and 6.67 adding up to 20.00, got %v", amounts)
+		}
+
+		b, err := calculator.Calculate(types.PostalAddress{Country: "CA"}, lines, money("10.00"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Tax is rounded line by line: 5% of 6.67 and of 6.66 is 0.33.
+		if b.Total != money("0.99") {
+			t.Errorf("Expected 0.99, got %s", b.Total)
+		}
+	})
+
+	t.Run("should charge nothing without an address or a rate", func(t *testing.T) {
+		for _, address := range []types.PostalAddress{{}, {Country: "US"}} {
+			b, err := calculator.Calculate(address, []types.PriceLine{line("12.00", 1, 0)}, types.Money{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !b.Total.IsZero() || len(b.Lines) != 0 || !b.Items[0].IsZero() {
+				t.Errorf("Expected no tax for %+v, got %+v", address, b)
+			}
+		}
+	})
+}
+
+type mockTaxRateStore struct {
+	types.TaxRateStore
+	rates []types.TaxRate
+}
+
+func (m *mockTaxRateStore) GetTaxRatesForAddress(country, region string) ([]types.TaxRate, error) {
+	rates := []types.TaxRate{}
+	for _, r := range m.rates {
+		if r.Country == country && (r.Region == "" || strings.EqualFold(r.Region, region)) {
+			rates = append(rates, r)
+		}
+	}
+	return rates, nil
+}
+
+type mockCategoryStore struct {
+	types.CategoryStore
+	categories []types.Category
+}
+
+func (m *mockCategoryStore) GetCategories() ([]types.Category, error) {
+	return m.categories, nil
+}
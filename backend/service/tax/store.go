@@ -0,0 +1,106 @@
+package tax
+
+import (
+	"database/sql"
+	"errors"
+
+	"backend/types"
+)
+
+var errTaxRateNotFound = errors.New("tax rate not found")
+
+const taxRateColumns = "id, name, country, region, tax_class, rate, inclusive, created_at"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetTaxRates() ([]types.TaxRate, error) {
+	return s.getTaxRates("SELECT " + taxRateColumns + " FROM tax_rates ORDER BY country, region, id")
+}
+
+func (s *Store) GetTaxRatesForAddress(country, region string) ([]types.TaxRate, error) {
+	return s.getTaxRates("SELECT "+taxRateColumns+" FROM tax_rates WHERE country = ? AND (region = '' OR region = ?) ORDER BY region, id", country, region)
+}
+
+func (s *Store) getTaxRates(query string, args ...any) ([]types.TaxRate, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []types.TaxRate{}
+	for rows.Next() {
+		r, err := scanRowsIntoTaxRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, *r)
+	}
+
+	return rates, rows.Err()
+}
+
+func (s *Store) GetTaxRateByID(id int) (*types.TaxRate, error) {
+	r, err := scanRowsIntoTaxRate(s.db.QueryRow("SELECT "+taxRateColumns+" FROM tax_rates WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, errTaxRateNotFound
+	}
+	return r, err
+}
+
+func (s *Store) CreateTaxRate(r types.TaxRate) (int, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO tax_rates (name, country, region, tax_class, rate, inclusive) VALUES (?, ?, ?, ?, ?, ?)",
+		r.Name, r.Country, r.Region, r.TaxClass, r.Rate, r.Inclusive,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) UpdateTaxRate(r types.TaxRate) error {
+	_, err := s.db.Exec(
+		"UPDATE tax_rates SET name = ?, country = ?, region = ?, tax_class = ?, rate = ?, inclusive = ? WHERE id = ?",
+		r.Name, r.Country, r.Region, r.TaxClass, r.Rate, r.Inclusive, r.ID,
+	)
+	return err
+}
+
+func (s *Store) DeleteTaxRate(id int) error {
+	_, err := s.db.Exec("DELETE FROM tax_rates WHERE id = ?", id)
+	return err
+}
+
+// scanRowsIntoTaxRate reads taxRateColumns from either *sql.Rows or *sql.Row.
+func scanRowsIntoTaxRate(rows interface{ Scan(dest ...any) error }) (*types.TaxRate, error) {
+	r := new(types.TaxRate)
+
+	err := rows.Scan(
+		&r.ID,
+		&r.Name,
+		&r.Country,
+		&r.Region,
+		&r.TaxClass,
+		&r.Rate,
+		&r.Inclusive,
+		&r.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
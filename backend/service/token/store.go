@@ -0,0 +1,103 @@
+package token
+
+import (
+	"database/sql"
+	"fmt"
+
+	"backend/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateRefreshToken(tx types.Tx, token types.RefreshToken) error {
+	_, err := tx.Exec("INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?)", token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+func (s *Store) GetRefreshTokenForUpdate(tx types.Tx, tokenHash string) (*types.RefreshToken, error) {
+	token := new(types.RefreshToken)
+	var revokedAt sql.NullTime
+
+	err := tx.QueryRow("SELECT id, user_id, family_id, token_hash, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ? FOR UPDATE", tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&revokedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("refresh token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return token, nil
+}
+
+func (s *Store) RevokeRefreshToken(tx types.Tx, id int) error {
+	_, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", id)
+	return err
+}
+
+func (s *Store) RevokeTokenFamily(tx types.Tx, familyID string) error {
+	_, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = ? AND revoked_at IS NULL", familyID)
+	return err
+}
+
+func (s *Store) RevokeUserRefreshTokens(tx types.Tx, userID int) error {
+	_, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", userID)
+	return err
+}
+
+func (s *Store) CreateUserToken(tx types.Tx, token types.UserToken) error {
+	_, err := tx.Exec("INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES (?, ?, ?, ?)", token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+func (s *Store) GetUserTokenForUpdate(tx types.Tx, tokenHash string, purpose string) (*types.UserToken, error) {
+	token := new(types.UserToken)
+	var usedAt sql.NullTime
+
+	err := tx.QueryRow("SELECT id, user_id, purpose, token_hash, expires_at, used_at FROM user_tokens WHERE token_hash = ? AND purpose = ? FOR UPDATE", tokenHash, purpose).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&usedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+
+	return token, nil
+}
+
+func (s *Store) MarkUserTokenUsed(tx types.Tx, id int) error {
+	_, err := tx.Exec("UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", id)
+	return err
+}
+
+func (s *Store) InvalidateUserTokens(tx types.Tx, userID int, purpose string) error {
+	_, err := tx.Exec("UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose)
+	return err
+}
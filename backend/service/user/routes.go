@@ -1,10 +1,11 @@
 package user
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 
-	"backend/config"
 	"backend/service/auth"
 	"backend/types"
 	"backend/utils"
@@ -13,16 +14,42 @@ import (
 )
 
 type Handler struct {
-	store types.UserStore
+	store          types.UserStore
+	tokenStore     types.RefreshTokenStore
+	userTokenStore types.UserTokenStore
+	mailer         types.Mailer
+	transactor     types.Transactor
 }
 
-func NewHandler(store types.UserStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(
+	store types.UserStore,
+	tokenStore types.RefreshTokenStore,
+	userTokenStore types.UserTokenStore,
+	mailer types.Mailer,
+	transactor types.Transactor,
+) *Handler {
+	return &Handler{
+		store:          store,
+		tokenStore:     tokenStore,
+		userTokenStore: userTokenStore,
+		mailer:         mailer,
+		transactor:     transactor,
+	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/login", h.handleLogin).Methods("POST")
 	router.HandleFunc("/register", h.handleRegister).Methods("POST")
+	router.HandleFunc("/token/refresh", h.handleRefreshToken).Methods("POST")
+	router.HandleFunc("/logout", h.handleLogout).Methods("POST")
+	router.HandleFunc("/password/forgot", h.handleForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", h.handleResetPassword).Methods("POST")
+	router.HandleFunc("/verify-email", h.handleVerifyEmail).Methods("GET")
+
+	router.HandleFunc("/me", auth.WithJWTAuth(h.handleGetMe, h.store)).Methods("GET")
+	router.HandleFunc("/me", auth.WithJWTAuth(h.handleUpdateMe, h.store)).Methods("PATCH")
+	router.HandleFunc("/me", auth.WithJWTAuth(h.handleDeleteMe, h.store)).Methods("DELETE")
+	router.HandleFunc("/me/password", auth.WithJWTAuth(h.handleChangePassword, h.store)).Methods("POST")
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -54,15 +81,62 @@ var payload types.LoginUserPayload
 		return
 	}
 
-	secret := []byte(config.Envs.JWTSecret)
+	tokens, err := h.startSession(u)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (h *Handler) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var payload types.RefreshTokenPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
 
-	token, err := auth.CreateJWT(secret, u.ID)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	tokens, err := h.rotateRefreshToken(payload.RefreshToken)
+	if errors.Is(err, errInvalidRefreshToken) || errors.Is(err, errRefreshTokenReused) {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token})
+	utils.WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	var payload types.RefreshTokenPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	if err := h.revokeSession(payload.RefreshToken); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
 }
 
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
@@ -94,17 +168,197 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	fmt.Println("Creating new user with email:", payload.Email)
-	err = h.store.CreateUser(&types.User{
+	u := &types.User{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     payload.Email,
 		Password:  hashedPassword,
-	})
+	}
+	err = h.store.CreateUser(u)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 	fmt.Println("User created successfully:", payload.Email)
+
+	// The account exists either way; a failed mail only delays verification.
+	if err := h.sendVerificationEmail(u); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", u.ID, err)
+	}
+
 	utils.WriteJSON(w, http.StatusCreated, map[string]string{"message": "User created successfully"})
 }
 
+
+func (h *Handler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ForgotPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	// The response is the same whether or not the address is registered so
+	// that it cannot be used to find out who has an account.
+	if u, err := h.store.GetUserByEmail(payload.Email); err == nil {
+		if err := h.sendPasswordResetEmail(u); err != nil {
+			log.Printf("failed to send password reset email to user %d: %v", u.ID, err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "If the email is registered, a reset link has been sent"})
+}
+
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ResetPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	err := h.resetPassword(payload.Token, payload.Password)
+	if errors.Is(err, errInvalidUserToken) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Password updated"})
+}
+
+func (h *Handler) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing token"))
+		return
+	}
+
+	err := h.verifyEmail(token)
+	if errors.Is(err, errInvalidUserToken) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Email verified"})
+}
+
+func (h *Handler) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	u.Password = ""
+	utils.WriteJSON(w, http.StatusOK, u)
+}
+
+func (h *Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.UpdateProfilePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	u, err := h.updateProfile(userID, payload)
+	if errors.Is(err, errEmailTaken) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	u.Password = ""
+	utils.WriteJSON(w, http.StatusOK, u)
+}
+
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.ChangePasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	tokens, err := h.changePassword(userID, payload.CurrentPassword, payload.NewPassword)
+	if errors.Is(err, errWrongPassword) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (h *Handler) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.DeleteAccountPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrors))
+		return
+	}
+
+	err := h.deleteAccount(userID, payload.Password)
+	if errors.Is(err, errWrongPassword) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Account deleted"})
+}
@@ -2,19 +2,27 @@ package user
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"backend/service/auth"
+	"backend/service/mail"
 	"backend/types"
 	"github.com/gorilla/mux"
 )
 
 func TestUserServiceHandlers(t *testing.T) {
 	userStore := &mockUserStore{} 
-	handler := NewHandler(userStore) 
+	handler := NewHandler(userStore, &mockRefreshTokenStore{}, &mockUserTokenStore{}, mail.NewMemoryMailer(), mockTransactor{})
 
 	t.Run("should fail if the user payload is invalid", func(t *testing.T) {
 		payload := types.RegisterUserPayload{
@@ -63,15 +71,413 @@ func TestUserServiceHandlers(t *testing.T) {
 	})
 }
 
-type mockUserStore struct{}
+func TestRefreshTokens(t *testing.T) {
+	tokenStore := &mockRefreshTokenStore{}
+	handler := NewHandler(&mockUserStore{}, tokenStore, &mockUserTokenStore{}, mail.NewMemoryMailer(), mockTransactor{})
 
+	post := func(path string, refreshToken string) (*httptest.ResponseRecorder, types.TokenPair) {
+		marshalled, _ := json.Marshal(types.RefreshTokenPayload{RefreshToken: refreshToken})
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(marshalled))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/token/refresh", handler.handleRefreshToken).Methods(http.MethodPost)
+		router.HandleFunc("/logout", handler.handleLogout).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		var tokens types.TokenPair
+		json.Unmarshal(rr.Body.Bytes(), &tokens)
+		return rr, tokens
+	}
+
+	login := func() *types.TokenPair {
+		tokens, err := handler.startSession(&types.User{ID: 1, Role: types.RoleCustomer})
+		if err != nil {
+			t.Fatalf("error starting session: %v", err)
+		}
+		return tokens
+	}
+
+	t.Run("should rotate a refresh token", func(t *testing.T) {
+		first := login()
+
+		rr, second := post("/token/refresh", first.RefreshToken)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if second.AccessToken == "" || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+			t.Errorf("Expected a new token pair, got %+v", second)
+		}
+	})
+
+	t.Run("should revoke the family when a used token is replayed", func(t *testing.T) {
+		first := login()
+		_, second := post("/token/refresh", first.RefreshToken)
+
+		rr, _ := post("/token/refresh", first.RefreshToken)
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		rr, _ = post("/token/refresh", second.RefreshToken)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the newer token to be revoked too, got status code %d", rr.Code)
+		}
+	})
+
+	t.Run("should reject an unknown refresh token", func(t *testing.T) {
+		rr, _ := post("/token/refresh", "unknown")
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should revoke the session on logout", func(t *testing.T) {
+		first := login()
+
+		rr, _ := post("/logout", first.RefreshToken)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr, _ = post("/token/refresh", first.RefreshToken)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d after logout, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestPasswordResetAndVerification(t *testing.T) {
+	userStore := &mockUserStore{users: []*types.User{{ID: 1, FirstName: "Jane", Email: "jane@mail.com", Role: types.RoleCustomer}}}
+	tokenStore := &mockRefreshTokenStore{}
+	mailer := mail.NewMemoryMailer()
+	handler := NewHandler(userStore, tokenStore, &mockUserTokenStore{}, mailer, mockTransactor{})
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	send := func(method, path string, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	lastToken := func() string {
+		messages := mailer.Messages()
+		if len(messages) == 0 {
+			t.Fatal("expected an email to be sent")
+		}
+		body := messages[len(messages)-1].Body
+		i := strings.Index(body, "token=")
+		if i < 0 {
+			t.Fatalf("expected a token in %q", body)
+		}
+		token, _ := url.QueryUnescape(strings.Fields(body[i+len("token="):])[0])
+		return token
+	}
+
+	t.Run("should not reveal unknown emails", func(t *testing.T) {
+		rr := send(http.MethodPost, "/password/forgot", types.ForgotPasswordPayload{Email: "nobody@mail.com"})
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if n := len(mailer.Messages()); n != 0 {
+			t.Errorf("expected no email to be sent, got %d", n)
+		}
+	})
+
+	t.Run("should reset the password once per token", func(t *testing.T) {
+		tokens, _ := handler.startSession(userStore.users[0])
+
+		rr := send(http.MethodPost, "/password/forgot", types.ForgotPasswordPayload{Email: "jane@mail.com"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		token := lastToken()
+
+		rr = send(http.MethodPost, "/password/reset", types.ResetPasswordPayload{Token: token, Password: "newpassword"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if userStore.users[0].Password == "" {
+			t.Error("expected the password to be updated")
+		}
+
+		rr = send(http.MethodPost, "/token/refresh", types.RefreshTokenPayload{RefreshToken: tokens.RefreshToken})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected existing sessions to be revoked, got status code %d", rr.Code)
+		}
+
+		rr = send(http.MethodPost, "/password/reset", types.ResetPasswordPayload{Token: token, Password: "otherpassword"})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for a used token, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should verify the email once per token", func(t *testing.T) {
+		if err := handler.sendVerificationEmail(userStore.users[0]); err != nil {
+			t.Fatalf("error sending verification email: %v", err)
+		}
+		token := lastToken()
+
+		rr := send(http.MethodGet, "/verify-email?token="+url.QueryEscape(token), nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !userStore.users[0].EmailVerified {
+			t.Error("expected the email to be verified")
+		}
+
+		rr = send(http.MethodGet, "/verify-email?token="+url.QueryEscape(token), nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for a used token, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestCurrentUser(t *testing.T) {
+	password, _ := auth.HashPassword("password123")
+	userStore := &mockUserStore{users: []*types.User{
+		{ID: 1, FirstName: "Jane", LastName: "Doe", Email: "jane@mail.com", Password: password, Role: types.RoleCustomer, EmailVerified: true},
+		{ID: 2, FirstName: "John", LastName: "Doe", Email: "john@mail.com", Password: password, Role: types.RoleCustomer},
+	}}
+	mailer := mail.NewMemoryMailer()
+	handler := NewHandler(userStore, &mockRefreshTokenStore{}, &mockUserTokenStore{}, mailer, mockTransactor{})
+
+	send := func(method, path string, payload any) *httptest.ResponseRecorder {
+		marshalled, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(marshalled))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/me", handler.handleGetMe).Methods(http.MethodGet)
+		router.HandleFunc("/me", handler.handleUpdateMe).Methods(http.MethodPatch)
+		router.HandleFunc("/me", handler.handleDeleteMe).Methods(http.MethodDelete)
+		router.HandleFunc("/me/password", handler.handleChangePassword).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should return the profile without the password", func(t *testing.T) {
+		rr := send(http.MethodGet, "/me", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if strings.Contains(rr.Body.String(), "password") {
+			t.Errorf("expected no password in %s", rr.Body.String())
+		}
+	})
+
+	t.Run("should fail if the email belongs to another user", func(t *testing.T) {
+		email := "john@mail.com"
+		rr := send(http.MethodPatch, "/me", types.UpdateProfilePayload{Email: &email})
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should require verifying a new email", func(t *testing.T) {
+		name, email := "Janet", "janet@mail.com"
+		rr := send(http.MethodPatch, "/me", types.UpdateProfilePayload{FirstName: &name, Email: &email})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		u := userStore.users[0]
+		if u.FirstName != "Janet" || u.LastName != "Doe" || u.Email != email || u.EmailVerified {
+			t.Errorf("unexpected user after update: %+v", u)
+		}
+		if messages := mailer.Messages(); len(messages) != 1 || messages[0].To != email {
+			t.Errorf("expected a verification email to %s, got %+v", email, messages)
+		}
+	})
+
+	t.Run("should fail to change the password with a wrong current password", func(t *testing.T) {
+		rr := send(http.MethodPost, "/me/password", types.ChangePasswordPayload{CurrentPassword: "wrong", NewPassword: "newpassword"})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should change the password", func(t *testing.T) {
+		rr := send(http.MethodPost, "/me/password", types.ChangePasswordPayload{CurrentPassword: "password123", NewPassword: "newpassword"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !auth.ComparePassword(userStore.users[0].Password, []byte("newpassword")) {
+			t.Error("expected the new password to be stored")
+		}
+	})
+
+	t.Run("should delete the account", func(t *testing.T) {
+		rr := send(http.MethodDelete, "/me", types.DeleteAccountPayload{Password: "password123"})
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status code %d for the old password, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		rr = send(http.MethodDelete, "/me", types.DeleteAccountPayload{Password: "newpassword"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr = send(http.MethodGet, "/me", nil)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d after deletion, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+type mockTx struct{}
+
+func (mockTx) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (mockTx) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (mockTx) QueryRow(query string, args ...any) *sql.Row        { return nil }
+func (mockTx) Commit() error                                      { return nil }
+func (mockTx) Rollback() error                                    { return nil }
+
+type mockTransactor struct{}
+
+func (mockTransactor) BeginTx() (types.Tx, error) {
+	return mockTx{}, nil
+}
+
+type mockRefreshTokenStore struct {
+	tokens []*types.RefreshToken
+}
+
+func (m *mockRefreshTokenStore) CreateRefreshToken(tx types.Tx, token types.RefreshToken) error {
+	token.ID = len(m.tokens) + 1
+	m.tokens = append(m.tokens, &token)
+	return nil
+}
+
+func (m *mockRefreshTokenStore) GetRefreshTokenForUpdate(tx types.Tx, tokenHash string) (*types.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash {
+			cp := *token
+			return &cp, nil
+		}
+	}
+	return nil, fmt.Errorf("refresh token not found")
+}
+
+func (m *mockRefreshTokenStore) RevokeRefreshToken(tx types.Tx, id int) error {
+	now := time.Now()
+	m.tokens[id-1].RevokedAt = &now
+	return nil
+}
+
+func (m *mockRefreshTokenStore) RevokeTokenFamily(tx types.Tx, familyID string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockRefreshTokenStore) RevokeUserRefreshTokens(tx types.Tx, userID int) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type mockUserTokenStore struct {
+	tokens []*types.UserToken
+}
+
+func (m *mockUserTokenStore) CreateUserToken(tx types.Tx, token types.UserToken) error {
+	token.ID = len(m.tokens) + 1
+	m.tokens = append(m.tokens, &token)
+	return nil
+}
+
+func (m *mockUserTokenStore) GetUserTokenForUpdate(tx types.Tx, tokenHash string, purpose string) (*types.UserToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash && token.Purpose == purpose {
+			cp := *token
+			return &cp, nil
+		}
+	}
+	return nil, fmt.Errorf("user token not found")
+}
+
+func (m *mockUserTokenStore) MarkUserTokenUsed(tx types.Tx, id int) error {
+	now := time.Now()
+	m.tokens[id-1].UsedAt = &now
+	return nil
+}
+
+func (m *mockUserTokenStore) InvalidateUserTokens(tx types.Tx, userID int, purpose string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+type mockUserStore struct {
+	users []*types.User
+}
+
+func (m *mockUserStore) find(match func(u *types.User) bool) *types.User {
+	for _, u := range m.users {
+		if match(u) {
+			return u
+		}
+	}
+	return nil
+}
 
 func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	if u := m.find(func(u *types.User) bool { return u.Email == email }); u != nil {
+		cp := *u
+		return &cp, nil
+	}
 	return nil, fmt.Errorf("user not found")
 }
 func (m *mockUserStore) GetUserById(id int) (*types.User, error) {
-	return nil, nil
+	if u := m.find(func(u *types.User) bool { return u.ID == id }); u != nil {
+		cp := *u
+		return &cp, nil
+	}
+	if len(m.users) > 0 {
+		return nil, fmt.Errorf("user with id %d not found", id)
+	}
+	return &types.User{ID: id, Role: types.RoleCustomer}, nil
 }
 func (m *mockUserStore) CreateUser(user *types.User) error {
-	return nil 
-}
\ No newline at end of file
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(tx types.Tx, userID int, password string) error {
+	m.find(func(u *types.User) bool { return u.ID == userID }).Password = password
+	return nil
+}
+
+func (m *mockUserStore) MarkEmailVerified(tx types.Tx, userID int) error {
+	m.find(func(u *types.User) bool { return u.ID == userID }).EmailVerified = true
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(tx types.Tx, user types.User) error {
+	*m.find(func(u *types.User) bool { return u.ID == user.ID }) = user
+	return nil
+}
+
+func (m *mockUserStore) AnonymiseUser(tx types.Tx, userID int) error {
+	m.users = slices.DeleteFunc(m.users, func(u *types.User) bool { return u.ID == userID })
+	return nil
+}
@@ -0,0 +1,395 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"backend/config"
+	"backend/service/auth"
+	"backend/types"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reused, session revoked")
+	errInvalidUserToken    = errors.New("invalid or expired token")
+	errWrongPassword       = errors.New("current password is incorrect")
+	errEmailTaken          = errors.New("email already in use")
+)
+
+// issueTokens creates an access token for u and a refresh token in the given
+// family, storing the refresh token's hash inside tx.
+func (h *Handler) issueTokens(tx types.Tx, u *types.User, familyID string) (*types.TokenPair, error) {
+	accessToken, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), u.ID, u.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := auth.NewToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.tokenStore.CreateRefreshToken(tx, types.RefreshToken{
+		UserID:    u.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(time.Second * time.Duration(config.Envs.RefreshTokenExpirationInSeconds)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    config.Envs.JWTExpirationInSeconds,
+	}, nil
+}
+
+// startSession issues the first token pair of a new token family.
+func (h *Handler) startSession(u *types.User) (*types.TokenPair, error) {
+	familyID, err := auth.NewTokenFamilyID()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tokens, err := h.issueTokens(tx, u, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, tx.Commit()
+}
+
+// rotateRefreshToken exchanges a refresh token for a new pair. Each refresh
+// token is single use: presenting one that was already used means it leaked,
+// so the whole family is revoked and the session has to log in again.
+func (h *Handler) rotateRefreshToken(refreshToken string) (*types.TokenPair, error) {
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stored, err := h.tokenStore.GetRefreshTokenForUpdate(tx, auth.HashToken(refreshToken))
+	if err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	if stored.RevokedAt != nil {
+		if err := h.tokenStore.RevokeTokenFamily(tx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, errRefreshTokenReused
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	if err := h.tokenStore.RevokeRefreshToken(tx, stored.ID); err != nil {
+		return nil, err
+	}
+
+	u, err := h.store.GetUserById(stored.UserID)
+	if err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	tokens, err := h.issueTokens(tx, u, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, tx.Commit()
+}
+
+// revokeSession ends the session the refresh token belongs to. Unknown tokens
+// are ignored so that logging out is idempotent.
+func (h *Handler) revokeSession(refreshToken string) error {
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stored, err := h.tokenStore.GetRefreshTokenForUpdate(tx, auth.HashToken(refreshToken))
+	if err != nil {
+		return nil
+	}
+
+	if err := h.tokenStore.RevokeTokenFamily(tx, stored.FamilyID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// createUserToken stores a new single use token for u and returns it in the
+// clear so it can be mailed; only its hash is kept.
+func (h *Handler) createUserToken(u *types.User, purpose string, ttl time.Duration) (string, error) {
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	err = h.userTokenStore.CreateUserToken(tx, types.UserToken{
+		UserID:    u.ID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
+}
+
+// consumeUserToken marks a token as used inside tx, failing if it is unknown,
+// was already used or has expired.
+func (h *Handler) consumeUserToken(tx types.Tx, token string, purpose string) (*types.UserToken, error) {
+	stored, err := h.userTokenStore.GetUserTokenForUpdate(tx, auth.HashToken(token), purpose)
+	if err != nil {
+		return nil, errInvalidUserToken
+	}
+
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, errInvalidUserToken
+	}
+
+	if err := h.userTokenStore.MarkUserTokenUsed(tx, stored.ID); err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+func (h *Handler) sendVerificationEmail(u *types.User) error {
+	token, err := h.createUserToken(u, types.TokenPurposeEmailVerification, time.Second*time.Duration(config.Envs.EmailVerificationExpirationInSeconds))
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s:%s/api/v1/verify-email?token=%s", config.Envs.PublicHost, config.Envs.Port, url.QueryEscape(token))
+	return h.mailer.Send(types.Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n", u.FirstName, link),
+	})
+}
+
+func (h *Handler) sendPasswordResetEmail(u *types.User) error {
+	token, err := h.createUserToken(u, types.TokenPurposePasswordReset, time.Second*time.Duration(config.Envs.PasswordResetExpirationInSeconds))
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.Envs.FrontendURL, url.QueryEscape(token))
+	return h.mailer.Send(types.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your password. If it was you, open the link below to choose a new one:\n\n%s\n\nIf you did not ask for this you can ignore this email.\n", u.FirstName, link),
+	})
+}
+
+// resetPassword sets a new password using a reset token. Every session of the
+// user is ended, since the old password may have been compromised.
+func (h *Handler) resetPassword(token string, password string) error {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stored, err := h.consumeUserToken(tx, token, types.TokenPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.UpdatePassword(tx, stored.UserID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := h.tokenStore.RevokeUserRefreshTokens(tx, stored.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (h *Handler) verifyEmail(token string) error {
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stored, err := h.consumeUserToken(tx, token, types.TokenPurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.MarkEmailVerified(tx, stored.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateProfile applies the fields set in payload to the user. A new email
+// address has to be verified again, so a verification mail is sent to it.
+func (h *Handler) updateProfile(userID int, payload types.UpdateProfilePayload) (*types.User, error) {
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.FirstName != nil {
+		u.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		u.LastName = *payload.LastName
+	}
+
+	emailChanged := payload.Email != nil && *payload.Email != u.Email
+	if emailChanged {
+		if _, err := h.store.GetUserByEmail(*payload.Email); err == nil {
+			return nil, errEmailTaken
+		}
+		u.Email = *payload.Email
+		u.EmailVerified = false
+	}
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := h.store.UpdateUser(tx, *u); err != nil {
+		return nil, err
+	}
+
+	// Links mailed to the old address must not verify the new one.
+	if emailChanged {
+		if err := h.userTokenStore.InvalidateUserTokens(tx, u.ID, types.TokenPurposeEmailVerification); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		if err := h.sendVerificationEmail(u); err != nil {
+			log.Printf("failed to send verification email to user %d: %v", u.ID, err)
+		}
+	}
+
+	return u, nil
+}
+
+// changePassword replaces the user's password after checking the current one.
+// All other sessions are ended and the caller gets a fresh token pair.
+func (h *Handler) changePassword(userID int, currentPassword, newPassword string) (*types.TokenPair, error) {
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.ComparePassword(u.Password, []byte(currentPassword)) {
+		return nil, errWrongPassword
+	}
+
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	familyID, err := auth.NewTokenFamilyID()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := h.store.UpdatePassword(tx, u.ID, hashedPassword); err != nil {
+		return nil, err
+	}
+
+	if err := h.tokenStore.RevokeUserRefreshTokens(tx, u.ID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := h.issueTokens(tx, u, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, tx.Commit()
+}
+
+// deleteAccount anonymises the user after checking their password. Their
+// orders are kept for accounting, so the row itself is not removed.
+func (h *Handler) deleteAccount(userID int, password string) error {
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+
+	if !auth.ComparePassword(u.Password, []byte(password)) {
+		return errWrongPassword
+	}
+
+	tx, err := h.transactor.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := h.store.AnonymiseUser(tx, u.ID); err != nil {
+		return err
+	}
+
+	if err := h.tokenStore.RevokeUserRefreshTokens(tx, u.ID); err != nil {
+		return err
+	}
+
+	for _, purpose := range []string{types.TokenPurposePasswordReset, types.TokenPurposeEmailVerification} {
+		if err := h.userTokenStore.InvalidateUserTokens(tx, u.ID, purpose); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
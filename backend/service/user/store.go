@@ -7,6 +7,8 @@ import (
 	"backend/types"
 )
 
+const userColumns = "id, firstName, lastName, email, password, role, email_verified_at IS NOT NULL, created_at, updated_at"
+
 type Store struct {
 	db *sql.DB
 }
@@ -19,11 +21,11 @@ func NewStore(db *sql.DB) *Store {
 
 func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 	fmt.Println("Getting user by email:", email)
-	rows, err := s.db.Query("SELECT * FROM users WHERE email = ?", email)
+	rows, err := s.db.Query("SELECT "+userColumns+" FROM users WHERE email = ? AND deleted_at IS NULL", email)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("Query successful:", "SELECT * FROM users WHERE email = ?", email)
+	fmt.Println("Query successful:", "SELECT "+userColumns+" FROM users WHERE email = ? AND deleted_at IS NULL", email)
 	u := new(types.User)
 	for rows.Next() {
 		u, err = scanRowsIntoUser(rows)
@@ -41,15 +43,22 @@ func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 
 func (s *Store) CreateUser(user *types.User) error {
 	query := "INSERT INTO users (firstName, lastName, email, password) VALUES (?, ?, ?, ?)"
-	_, err := s.db.Exec(query, user.FirstName, user.LastName, user.Email, user.Password)
+	res, err := s.db.Exec(query, user.FirstName, user.LastName, user.Email, user.Password)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
 	if err != nil {
 		return err
 	}
+	user.ID = int(id)
+
 	return nil
 }
 
 func (s *Store) GetUserById(id int) (*types.User, error) {
-	query := "SELECT * FROM users WHERE id = ?"
+	query := "SELECT " + userColumns + " FROM users WHERE id = ? AND deleted_at IS NULL"
 	rows, err := s.db.Query(query, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -72,6 +81,41 @@ func (s *Store) GetUserById(id int) (*types.User, error) {
 	return u, nil
 }
 
+func (s *Store) UpdateUserRole(userID int, role string) error {
+	_, err := s.db.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	return err
+}
+
+func (s *Store) UpdatePassword(tx types.Tx, userID int, password string) error {
+	_, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", password, userID)
+	return err
+}
+
+func (s *Store) MarkEmailVerified(tx types.Tx, userID int) error {
+	_, err := tx.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP) WHERE id = ?", userID)
+	return err
+}
+
+// UpdateUser saves the user's names and email. Changing the email clears its
+// verification.
+func (s *Store) UpdateUser(tx types.Tx, user types.User) error {
+	_, err := tx.Exec(
+		"UPDATE users SET email_verified_at = IF(email = ?, email_verified_at, NULL), firstName = ?, lastName = ?, email = ? WHERE id = ? AND deleted_at IS NULL",
+		user.Email, user.FirstName, user.LastName, user.Email, user.ID,
+	)
+	return err
+}
+
+// AnonymiseUser deletes an account by overwriting its personal data. The row
+// is kept so the user's orders still reference it.
+func (s *Store) AnonymiseUser(tx types.Tx, userID int) error {
+	_, err := tx.Exec(
+		"UPDATE users SET firstName = 'Deleted', lastName = 'User', email = CONCAT('deleted-', id, '@invalid'), password = '', email_verified_at = NULL, deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	)
+	return err
+}
+
 func scanRowsIntoUser(rows *sql.Rows) (*types.User, error) {
 	user := new(types.User)
 	var updatedAt sql.NullTime
@@ -81,6 +125,8 @@ func scanRowsIntoUser(rows *sql.Rows) (*types.User, error) {
 		&user.LastName,
 		&user.Email,
 		&user.Password,
+		&user.Role,
+		&user.EmailVerified,
 		&user.CreatedAt,
 		&updatedAt,
 	)
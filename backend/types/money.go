@@ -0,0 +1,308 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount of money in the minor units of its currency, such
+// as cents for USD. The zero Money has no currency and takes on the currency
+// of whatever it is added to, so it can start a sum.
+//
+// In JSON and in the database Money is a plain decimal number in major units
+// ("12.50"); its currency comes from the surrounding record, or the store's
+// default currency where there is none.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// zeroDecimalCurrencies have no minor unit.
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true,
+	"KMF": true, "KRW": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+	"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// defaultCurrency is the store's currency. main sets it from the
+// configuration at startup.
+var defaultCurrency = "USD"
+
+// DefaultCurrency is the store's currency, in which amounts that do not say
+// otherwise are given.
+func DefaultCurrency() string {
+	return defaultCurrency
+}
+
+// SetDefaultCurrency sets the store's currency. It is meant to be called once,
+// before any Money is read.
+func SetDefaultCurrency(currency string) {
+	defaultCurrency = strings.ToUpper(currency)
+}
+
+// NewMoney returns minor units of currency.
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: strings.ToUpper(currency)}
+}
+
+// ParseMoney reads a decimal amount in major units, such as "12.5", in
+// currency. It refuses amounts more precise than the currency's minor unit.
+func ParseMoney(s string, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	digits := decimals(currency)
+
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	negative := strings.HasPrefix(whole, "-")
+	whole = strings.TrimPrefix(whole, "-")
+
+	frac = strings.TrimRight(frac, "0")
+	if whole == "" || len(frac) > digits || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("invalid amount %q for %s", s, currency)
+	}
+
+	minor, err := strconv.ParseInt(whole+frac+strings.Repeat("0", digits-len(frac)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q for %s", s, currency)
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// MustParseMoney is ParseMoney in the default currency for amounts known to
+// be valid. It panics otherwise.
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s, DefaultCurrency())
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func decimals(currency string) int {
+	if zeroDecimalCurrencies[currency] {
+		return 0
+	}
+	return 2
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// String formats m in major units without a currency, such as "12.50".
+func (m Money) String() string {
+	digits := decimals(m.Currency)
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	if digits == 0 {
+		return sign + strconv.FormatInt(minor, 10)
+	}
+
+	unit := pow10(digits)
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/unit, digits, minor%unit)
+}
+
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Minor < 0
+}
+
+// currencyWith returns the currency of the result of combining m and o. It
+// panics if they are in different currencies, which is a programming error.
+func (m Money) currencyWith(o Money) string {
+	switch {
+	case m.Currency == o.Currency || o.Currency == "":
+		return m.Currency
+	case m.Currency == "":
+		return o.Currency
+	}
+	panic(fmt.Sprintf("money: cannot combine %s and %s", m.Currency, o.Currency))
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{Minor: m.Minor + o.Minor, Currency: m.currencyWith(o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{Minor: m.Minor - o.Minor, Currency: m.currencyWith(o)}
+}
+
+// Mul returns m times n, such as a unit price times a quantity.
+func (m Money) Mul(n int) Money {
+	return Money{Minor: m.Minor * int64(n), Currency: m.Currency}
+}
+
+// Cmp returns -1, 0 or +1 as m is less than, equal to or greater than o.
+func (m Money) Cmp(o Money) int {
+	m.currencyWith(o)
+	switch {
+	case m.Minor < o.Minor:
+		return -1
+	case m.Minor > o.Minor:
+		return 1
+	}
+	return 0
+}
+
+// Min returns the smaller of m and o.
+func (m Money) Min(o Money) Money {
+	if o.Cmp(m) < 0 {
+		return o
+	}
+	return m
+}
+
+// percentScale is the precision of percentages in Percent: 1/10000 of a
+// percent, enough for any tax or discount rate.
+const percentScale = 10000
+
+// Percent returns percent percent of m, rounded half away from zero to the
+// minor unit. The rate is exact to four decimal places, so 8.875% of 19.99 is
+// 1.77 without float rounding creeping in.
+func (m Money) Percent(percent float64) Money {
+	rate := int64(percent*percentScale + 0.5)
+	if percent < 0 {
+		rate = int64(percent*percentScale - 0.5)
+	}
+	return Money{Minor: divRound(m.Minor*rate, 100*percentScale), Currency: m.Currency}
+}
+
+// divRound divides a by b, which must be positive, rounding half away from
+// zero.
+func divRound(a, b int64) int64 {
+	if a < 0 {
+		return -((-a + b/2) / b)
+	}
+	return (a + b/2) / b
+}
+
+// Convert returns m in currency at rate, the units of currency that one unit
+// of m's currency buys, rounded half away from zero to the minor unit. The
+// rate is taken as the shortest decimal that reads back as it, so 0.92 is
+// exactly 0.92.
+func (m Money) Convert(currency string, rate float64) Money {
+	currency = strings.ToUpper(currency)
+
+	r := exactRat(rate)
+	r.Mul(r, new(big.Rat).SetInt64(m.Minor))
+	r.Mul(r, big.NewRat(pow10(decimals(currency)), pow10(decimals(m.Currency))))
+
+	return Money{Minor: roundRat(r), Currency: currency}
+}
+
+// Scale returns m times num/den, which must not be zero, rounded half away
+// from zero to the minor unit. Like Convert it reads num and den as their
+// shortest decimals, so the share of a 20% tax in a price that includes it
+// is exactly m.Scale(20, 120).
+func (m Money) Scale(num, den float64) Money {
+	r := exactRat(num)
+	r.Quo(r, exactRat(den))
+	r.Mul(r, new(big.Rat).SetInt64(m.Minor))
+
+	return Money{Minor: roundRat(r), Currency: m.Currency}
+}
+
+// exactRat returns f as the shortest decimal that reads back as it.
+func exactRat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	return r
+}
+
+// roundRat rounds r half away from zero to an integer.
+func roundRat(r *big.Rat) int64 {
+	// Add half of the denominator to the magnitude of the numerator before
+	// truncating.
+	num := new(big.Int).Abs(r.Num())
+	num.Add(num, new(big.Int).Rsh(r.Denom(), 1))
+	num.Quo(num, r.Denom())
+	if r.Sign() < 0 {
+		num.Neg(num)
+	}
+	return num.Int64()
+}
+
+// In returns the decimal amount of m in currency. It is for amounts read
+// without knowing their currency, such as a DECIMAL column scanned in the
+// default currency, and does not convert: 12.00 USD becomes 12 JPY.
+func (m Money) In(currency string) Money {
+	return m.Convert(currency, 1)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding one, in the default
+// currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+
+	parsed, err := ParseMoney(s, DefaultCurrency())
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// Scan reads a DECIMAL column in the default currency.
+func (m *Money) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+
+	parsed, err := ParseMoney(s, DefaultCurrency())
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// Value writes m as a decimal string, which MySQL stores exactly in a
+// DECIMAL column.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
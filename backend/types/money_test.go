@@ -0,0 +1,187 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		minor    int64
+		out      string
+		invalid  bool
+	}{
+		{in: "12.5", currency: "usd", minor: 1250, out: "12.50"},
+		{in: "0.07", currency: "USD", minor: 7, out: "0.07"},
+		{in: "-3", currency: "USD", minor: -300, out: "-3.00"},
+		{in: "19.990", currency: "USD", minor: 1999, out: "19.99"},
+		{in: "1200", currency: "JPY", minor: 1200, out: "1200"},
+		{in: "1200.00", currency: "JPY", minor: 1200, out: "1200"},
+		{in: "9.999", currency: "USD", invalid: true},
+		{in: "12.5", currency: "JPY", invalid: true},
+		{in: "", currency: "USD", invalid: true},
+		{in: ".5", currency: "USD", invalid: true},
+		{in: "1e3", currency: "USD", invalid: true},
+		{in: "1,000", currency: "USD", invalid: true},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.in, tt.currency)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("expected %q in %s to be rejected, got %+v", tt.in, tt.currency, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %v", tt.in, err)
+			continue
+		}
+		if m.Minor != tt.minor || m.String() != tt.out {
+			t.Errorf("expected %q to parse to %d (%s), got %d (%s)", tt.in, tt.minor, tt.out, m.Minor, m)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	t.Run("should add exactly where floats drift", func(t *testing.T) {
+		var total Money
+		for i := 0; i < 10; i++ {
+			total = total.Add(MustParseMoney("0.10"))
+		}
+		if total != MustParseMoney("1") {
+			t.Errorf("expected 1.00, got %s", total)
+		}
+	})
+
+	t.Run("should multiply a unit price by a quantity", func(t *testing.T) {
+		if got := MustParseMoney("19.99").Mul(3); got != MustParseMoney("59.97") {
+			t.Errorf("expected 59.97, got %s", got)
+		}
+	})
+
+	t.Run("should refuse to mix currencies", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected adding USD to EUR to panic")
+			}
+		}()
+		NewMoney(100, "USD").Add(NewMoney(100, "EUR"))
+	})
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string
+		percent float64
+		want    string
+	}{
+		{name: "should round a sales tax down", amount: "19.99", percent: 8.875, want: "1.77"},
+		{name: "should round half a cent up", amount: "10.00", percent: 6.35, want: "0.64"},
+		{name: "should round half a cent away from zero on refunds", amount: "-10.00", percent: 6.35, want: "-0.64"},
+		{name: "should take a discount off a price that does not divide evenly", amount: "33.33", percent: 15, want: "5.00"},
+		{name: "should keep small rates exact", amount: "1000000.00", percent: 0.0001, want: "1.00"},
+		{name: "should take everything at 100 percent", amount: "45.67", percent: 100, want: "45.67"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MustParseMoney(tt.amount).Percent(tt.percent); got != MustParseMoney(tt.want) {
+				t.Errorf("expected %v%% of %s to be %s, got %s", tt.percent, tt.amount, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		from Money
+		to   string
+		rate float64
+		want Money
+	}{
+		{name: "should round to the cent", from: NewMoney(1999, "USD"), to: "EUR", rate: 0.92, want: NewMoney(1839, "EUR")},
+		{name: "should round half a cent up", from: NewMoney(125, "USD"), to: "GBP", rate: 0.5, want: NewMoney(63, "GBP")},
+		{name: "should drop the minor unit for yen", from: NewMoney(1999, "USD"), to: "JPY", rate: 151.37, want: NewMoney(3026, "JPY")},
+		{name: "should add a minor unit from yen", from: NewMoney(3026, "JPY"), to: "USD", rate: 0.0066, want: NewMoney(1997, "USD")},
+		{name: "should reread an amount in another currency", from: NewMoney(120000, "USD"), to: "JPY", rate: 1, want: NewMoney(1200, "JPY")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.from.Convert(tt.to, tt.rate); got != tt.want {
+				t.Errorf("expected %s %s, got %s %s", tt.want, tt.want.Currency, got, got.Currency)
+			}
+		})
+	}
+}
+
+func TestMoneyScale(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		num, den float64
+		want     string
+	}{
+		{name: "should take the tax out of a price that includes it", amount: "12.00", num: 20, den: 120, want: "2.00"},
+		{name: "should round the included tax half away from zero", amount: "9.99", num: 20, den: 120, want: "1.67"},
+		{name: "should keep large amounts exact", amount: "1000000.00", num: 20, den: 120, want: "166666.67"},
+		{name: "should split a discount in proportion", amount: "5.00", num: 1, den: 3, want: "1.67"},
+		{name: "should round negative amounts away from zero", amount: "-0.05", num: 1, den: 2, want: "-0.03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MustParseMoney(tt.amount).Scale(tt.num, tt.den); got != MustParseMoney(tt.want) {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(map[string]Money{"price": MustParseMoney("9.9")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"price":9.90}` {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+
+	var decoded struct {
+		Number Money `json:"number"`
+		String Money `json:"string"`
+	}
+	if err := json.Unmarshal([]byte(`{"number": 12.34, "string": "0.5"}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Number != MustParseMoney("12.34") || decoded.String != MustParseMoney("0.50") {
+		t.Errorf("unexpected amounts: %+v", decoded)
+	}
+
+	if err := json.Unmarshal([]byte(`{"number": 0.001}`), &decoded); err == nil {
+		t.Error("expected an amount below a cent to be rejected")
+	}
+}
+
+func TestMoneySQL(t *testing.T) {
+	var m Money
+	for _, src := range []any{[]byte("24.50"), "24.5", float64(24.5)} {
+		if err := m.Scan(src); err != nil || m != MustParseMoney("24.50") {
+			t.Errorf("expected %v to scan as 24.50, got %s, %v", src, m, err)
+		}
+	}
+
+	if err := m.Scan(nil); err == nil {
+		t.Error("expected NULL to be rejected")
+	}
+
+	v, err := MustParseMoney("3.10").Value()
+	if err != nil || v != "3.10" {
+		t.Errorf("expected 3.10, got %v, %v", v, err)
+	}
+}
@@ -1,57 +1,269 @@
 package types
 
+import (
+	"database/sql"
+	"time"
+)
+
+// Tx is a database transaction shared by several stores so that their writes
+// commit or roll back together. *sql.Tx satisfies it.
+type Tx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Commit() error
+	Rollback() error
+}
+
+type Transactor interface {
+	BeginTx() (Tx, error)
+}
+
 type UserStore interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserById(id int) (*User, error)
 	CreateUser(user *User) error
+	UpdateUserRole(userID int, role string) error
+	UpdatePassword(tx Tx, userID int, password string) error
+	MarkEmailVerified(tx Tx, userID int) error
+	UpdateUser(tx Tx, user User) error
+	AnonymiseUser(tx Tx, userID int) error
 }
 
 type ProductStore interface {
 	GetProductById(id int) (*Product, error)
 	GetProductsById(ids []int) ([]Product, error)
-	GetProducts() ([]*Product, error)
-	CreateProduct(CreateProductPayload) error
-	UpdateProduct(Product) error
+	ListProducts(filter ProductFilter) ([]*Product, int, error)
+	// CreateProduct inserts a product with no stock inside tx and returns
+	// its ID; stock is added through the ledger.
+	CreateProduct(tx Tx, product CreateProductPayload) (int, error)
+	// UpdateProduct saves everything but the quantity, which only stock
+	// movements change.
+	UpdateProduct(tx Tx, product Product) error
+	DeleteProduct(productID int) error
+	GetProductsByCategoryIDs(categoryIDs []int) ([]*Product, error)
+}
+
+const (
+	ProductSortRelevance = "relevance"
+	ProductSortPriceAsc  = "price_asc"
+	ProductSortPriceDesc = "price_desc"
+	ProductSortNameAsc   = "name_asc"
+	ProductSortNameDesc  = "name_desc"
+	ProductSortNewest    = "newest"
+)
+
+// Cursor marks the row a page of a keyset paginated listing starts after
+// (or, when Backward is set, ends before). Kind names the listing that
+// issued it, since cursors for every listing are signed with one secret.
+type Cursor struct {
+	Kind     string `json:"t,omitempty"`
+	Sort     string `json:"s,omitempty"`
+	Key      string `json:"k,omitempty"`
+	ID       int    `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+const (
+	CursorProducts       = "products"
+	CursorOrders         = "orders"
+	CursorStockMovements = "stock_movements"
+)
+
+// Page selects a window of a listing, by Cursor when it is set and by Offset
+// otherwise.
+type Page struct {
+	Limit  int
+	Offset int
+	Cursor *Cursor
+}
+
+// ProductFilter narrows down and orders the catalog for ListProducts. Zero
+// values mean "no restriction".
+type ProductFilter struct {
+	Page
+	Query    string
+	Category string
+	MinPrice *Money
+	MaxPrice *Money
+	InStock  bool
+	Sort     string
 }
 
+// MaxItemQuantity is the most units of one product a cart or an order may
+// hold.
+const MaxItemQuantity = 100
+
 type CartCheckoutItem struct {
 	ProductID int `json:"productID"`
 	Quantity  int `json:"quantity"`
 }
 
 type CreateProductPayload struct {
-	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description"`
-	Image       string  `json:"image"`
-	Price       float64 `json:"price" validate:"required"`
-	Quantity    int     `json:"quantity" validate:"required"`
+	Name             string `json:"name" validate:"required"`
+	Description      string `json:"description"`
+	Image            string `json:"image"`
+	Price            Money  `json:"price" validate:"required,gt=0"`
+	Quantity         int    `json:"quantity" validate:"required"`
+	CategoryID       int    `json:"category_id"`
+	Weight           int    `json:"weight" validate:"gte=0"`
+	Length           int    `json:"length" validate:"gte=0"`
+	Width            int    `json:"width" validate:"gte=0"`
+	Height           int    `json:"height" validate:"gte=0"`
+	ReorderThreshold int    `json:"reorder_threshold" validate:"gte=0"`
+}
+
+type UpdateProductPayload struct {
+	Name             string `json:"name" validate:"required"`
+	Description      string `json:"description"`
+	Image            string `json:"image"`
+	Price            Money  `json:"price" validate:"required,gt=0"`
+	CategoryID       int    `json:"category_id"`
+	Weight           int    `json:"weight" validate:"gte=0"`
+	Length           int    `json:"length" validate:"gte=0"`
+	Width            int    `json:"width" validate:"gte=0"`
+	Height           int    `json:"height" validate:"gte=0"`
+	ReorderThreshold int    `json:"reorder_threshold" validate:"gte=0"`
 }
 
 type CartCheckoutPayload struct {
-	Items []CartCheckoutItem `json:"items" validate:"required"`
+	Items            []CartCheckoutItem `json:"items" validate:"required,min=1"`
+	AddressID        int                `json:"address_id"`
+	Coupon           string             `json:"coupon" validate:"max=50"`
+	ShippingMethodID int                `json:"shipping_method_id"`
+}
+
+type CheckoutAddressPayload struct {
+	AddressID        int `json:"address_id"`
+	ShippingMethodID int `json:"shipping_method_id"`
 }
 
 type Product struct {
 	ID          int     `json:"id"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Price       Money   `json:"price"`
+	Currency    string  `json:"currency"`
 	Image    string  `json:"image_url"`
 	Quantity   int     `json:"quantity"`
 	CreatedAt   string  `json:"created_at"`
 	UpdatedAt   string  `json:"updated_at"`
 	CategoryID  int     `json:"category_id"`
+	// Weight is in grams and the dimensions of the packed item are in
+	// millimetres; zero when unknown.
+	Weight int `json:"weight"`
+	Length int `json:"length"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// ReorderThreshold is the available stock at or below which staff are
+	// told to reorder; zero turns the alert off.
+	ReorderThreshold int `json:"reorder_threshold"`
+}
+
+type CategoryStore interface {
+	GetCategories() ([]Category, error)
+	GetCategoryByID(id int) (*Category, error)
+	GetCategoryBySlug(slug string) (*Category, error)
+	CreateCategory(category Category) (int, error)
+	UpdateCategory(category Category) error
+	DeleteCategory(id int) error
+}
+
+// Category groups products. A category without a TaxClass takes its
+// parent's; one at the root without one is TaxClassStandard.
+type Category struct {
+	ID       int         `json:"id"`
+	ParentID *int        `json:"parent_id"`
+	Name     string      `json:"name"`
+	Slug     string      `json:"slug"`
+	TaxClass string      `json:"tax_class"`
+	Children []*Category `json:"children,omitempty"`
+}
+
+type CategoryPayload struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Slug     string `json:"slug" validate:"max=100"`
+	ParentID *int   `json:"parent_id"`
+	TaxClass string `json:"tax_class" validate:"max=50"`
 }
 
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
 type User struct {
 	ID        int    `json:"id"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Email     string `json:"email"`
 	Password  string `json:"password,omitempty"` 
+	Role      string `json:"role"`
+	EmailVerified bool `json:"email_verified"`
 	CreatedAt string `json:"created_at"`
 }
 
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(tx Tx, token RefreshToken) error
+	GetRefreshTokenForUpdate(tx Tx, tokenHash string) (*RefreshToken, error)
+	RevokeRefreshToken(tx Tx, id int) error
+	RevokeTokenFamily(tx Tx, familyID string) error
+	RevokeUserRefreshTokens(tx Tx, userID int) error
+}
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// UserToken is a single use token mailed to a user, such as a password reset
+// link. Only its hash is stored.
+type UserToken struct {
+	ID        int
+	UserID    int
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type UserTokenStore interface {
+	CreateUserToken(tx Tx, token UserToken) error
+	GetUserTokenForUpdate(tx Tx, tokenHash string, purpose string) (*UserToken, error)
+	MarkUserTokenUsed(tx Tx, id int) error
+	InvalidateUserTokens(tx Tx, userID int, purpose string) error
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 type RegisterUserPayload struct {
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
@@ -59,24 +271,49 @@ type RegisterUserPayload struct {
 	Password  string `json:"password" validate:"required,min=6,max=20"`
 }
 
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6,max=20"`
+}
+
+type UpdateProfilePayload struct {
+	FirstName *string `json:"first_name" validate:"omitempty,min=1,max=50"`
+	LastName  *string `json:"last_name" validate:"omitempty,min=1,max=50"`
+	Email     *string `json:"email" validate:"omitempty,email,max=100"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6,max=20"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required"`
+}
+
 type LoginUserPayload struct {
 	Email     string `json:"email" validate:"required,email"`
 	Password  string `json:"password" validate:"required"`
 }
 
 type CartItem struct {
-	ID        int     `json:"id"`
-	ProductID int     `json:"product_id"`
-	Title     string  `json:"title"`
-	Price     float64 `json:"price"`
-	Image     string  `json:"image"`
-	Quantity  int     `json:"quantity"`
+	ID        int    `json:"id"`
+	ProductID int    `json:"product_id"`
+	Title     string `json:"title"`
+	Price     Money  `json:"price"`
+	Image     string `json:"image"`
+	Quantity  int    `json:"quantity"`
 }
 
 type Cart struct {
-	ID     int        `json:"id"`
-	UserID int        `json:"user_id"`
-	Items  []CartItem `json:"items"`
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	CouponCode string     `json:"coupon_code"`
+	Items      []CartItem `json:"items"`
 }
 
 type CartStore interface {
@@ -84,25 +321,829 @@ type CartStore interface {
 	AddToCart(userID, productID, quantity int) error
 	RemoveFromCart(userID, productID int) error
 	ClearCart(userID int) error
+	GetCartForUpdate(tx Tx, userID int) (*Cart, error)
+	DeleteCartItems(tx Tx, cartID int) error
+	// SetCartCoupon applies a coupon code to the user's cart; an empty code
+	// removes it.
+	SetCartCoupon(userID int, code string) error
+	ClearCartCoupon(tx Tx, cartID int) error
+}
+
+type CouponPayload struct {
+	Code string `json:"code" validate:"required,max=50"`
+}
+
+// PostalAddress is where a parcel goes. Orders keep their own copy so later
+// edits to the address book do not rewrite them.
+type PostalAddress struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+}
+
+type Address struct {
+	ID     int `json:"id"`
+	UserID int `json:"user_id"`
+	PostalAddress
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
+	CreatedAt         string `json:"created_at"`
+}
+
+type AddressPayload struct {
+	Name              string `json:"name" validate:"required,max=100"`
+	Line1             string `json:"line1" validate:"required,max=255"`
+	Line2             string `json:"line2" validate:"max=255"`
+	City              string `json:"city" validate:"required,max=100"`
+	Region            string `json:"region" validate:"max=100"`
+	PostalCode        string `json:"postal_code" validate:"max=20"`
+	Country           string `json:"country" validate:"required,iso3166_1_alpha2"`
+	Phone             string `json:"phone" validate:"max=30"`
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
 }
 
+type AddressStore interface {
+	GetAddressesByUserID(userID int) ([]Address, error)
+	GetAddressByID(id int) (*Address, error)
+	CreateAddress(tx Tx, address Address) (int, error)
+	UpdateAddress(tx Tx, address Address) error
+	DeleteAddress(id int) error
+	ClearDefaultAddresses(tx Tx, userID int, shipping, billing bool) error
+}
+
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusFulfilled = "fulfilled"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
 type Order struct {
-	ID      int     `json:"id"`
-	UserID  int     `json:"user_id"`
-	Total   float64 `json:"total"`
-	Status  string  `json:"status"`
-	Address string  `json:"address"`
+	ID               int               `json:"id"`
+	UserID           int               `json:"user_id"`
+	Subtotal         Money             `json:"subtotal"`
+	DiscountTotal    Money             `json:"discount_total"`
+	TaxTotal         Money             `json:"tax_total"`
+	ShippingMethodID int               `json:"shipping_method_id"`
+	ShippingMethod   string            `json:"shipping_method"`
+	ShippingTotal    Money             `json:"shipping_total"`
+	Total            Money             `json:"total"`
+	Currency         string            `json:"currency"`
+	ExchangeRate     float64           `json:"exchange_rate"`
+	Status           string            `json:"status"`
+	ShippingAddress  PostalAddress     `json:"shipping_address"`
+	CreatedAt        string            `json:"created_at"`
+	Items            []OrderItem       `json:"items,omitempty"`
+	Discounts        []AppliedDiscount `json:"discounts,omitempty"`
+	Taxes            []TaxLine         `json:"taxes,omitempty"`
 }
 
 type OrderItem struct {
-	ID        int     `json:"id"`
-	OrderID   int     `json:"order_id"`
-	ProductID int     `json:"product_id"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ID           int    `json:"id"`
+	OrderID      int    `json:"order_id"`
+	ProductID    int    `json:"product_id"`
+	ProductName  string `json:"product_name,omitempty"`
+	ProductImage string `json:"product_image,omitempty"`
+	Quantity     int    `json:"quantity"`
+	Price        Money  `json:"price"`
+	Tax          Money  `json:"tax"`
 }
 
 type OrderStore interface {
-	CreateOrder(order Order) (int, error)
-	CreateOrderItem(item OrderItem) error
+	CreateOrder(tx Tx, order Order) (int, error)
+	CreateOrderItem(tx Tx, item OrderItem) error
+	GetOrdersByUserID(userID int, page Page) ([]Order, error)
+	GetOrderByID(id int) (*Order, error)
+	GetOrderItems(orderID int) ([]OrderItem, error)
+	GetOrderForUpdate(tx Tx, id int) (*Order, error)
+	UpdateOrderStatus(tx Tx, orderID int, status string) error
+	CreateOrderStatusChange(tx Tx, change OrderStatusChange) error
+	GetOrderStatusHistory(orderID int) ([]OrderStatusChange, error)
+	CreateOrderDiscount(tx Tx, orderID int, discount AppliedDiscount) error
+	GetOrderDiscounts(orderID int) ([]AppliedDiscount, error)
+	CreateOrderTax(tx Tx, orderID int, tax TaxLine) error
+	GetOrderTaxes(orderID int) ([]TaxLine, error)
+}
+
+const (
+	PaymentStatusPending  = "pending"
+	PaymentStatusCaptured = "captured"
+	PaymentStatusFailed   = "failed"
+	PaymentStatusRefunded = "refunded"
+)
+
+// Payment is one attempt at paying for an order, tracked by the provider
+// under ProviderRef.
+type Payment struct {
+	ID            int    `json:"id"`
+	OrderID       int    `json:"order_id"`
+	Provider      string `json:"provider"`
+	ProviderRef   string `json:"provider_ref"`
+	Amount        Money  `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+const (
+	RefundStatusRequested = "requested"
+	RefundStatusSucceeded = "succeeded"
+)
+
+// Refund is the refund of a payment. It is recorded before the provider is
+// asked for it, so that a payment is refunded at most once however often
+// the refund is retried.
+type Refund struct {
+	PaymentID int
+	Amount    Money
+	Status    string
+	CreatedAt time.Time
+}
+
+type PaymentStore interface {
+	CreatePayment(payment Payment) (int, error)
+	GetPaymentByID(id int) (*Payment, error)
+	GetPaymentByProviderRef(provider, providerRef string) (*Payment, error)
+	GetPaymentsByOrderID(orderID int) ([]Payment, error)
+	GetPaymentForUpdate(tx Tx, id int) (*Payment, error)
+	UpdatePaymentStatus(tx Tx, id int, status string, failureReason string) error
+	// CreateRefund stores refund unless its payment already has one,
+	// reporting whether it was stored.
+	CreateRefund(refund Refund) (bool, error)
+	GetRefund(paymentID int) (*Refund, error)
+	MarkRefundSucceeded(paymentID int) error
+}
+
+// PaymentIntent is a provider's record of an amount to be charged. Amounts
+// are in minor units, such as cents.
+type PaymentIntent struct {
+	ID           string
+	ClientSecret string
+	Amount       int64
+	Currency     string
+	Status       string
+}
+
+// PaymentEvent is a notification a provider sent to the webhook endpoint.
+type PaymentEvent struct {
+	ID       string
+	Type     string
+	IntentID string
+	SignedAt time.Time
+}
+
+const (
+	WebhookEventReceived  = "received"
+	WebhookEventProcessed = "processed"
+	WebhookEventIgnored   = "ignored"
+	WebhookEventFailed    = "failed"
+)
+
+// WebhookEvent is a provider notification as stored on receipt, so that it
+// is processed exactly once and can be replayed.
+type WebhookEvent struct {
+	ID          int
+	Provider    string
+	EventID     string
+	Type        string
+	IntentID    string
+	Payload     []byte
+	Status      string
+	Error       string
+	ReceivedAt  time.Time
+	ProcessedAt *time.Time
+}
+
+type WebhookEventStore interface {
+	// CreateWebhookEvent stores event unless one with the same provider and
+	// event ID exists, reporting whether it was stored.
+	CreateWebhookEvent(event WebhookEvent) (bool, error)
+	GetWebhookEventForUpdate(tx Tx, provider, eventID string) (*WebhookEvent, error)
+	GetWebhookEventsByStatus(status string) ([]WebhookEvent, error)
+	MarkWebhookEventProcessed(tx Tx, id int, status string) error
+	MarkWebhookEventFailed(id int, reason string) error
+}
+
+// IdempotencyKey records a mutating request made with an Idempotency-Key
+// header and, once the request completes, its response. ResponseStatus is
+// zero while the request is in progress.
+type IdempotencyKey struct {
+	ID             int
+	UserID         int
+	Key            string
+	RequestHash    string
+	ResponseStatus int
+	ResponseBody   []byte
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+type IdempotencyStore interface {
+	// CreateIdempotencyKey stores key unless the user already has one with
+	// the same value, reporting whether it was stored.
+	CreateIdempotencyKey(key IdempotencyKey) (bool, error)
+	GetIdempotencyKey(userID int, key string) (*IdempotencyKey, error)
+	SaveIdempotencyResponse(id int, status int, body []byte) error
+	DeleteIdempotencyKey(id int) error
+	DeleteExpiredIdempotencyKeys(before time.Time) (int64, error)
+}
+
+type PaymentProvider interface {
+	Name() string
+	CreateIntent(amount int64, currency string, orderID int) (*PaymentIntent, error)
+	Capture(intentID string) (*PaymentIntent, error)
+	// Refund returns amount of a captured intent. Asking again with the same
+	// idempotencyKey does not refund again.
+	Refund(intentID string, amount int64, idempotencyKey string) error
+	VerifyWebhook(payload []byte, signature string) (*PaymentEvent, error)
+}
+
+// PaymentSession is what a client needs to complete a payment with the
+// provider.
+type PaymentSession struct {
+	PaymentID    int    `json:"payment_id"`
+	ClientSecret string `json:"client_secret"`
+	Amount       Money  `json:"amount"`
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+}
+
+// PaymentService takes payments for orders on behalf of the checkout and
+// order handlers.
+type PaymentService interface {
+	StartPayment(order Order) (*PaymentSession, error)
+	RefundOrder(tx Tx, orderID int) error
+}
+
+type OrderStatusChange struct {
+	ID         int    `json:"id"`
+	OrderID    int    `json:"order_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	ActorID    int    `json:"actor_id"` // zero when the system made the change
+	Note       string `json:"note"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type UpdateOrderStatusPayload struct {
+	Status string `json:"status" validate:"required,oneof=pending paid fulfilled shipped delivered cancelled refunded"`
+	Note   string `json:"note" validate:"max=255"`
+}
+
+const (
+	PromotionPercentage = "percentage"
+	PromotionFixed      = "fixed"
+	PromotionBuyXGetY   = "buy_x_get_y"
+)
+
+// Promotion is a coupon code and the discount it gives. Percentage
+// promotions take Value percent off, fixed ones take Amount off, and buy X get
+// Y ones take Value percent off the cheapest GetQuantity items of every
+// BuyQuantity+GetQuantity bought. A ProductID or CategoryID limits the
+// discount to those items; zero usage limits mean unlimited.
+type Promotion struct {
+	ID             int        `json:"id"`
+	Code           string     `json:"code"`
+	Description    string     `json:"description"`
+	Type           string     `json:"type"`
+	Value          float64    `json:"value"`
+	Amount         Money      `json:"amount"`
+	MinSpend       Money      `json:"min_spend"`
+	BuyQuantity    int        `json:"buy_quantity"`
+	GetQuantity    int        `json:"get_quantity"`
+	ProductID      *int       `json:"product_id"`
+	CategoryID     *int       `json:"category_id"`
+	MaxUses        int        `json:"max_uses"`
+	MaxUsesPerUser int        `json:"max_uses_per_user"`
+	UsedCount      int        `json:"used_count"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	Active         bool       `json:"active"`
+	CreatedAt      string     `json:"created_at"`
+}
+
+type PromotionPayload struct {
+	Code           string     `json:"code" validate:"required,alphanum,max=50"`
+	Description    string     `json:"description" validate:"max=255"`
+	Type           string     `json:"type" validate:"required,oneof=percentage fixed buy_x_get_y"`
+	Value          float64    `json:"value" validate:"gte=0,lte=100"`
+	Amount         Money      `json:"amount" validate:"gte=0"`
+	MinSpend       Money      `json:"min_spend" validate:"gte=0"`
+	BuyQuantity    int        `json:"buy_quantity" validate:"gte=0"`
+	GetQuantity    int        `json:"get_quantity" validate:"gte=0"`
+	ProductID      *int       `json:"product_id"`
+	CategoryID     *int       `json:"category_id"`
+	MaxUses        int        `json:"max_uses" validate:"gte=0"`
+	MaxUsesPerUser int        `json:"max_uses_per_user" validate:"gte=0"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	Active         *bool      `json:"active"`
+}
+
+type PromotionStore interface {
+	GetPromotions() ([]Promotion, error)
+	GetPromotionByID(id int) (*Promotion, error)
+	GetPromotionByCode(code string) (*Promotion, error)
+	GetPromotionByCodeForUpdate(tx Tx, code string) (*Promotion, error)
+	CreatePromotion(promotion Promotion) (int, error)
+	UpdatePromotion(promotion Promotion) error
+	CountRedemptions(promotionID, userID int) (int, error)
+	CountRedemptionsForUpdate(tx Tx, promotionID, userID int) (int, error)
+	// CreateRedemption records that userID used the promotion on orderID and
+	// counts it towards the promotion's usage limit.
+	CreateRedemption(tx Tx, promotionID, userID, orderID int) error
+}
+
+// PriceLine is a line of a cart as the promotion engine sees it.
+type PriceLine struct {
+	ProductID  int
+	CategoryID int
+	UnitPrice  Money
+	Quantity   int
+}
+
+type AppliedDiscount struct {
+	PromotionID int    `json:"-"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Amount      Money  `json:"amount"`
+}
+
+// PriceBreakdown is what a cart costs. Tax and shipping are only worked out
+// once it is known where the cart ships to, and Total then includes the
+// shipping and any tax not already in the prices.
+type PriceBreakdown struct {
+	Subtotal      Money             `json:"subtotal"`
+	Discounts     []AppliedDiscount `json:"discounts"`
+	DiscountTotal Money             `json:"discount_total"`
+	Tax           *TaxBreakdown     `json:"tax,omitempty"`
+	Shipping      *ShippingOption   `json:"shipping,omitempty"`
+	Total         Money             `json:"total"`
+}
+
+// PromotionService prices carts with coupons on behalf of the cart handler.
+type PromotionService interface {
+	// Price works out what lines cost userID with the coupon code applied.
+	// An empty code prices them without a discount.
+	Price(userID int, code string, lines []PriceLine) (*PriceBreakdown, error)
+	// PriceForUpdate is Price inside tx, holding the promotion's row lock so
+	// its usage limits cannot be overrun by concurrent checkouts.
+	PriceForUpdate(tx Tx, userID int, code string, lines []PriceLine) (*PriceBreakdown, error)
+	// Redeem records the use of the promotions behind breakdown by orderID.
+	Redeem(tx Tx, userID, orderID int, breakdown PriceBreakdown) error
+}
+
+// ExchangeRate is how many units of Currency one unit of the default
+// currency buys.
+type ExchangeRate struct {
+	Currency  string  `json:"currency"`
+	Rate      float64 `json:"rate"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+type ExchangeRatePayload struct {
+	Rate float64 `json:"rate" validate:"required,gt=0"`
+}
+
+// ProductPrice is an explicit price for a product in a currency, used in
+// place of converting its catalog price.
+type ProductPrice struct {
+	ProductID int    `json:"product_id"`
+	Currency  string `json:"currency"`
+	Price     Money  `json:"price"`
+}
+
+type ProductPricePayload struct {
+	Price Money `json:"price" validate:"required,gt=0"`
+}
+
+type CurrencyStore interface {
+	GetExchangeRates() ([]ExchangeRate, error)
+	GetExchangeRate(currency string) (*ExchangeRate, error)
+	SetExchangeRate(currency string, rate float64) error
+	GetProductPrices(productID int) ([]ProductPrice, error)
+	// GetPricesInCurrency returns the explicit prices in currency of those
+	// of productIDs that have one, keyed by product ID.
+	GetPricesInCurrency(currency string, productIDs []int) (map[int]Money, error)
+	SetProductPrice(price ProductPrice) error
+	DeleteProductPrice(productID int, currency string) error
+}
+
+// CurrencyService prices the catalog in the currencies the store sells in.
+type CurrencyService interface {
+	// LocalizePrices sets the price of each of products to its price in
+	// currency: its price list entry if it has one, or else its catalog
+	// price converted at the current exchange rate.
+	LocalizePrices(currency string, products ...*Product) error
+	// Convert converts amount into currency at the current exchange rates.
+	Convert(amount Money, currency string) (Money, error)
+	// ExchangeRate returns how many units of currency one unit of the
+	// default currency buys.
+	ExchangeRate(currency string) (float64, error)
+}
+
+const TaxClassStandard = "standard"
+
+// TaxRate is a rule of the built-in tax calculator: Rate percent on goods of
+// TaxClass shipped to Country, or only to Region of it when Region is set.
+// Inclusive rates are already part of the prices; the others are added on
+// top.
+type TaxRate struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Country   string  `json:"country"`
+	Region    string  `json:"region"`
+	TaxClass  string  `json:"tax_class"`
+	Rate      float64 `json:"rate"`
+	Inclusive bool    `json:"inclusive"`
+	CreatedAt string  `json:"created_at"`
+}
+
+type TaxRatePayload struct {
+	Name      string  `json:"name" validate:"required,max=100"`
+	Country   string  `json:"country" validate:"required,iso3166_1_alpha2"`
+	Region    string  `json:"region" validate:"max=100"`
+	TaxClass  string  `json:"tax_class" validate:"max=50"`
+	Rate      float64 `json:"rate" validate:"gte=0,lte=100"`
+	Inclusive bool    `json:"inclusive"`
+}
+
+type TaxRateStore interface {
+	GetTaxRates() ([]TaxRate, error)
+	GetTaxRateByID(id int) (*TaxRate, error)
+	// GetTaxRatesForAddress returns the rates for country that apply to the
+	// whole of it or to region.
+	GetTaxRatesForAddress(country, region string) ([]TaxRate, error)
+	CreateTaxRate(rate TaxRate) (int, error)
+	UpdateTaxRate(rate TaxRate) error
+	DeleteTaxRate(id int) error
+}
+
+// TaxLine is the tax charged at one rate.
+type TaxLine struct {
+	TaxRateID int     `json:"-"`
+	Name      string  `json:"name"`
+	Country   string  `json:"country"`
+	Region    string  `json:"region"`
+	Rate      float64 `json:"rate"`
+	Inclusive bool    `json:"inclusive"`
+	Amount    Money   `json:"amount"`
+}
+
+type TaxBreakdown struct {
+	Lines []TaxLine `json:"lines"`
+	// Items is the tax on each of the price lines it was worked out for,
+	// in the same order.
+	Items []Money `json:"-"`
+	// Total is all of the tax; Exclusive is the part of it that is not
+	// already in the prices.
+	Total     Money `json:"total"`
+	Exclusive Money `json:"exclusive"`
+}
+
+// TaxCalculator works out the tax on carts on behalf of the cart handler.
+type TaxCalculator interface {
+	// Calculate works out the tax on lines shipped to address, once
+	// discount has been spread over them in proportion to their price.
+	Calculate(address PostalAddress, lines []PriceLine, discount Money) (*TaxBreakdown, error)
+}
+
+const (
+	ShippingFlatRate    = "flat_rate"
+	ShippingWeightBased = "weight_based"
+	ShippingFreeOver    = "free_over"
+	ShippingPickup      = "pickup"
+)
+
+// ShippingMethod is a way of delivering orders and what it costs, in the
+// default currency. Flat rate methods cost Rate, weight based ones the Rate
+// of the first of Tiers the parcel is no heavier than, free over ones cost
+// Rate unless the goods come to FreeOver or more, and pickup is free. A
+// method is offered in Countries, or everywhere when there are none.
+type ShippingMethod struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name"`
+	Type      string         `json:"type"`
+	Rate      Money          `json:"rate"`
+	FreeOver  Money          `json:"free_over"`
+	Tiers     []ShippingTier `json:"tiers"`
+	Countries []string       `json:"countries"`
+	Active    bool           `json:"active"`
+	CreatedAt string         `json:"created_at"`
+}
+
+// ShippingTier prices parcels of up to MaxWeight grams.
+type ShippingTier struct {
+	MaxWeight int   `json:"max_weight" validate:"gt=0"`
+	Rate      Money `json:"rate" validate:"gte=0"`
+}
+
+type ShippingMethodPayload struct {
+	Name      string         `json:"name" validate:"required,max=100"`
+	Type      string         `json:"type" validate:"required,oneof=flat_rate weight_based free_over pickup"`
+	Rate      Money          `json:"rate" validate:"gte=0"`
+	FreeOver  Money          `json:"free_over" validate:"gte=0"`
+	Tiers     []ShippingTier `json:"tiers" validate:"dive"`
+	Countries []string       `json:"countries" validate:"dive,iso3166_1_alpha2"`
+	Active    *bool          `json:"active"`
+}
+
+type ShippingMethodStore interface {
+	GetShippingMethods() ([]ShippingMethod, error)
+	GetShippingMethodByID(id int) (*ShippingMethod, error)
+	CreateShippingMethod(method ShippingMethod) (int, error)
+	// UpdateShippingMethod saves method, replacing its tiers.
+	UpdateShippingMethod(method ShippingMethod) error
+	DeleteShippingMethod(id int) error
+}
+
+// Parcel is what an order ships as: its billable Weight in grams and the
+// Value of the goods after discounts.
+type Parcel struct {
+	Weight int
+	Value  Money
+}
+
+// ShippingOption is a method a parcel can be shipped by and what it costs.
+type ShippingOption struct {
+	MethodID int    `json:"method_id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Cost     Money  `json:"cost"`
+}
+
+// ShippingRateProvider quotes for delivery on behalf of the cart handler.
+type ShippingRateProvider interface {
+	// Quote returns the options for shipping parcel to address, cheapest
+	// first, with costs in the currency of the parcel's value.
+	Quote(address PostalAddress, parcel Parcel) ([]ShippingOption, error)
+}
+
+const (
+	ReservationActive    = "active"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+)
+
+// StockReservation holds Quantity units of a product at a location for an
+// order awaiting payment. While active it counts against the product's
+// available stock but not its quantity on hand; committing it on payment
+// takes the units off hand, and releasing it gives them back to sell.
+type StockReservation struct {
+	ID         int       `json:"id"`
+	ProductID  int       `json:"product_id"`
+	LocationID int       `json:"location_id"`
+	OrderID    int       `json:"order_id"`
+	Quantity   int       `json:"quantity"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StockLevel is how much of a product is on hand, how much of that active
+// reservations hold and how much is left to sell.
+type StockLevel struct {
+	ProductID int    `json:"product_id"`
+	Name      string `json:"name"`
+	OnHand    int    `json:"on_hand"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+}
+
+type ReservationStore interface {
+	// GetLocationStockForUpdate returns the stock of the products with
+	// productIDs at every location, locking it inside tx until stock is
+	// reserved against it.
+	GetLocationStockForUpdate(tx Tx, productIDs []int) ([]LocationStock, error)
+	CreateReservation(tx Tx, r StockReservation) error
+	GetOrderReservationsForUpdate(tx Tx, orderID int) ([]StockReservation, error)
+	GetActiveReservations(productID int) ([]StockReservation, error)
+	UpdateReservationStatus(tx Tx, id int, status string) error
+	// GetOrdersWithExpiredReservations returns the IDs of orders holding
+	// active reservations that expired before now.
+	GetOrdersWithExpiredReservations(now time.Time) ([]int, error)
+	// GetStockLevels returns the stock levels of the products with
+	// productIDs, or of every product when there are none.
+	GetStockLevels(productIDs ...int) ([]StockLevel, error)
+}
+
+// InventoryService moves stock through reservations on behalf of checkout,
+// payments and order management.
+type InventoryService interface {
+	// Reserve holds the stock for items of the order shipping to address
+	// inside tx, at the locations the allocation strategy picks, failing
+	// if any of it is not available.
+	Reserve(tx Tx, orderID int, items []CartCheckoutItem, address PostalAddress) error
+	// Commit takes the stock the order's reservations hold off hand once it
+	// is paid.
+	Commit(tx Tx, orderID int) error
+	// Release gives back the stock held or taken for a cancelled order. It
+	// reports whether the order had reservations; orders placed before
+	// reservations took their stock at checkout.
+	Release(tx Tx, orderID int) (bool, error)
+	// Adjust records a change to a product's stock at a location, or at the
+	// default location when a.LocationID is zero, inside tx.
+	Adjust(tx Tx, a StockAdjustment) (*StockMovement, error)
+}
+
+// StockLocation is a warehouse stock is kept at and shipped from. Checkout
+// allocates from active locations, nearest to the shipping address first
+// and, among equally near ones, lowest Priority first.
+type StockLocation struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Code      string `json:"code"`
+	Country   string `json:"country"`
+	Region    string `json:"region"`
+	Priority  int    `json:"priority"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+}
+
+type StockLocationPayload struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Code     string `json:"code" validate:"required,max=20,alphanum"`
+	Country  string `json:"country" validate:"required,iso3166_1_alpha2"`
+	Region   string `json:"region" validate:"max=100"`
+	Priority int    `json:"priority" validate:"gte=0"`
+	Active   *bool  `json:"active"`
+}
+
+type StockLocationStore interface {
+	GetStockLocations() ([]StockLocation, error)
+	GetStockLocationByID(id int) (*StockLocation, error)
+	CreateStockLocation(location StockLocation) (int, error)
+	UpdateStockLocation(location StockLocation) error
+	// GetLocationStock returns the stock of a product at every location
+	// that has held it.
+	GetLocationStock(productID int) ([]LocationStock, error)
+}
+
+// LocationStock is how much of a product a location has on hand and how
+// much of that active reservations hold.
+type LocationStock struct {
+	LocationID int `json:"location_id"`
+	ProductID  int `json:"product_id"`
+	OnHand     int `json:"on_hand"`
+	Reserved   int `json:"reserved"`
+}
+
+// Allocation is how much of a product an order takes from a location.
+type Allocation struct {
+	LocationID int
+	ProductID  int
+	Quantity   int
+}
+
+// AllocationStrategy decides which locations an order ships from.
+type AllocationStrategy interface {
+	// Allocate covers items from the stock available at locations, which
+	// are sorted nearest to the shipping address first. It fails if they
+	// cannot all be covered.
+	Allocate(items []CartCheckoutItem, locations []StockLocation, stock []LocationStock) ([]Allocation, error)
+}
+
+const (
+	StockMovementTransfer   = "transfer"
+	StockMovementSale       = "sale"
+	StockMovementRestock    = "restock"
+	StockMovementReturn     = "return"
+	StockMovementAdjustment = "adjustment"
+	StockMovementDamage     = "damage"
+)
+
+// StockMovement is an entry in the append-only ledger of stock moving
+// into, out of and between locations. FromLocationID is zero for stock
+// arriving and ToLocationID is zero for stock leaving, so a product's
+// quantity is what arrived less what left.
+type StockMovement struct {
+	ID             int       `json:"id"`
+	ProductID      int       `json:"product_id"`
+	FromLocationID int       `json:"from_location_id,omitempty"`
+	ToLocationID   int       `json:"to_location_id,omitempty"`
+	Quantity       int       `json:"quantity"`
+	Reason         string    `json:"reason"`
+	OrderID        int       `json:"order_id,omitempty"`
+	ActorID        int       `json:"actor_id,omitempty"`
+	Note           string    `json:"note"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type StockTransferPayload struct {
+	ProductID      int    `json:"product_id" validate:"required"`
+	FromLocationID int    `json:"from_location_id" validate:"required"`
+	ToLocationID   int    `json:"to_location_id" validate:"required,nefield=FromLocationID"`
+	Quantity       int    `json:"quantity" validate:"required,gt=0"`
+	Note           string `json:"note" validate:"max=255"`
+}
+
+// StockAdjustment changes a product's stock by Quantity units, adding stock
+// when it is positive and taking it away when it is negative.
+type StockAdjustment struct {
+	ProductID  int
+	LocationID int
+	Quantity   int
+	Reason     string
+	OrderID    int
+	ActorID    int
+	Note       string
+}
+
+// StockAdjustmentPayload is a stock change made by staff. Restocks and
+// returns add stock, damage takes it away and adjustments, for counts that
+// disagree with the books, go either way.
+type StockAdjustmentPayload struct {
+	LocationID int    `json:"location_id"`
+	Quantity   int    `json:"quantity" validate:"required"`
+	Reason     string `json:"reason" validate:"required,oneof=restock return adjustment damage"`
+	OrderID    int    `json:"order_id"`
+	Note       string `json:"note" validate:"max=255"`
+}
+
+// StockReconciliation compares a product's quantity with the stock its
+// locations hold and with what its ledger adds up to. They agree unless
+// stock was changed behind the ledger's back.
+type StockReconciliation struct {
+	ProductID  int  `json:"product_id"`
+	Quantity   int  `json:"quantity"`
+	Located    int  `json:"located"`
+	Ledger     int  `json:"ledger"`
+	Reconciled bool `json:"reconciled"`
+}
+
+// StockMovementFilter narrows down the ledger for GetStockMovements, newest
+// first. Zero values mean "no restriction".
+type StockMovementFilter struct {
+	Page
+	ProductID  int
+	LocationID int
+}
+
+type StockMovementStore interface {
+	// RecordMovement moves stock as m describes and appends m to the
+	// ledger inside tx, failing if the source location does not have
+	// m.Quantity on hand.
+	RecordMovement(tx Tx, m StockMovement) (int, error)
+	// TransferStock moves m.Quantity of a product between locations and
+	// records m, failing if the source does not have that much available.
+	TransferStock(m StockMovement) (int, error)
+	GetStockMovements(filter StockMovementFilter) ([]StockMovement, error)
+	// ReconcileStock returns the reconciliations of the products with
+	// productIDs, or of every product when there are none.
+	ReconcileStock(productIDs ...int) ([]StockReconciliation, error)
+}
+
+// LowStockAlert tells staff that a product's available stock has fallen to
+// its reorder threshold or below.
+type LowStockAlert struct {
+	ProductID int    `json:"product_id"`
+	Name      string `json:"name"`
+	Available int    `json:"available"`
+	Threshold int    `json:"reorder_threshold"`
+}
+
+// StockNotifier tells staff about stock that needs their attention.
+type StockNotifier interface {
+	NotifyLowStock(alerts []LowStockAlert) error
+}
+
+// StockSubscription asks for a customer to be emailed once a product that
+// was out of stock can be bought again.
+type StockSubscription struct {
+	ID          int        `json:"id"`
+	ProductID   int        `json:"product_id"`
+	ProductName string     `json:"product_name"`
+	UserID      int        `json:"user_id"`
+	Email       string     `json:"-"`
+	FirstName   string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	NotifiedAt  *time.Time `json:"notified_at"`
+}
+
+type StockAlertStore interface {
+	// GetNewLowStock returns the products whose available stock is at or
+	// below their reorder threshold and that staff have not been alerted
+	// about since it last was above it.
+	GetNewLowStock() ([]LowStockAlert, error)
+	MarkLowStockAlerted(productIDs []int) error
+	// ClearRestockedAlerts forgets the alerts of products back above their
+	// reorder threshold, so that they alert again when they next run low.
+	ClearRestockedAlerts() error
+	// CreateStockSubscription subscribes a user to a product, renewing a
+	// subscription that was already notified.
+	CreateStockSubscription(productID, userID int) error
+	// GetDueStockSubscriptions returns the subscriptions not yet notified
+	// whose product has stock available.
+	GetDueStockSubscriptions() ([]StockSubscription, error)
+	MarkStockSubscriptionNotified(id int) error
 }
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/types"
+)
+
+// EncodeCursor serialises c into an opaque token signed with secret, so that
+// clients can hand it back but not forge or alter it.
+func EncodeCursor(secret []byte, c types.Cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + signCursor(secret, body), nil
+}
+
+// DecodeCursor verifies and decodes a token issued by EncodeCursor, which
+// must have been issued for the listing kind.
+func DecodeCursor(secret []byte, kind, token string) (*types.Cursor, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signCursor(secret, body))) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	c := new(types.Cursor)
+	if err := json.Unmarshal(payload, c); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.Kind != kind {
+		return nil, fmt.Errorf("cursor was not issued for this listing")
+	}
+
+	return c, nil
+}
+
+func signCursor(secret []byte, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TrimPage takes rows fetched with a limit of one more than page.Limit, in
+// display order, drops the extra row and reports whether further rows exist
+// after the last and before the first row returned.
+func TrimPage[T any](rows []T, page types.Page) (trimmed []T, hasNext, hasPrev bool) {
+	more := len(rows) > page.Limit
+	if page.Cursor != nil && page.Cursor.Backward {
+		if more {
+			rows = rows[len(rows)-page.Limit:]
+		}
+		return rows, true, more
+	}
+
+	if more {
+		rows = rows[:page.Limit]
+	}
+	return rows, more, page.Cursor != nil || page.Offset > 0
+}
+
+// PageCursors encodes the cursors pointing to the pages after and before
+// rows, leaving them nil where no such page exists. cursorFor describes the
+// position of a single row.
+func PageCursors[T any](secret []byte, rows []T, hasNext, hasPrev bool, cursorFor func(T) types.Cursor) (next, prev *string, err error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	if hasNext {
+		token, err := EncodeCursor(secret, cursorFor(rows[len(rows)-1]))
+		if err != nil {
+			return nil, nil, err
+		}
+		next = &token
+	}
+
+	if hasPrev {
+		c := cursorFor(rows[0])
+		c.Backward = true
+		token, err := EncodeCursor(secret, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		prev = &token
+	}
+
+	return next, prev, nil
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+
+	"backend/types"
+)
+
+func TestCursor(t *testing.T) {
+	secret := []byte("secret")
+	cursor := types.Cursor{Kind: types.CursorProducts, Sort: "price_asc", Key: "9.99", ID: 42, Backward: true}
+
+	token, err := EncodeCursor(secret, cursor)
+	if err != nil {
+		t.Fatalf("error encoding cursor: %v", err)
+	}
+
+	decoded, err := DecodeCursor(secret, types.CursorProducts, token)
+	if err != nil {
+		t.Fatalf("error decoding cursor: %v", err)
+	}
+	if *decoded != cursor {
+		t.Errorf("expected %+v, got %+v", cursor, *decoded)
+	}
+
+	if _, err := DecodeCursor([]byte("other"), types.CursorProducts, token); err == nil {
+		t.Error("expected cursor signed with another secret to be rejected")
+	}
+
+	if _, err := DecodeCursor(secret, types.CursorProducts, "x"+token); err == nil {
+		t.Error("expected tampered cursor to be rejected")
+	}
+
+	if _, err := DecodeCursor(secret, types.CursorOrders, token); err == nil {
+		t.Error("expected cursor issued for another listing to be rejected")
+	}
+}
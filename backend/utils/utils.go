@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
 
+	"backend/types"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -28,14 +31,41 @@ func WriteError(w http.ResponseWriter, status int, err error) {
 	WriteJSON(w, status, map[string]string{"error": err.Error()})
 }
 
-var Validate = validator.New()
+var Validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// Money is validated by its minor units, so tags such as gt=0 apply.
+	v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		return field.Interface().(types.Money).Minor
+	}, types.Money{})
+	return v
+}
+
+// NullableID stores an unset (zero) foreign key as NULL.
+func NullableID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// InClause returns a parenthesised list of placeholders for ids and the ids
+// as query arguments.
+func InClause(ids []int) (string, []any) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return "(?" + strings.Repeat(",?", len(ids)-1) + ")", args
+}
 
 func GetTokenFromRequest(r *http.Request) string {
 	tokenAuth := r.Header.Get("Authorization")
 	tokenQuery := r.URL.Query().Get("token")
 	
 	if tokenAuth != "" {
-		return tokenAuth
+		return strings.TrimPrefix(tokenAuth, "Bearer ")
 	}
 
 	if tokenQuery != "" {
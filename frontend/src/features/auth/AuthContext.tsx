@@ -1,4 +1,29 @@
 import React, { createContext, useContext, useEffect, useState } from 'react';
+import axios from 'axios';
+
+const API_URL = 'http://localhost:8081/api/v1';
+
+// Access tokens are short lived: when a request is rejected, trade the refresh
+// token for a new pair once and replay the request.
+axios.interceptors.response.use(undefined, async (error) => {
+  const original = error.config;
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (error.response?.status !== 403 || !refreshToken || !original || original._retried) {
+    return Promise.reject(error);
+  }
+  original._retried = true;
+
+  try {
+    const { data } = await axios.post(`${API_URL}/token/refresh`, { refresh_token: refreshToken });
+    localStorage.setItem('jwt', data.token);
+    localStorage.setItem('refresh_token', data.refresh_token);
+    original.headers = { ...original.headers, Authorization: `Bearer ${data.token}` };
+    return axios(original);
+  } catch {
+    localStorage.removeItem('refresh_token');
+    return Promise.reject(error);
+  }
+});
 
 interface AuthContextType {
   isLoggedIn: boolean;
@@ -30,6 +55,11 @@ export const AuthProvider: React.FC<{ children: React.ReactNode }> = ({ children
   };
 
   const logout = () => {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (refreshToken) {
+      axios.post(`${API_URL}/logout`, { refresh_token: refreshToken }).catch(() => {});
+    }
+    localStorage.removeItem('refresh_token');
     localStorage.removeItem('jwt');
     localStorage.removeItem('user');
     setIsLoggedIn(false);
@@ -41,6 +41,9 @@ const AuthForm: React.FC<AuthFormProps> = ({ mode, onSuccess }) => {
       if (data.token) {
         localStorage.setItem('jwt', data.token);
       }
+      if (data.refresh_token) {
+        localStorage.setItem('refresh_token', data.refresh_token);
+      }
     
       login(data.token || 'demo-token', { name: data.firstName || data.username || email });
       onSuccess();
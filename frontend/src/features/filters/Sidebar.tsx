@@ -1,20 +1,31 @@
 import React, { useEffect } from 'react'
 import { useFilter } from '@/features/filters/FilterContext'
 
-interface FetchResponse {
-  products: Product[]
+interface Category {
+  id: number
+  name: string
+  slug: string
+  children?: Category[]
 }
 
-interface Product {
-  category: string
+interface CategoryOption {
+  name: string
+  slug: string
+  depth: number
 }
 
+const flattenCategories = (categories: Category[], depth = 0): CategoryOption[] =>
+  categories.flatMap(category => [
+    { name: category.name, slug: category.slug, depth },
+    ...flattenCategories(category.children ?? [], depth + 1),
+  ])
+
 const Sidebar = () => {
 
   const { searchQuery, setSearchQuery, selectedCategory, setSelectedCategory, minPrice, setMinPrice, maxPrice, setMaxPrice, keyword, setKeyword } = useFilter()
 
 
-  const [categories, setCategories] = React.useState<string[]>([])
+  const [categories, setCategories] = React.useState<CategoryOption[]>([])
   const [keywords] = React.useState<string[]>([
     "Apple",
     "Watch",
@@ -57,15 +68,14 @@ const Sidebar = () => {
   useEffect(() => {
     const fetchCategories = async () => {
       try {
-        const response = await fetch('http://localhost:8081/api/v1/products')
+        const response = await fetch('http://localhost:8081/api/v1/categories')
         if (!response.ok) {
           throw new Error('Network response was not ok')
         }
-        const data : FetchResponse = await response.json()
-        const uniqueCategories = Array.from(new Set(data.products.map((product: Product) => product.category)))
-        setCategories(uniqueCategories)
+        const data : Category[] = await response.json()
+        setCategories(flattenCategories(data))
       } catch (error) {
-        console.error("Error fetching products:", error)
+        console.error("Error fetching categories:", error)
       }
     }
 
@@ -85,10 +95,10 @@ const Sidebar = () => {
         {/* Categories */}
         <div className="mb-5"><h2 className="text-xl font-semibold mb-3">Categories</h2></div>
         {
-          categories.map((category, index) => (
-            <label key={index} className="block mb-2">
-              <input type="radio" name="category" value={category} className="mr-2 w-[16px] h-[16px]" onChange={() => handleRadioChangeCategories(category)} checked={selectedCategory === category} />
-              {category}
+          categories.map((category) => (
+            <label key={category.slug} className="block mb-2" style={{ paddingLeft: `${category.depth}rem` }}>
+              <input type="radio" name="category" value={category.slug} className="mr-2 w-[16px] h-[16px]" onChange={() => handleRadioChangeCategories(category.slug)} checked={selectedCategory === category.slug} />
+              {category.name}
               </label>
           )
         )}
@@ -21,7 +21,15 @@ const MainContent = () => {
     );
 
     if (isFiltering) {
-      if (keyword && keyword.trim() !== '') {
+      if (selectedCategory) {
+        axios.get(`http://localhost:8081/api/v1/categories/${encodeURIComponent(selectedCategory)}/products`)
+          .then(response => {
+            setProducts(response.data || []);
+          })
+          .catch(error => {
+            console.error('Error fetching products:', error);
+          });
+      } else if (keyword && keyword.trim() !== '') {
         axios.get(`http://localhost:8081/api/v1/products?q=${encodeURIComponent(keyword)}`)
           .then(response => {
             setProducts(response.data.products || response.data || []);
@@ -64,12 +72,6 @@ const MainContent = () => {
       );
     }
 
-    if (selectedCategory) {
-      filteredProducts = filteredProducts.filter(product =>
-        product.category === selectedCategory
-      );
-    }
-
     if (minPrice !== undefined) {
       filteredProducts = filteredProducts.filter(product =>
         product.price >= minPrice